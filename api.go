@@ -0,0 +1,216 @@
+package golivyclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+//LivyAPI livy的全部接口操作,返回值为livy响应的原始json
+//
+//LivyClient是基于http的默认实现,可以通过LivyClient.API替换为mock,缓存或多集群路由等其他实现
+type LivyAPI interface {
+	//ListBatches 列出batch
+	ListBatches(ctx context.Context, from, size int) ([]byte, error)
+	//CreateBatch 创建batch
+	CreateBatch(ctx context.Context, q *NewBatchQuery) ([]byte, error)
+	//GetBatch 获取batch信息
+	GetBatch(ctx context.Context, id int) ([]byte, error)
+	//GetBatchState 获取batch的状态
+	GetBatchState(ctx context.Context, id int) ([]byte, error)
+	//GetBatchLog 获取batch的日志
+	GetBatchLog(ctx context.Context, id int, from, size int) ([]byte, error)
+	//DeleteBatch 删除batch
+	DeleteBatch(ctx context.Context, id int) error
+
+	//ListSessions 列出session
+	ListSessions(ctx context.Context, from, size int) ([]byte, error)
+	//CreateSession 创建session
+	CreateSession(ctx context.Context, q *NewSessionQuery) ([]byte, error)
+	//GetSession 获取session信息
+	GetSession(ctx context.Context, id int) ([]byte, error)
+	//GetSessionState 获取session的状态
+	GetSessionState(ctx context.Context, id int) ([]byte, error)
+	//GetSessionLog 获取session的日志
+	GetSessionLog(ctx context.Context, id int, from, size int) ([]byte, error)
+	//DeleteSession 删除session
+	DeleteSession(ctx context.Context, id int) error
+	//ConnectSession 向session发送心跳
+	ConnectSession(ctx context.Context, id int) ([]byte, error)
+
+	//ListStatements 列出session中的statement
+	ListStatements(ctx context.Context, sessionID int) ([]byte, error)
+	//CreateStatement 在session中创建statement
+	CreateStatement(ctx context.Context, sessionID int, q *NewStatementQuery) ([]byte, error)
+	//GetStatement 获取statement信息
+	GetStatement(ctx context.Context, sessionID, id int) ([]byte, error)
+	//CancelStatement 取消statement的执行
+	CancelStatement(ctx context.Context, sessionID, id int) error
+
+	//UploadJar 上传jar到session
+	UploadJar(ctx context.Context, sessionID int, name string, r io.Reader) error
+	//UploadPyFile 上传python文件到session
+	UploadPyFile(ctx context.Context, sessionID int, name string, r io.Reader) error
+	//UploadFile 上传文件到session
+	UploadFile(ctx context.Context, sessionID int, name string, r io.Reader) error
+	//AddJar 通过uri为session添加jar
+	AddJar(ctx context.Context, sessionID int, uri string) error
+	//AddPyFile 通过uri为session添加python文件
+	AddPyFile(ctx context.Context, sessionID int, uri string) error
+	//AddFile 通过uri为session添加文件
+	AddFile(ctx context.Context, sessionID int, uri string) error
+
+	//SubmitJob 在session中提交序列化任务
+	SubmitJob(ctx context.Context, sessionID int, q *SerializedJob) ([]byte, error)
+	//RunJob 在session中运行序列化任务
+	RunJob(ctx context.Context, sessionID int, q *SerializedJob) ([]byte, error)
+	//GetJob 获取任务状态
+	GetJob(ctx context.Context, sessionID int, id int64) ([]byte, error)
+	//CancelJob 取消任务
+	CancelJob(ctx context.Context, sessionID int, id int64) error
+}
+
+//ListBatches 列出batch
+func (c *LivyClient) ListBatches(ctx context.Context, from, size int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("batches?from=%d&size=%d", from, size))
+}
+
+//CreateBatch 创建batch
+func (c *LivyClient) CreateBatch(ctx context.Context, q *NewBatchQuery) ([]byte, error) {
+	return c.query(ctx, "POST", "batches", q)
+}
+
+//GetBatch 获取batch信息
+func (c *LivyClient) GetBatch(ctx context.Context, id int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("batches/%d", id))
+}
+
+//GetBatchState 获取batch的状态
+func (c *LivyClient) GetBatchState(ctx context.Context, id int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("batches/%d/state", id))
+}
+
+//GetBatchLog 获取batch的日志
+func (c *LivyClient) GetBatchLog(ctx context.Context, id int, from, size int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("batches/%d/log?from=%d&size=%d", id, from, size))
+}
+
+//DeleteBatch 删除batch
+func (c *LivyClient) DeleteBatch(ctx context.Context, id int) error {
+	_, err := c.query(ctx, "DELETE", fmt.Sprintf("batches/%d", id))
+	return err
+}
+
+//ListSessions 列出session
+func (c *LivyClient) ListSessions(ctx context.Context, from, size int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("sessions?from=%d&size=%d", from, size))
+}
+
+//CreateSession 创建session
+func (c *LivyClient) CreateSession(ctx context.Context, q *NewSessionQuery) ([]byte, error) {
+	return c.query(ctx, "POST", "sessions", q)
+}
+
+//GetSession 获取session信息
+func (c *LivyClient) GetSession(ctx context.Context, id int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("sessions/%d", id))
+}
+
+//GetSessionState 获取session的状态
+func (c *LivyClient) GetSessionState(ctx context.Context, id int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("sessions/%d/state", id))
+}
+
+//GetSessionLog 获取session的日志
+func (c *LivyClient) GetSessionLog(ctx context.Context, id int, from, size int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("sessions/%d/log?from=%d&size=%d", id, from, size))
+}
+
+//DeleteSession 删除session
+func (c *LivyClient) DeleteSession(ctx context.Context, id int) error {
+	_, err := c.query(ctx, "DELETE", fmt.Sprintf("sessions/%d", id))
+	return err
+}
+
+//ConnectSession 向session发送心跳
+func (c *LivyClient) ConnectSession(ctx context.Context, id int) ([]byte, error) {
+	return c.query(ctx, "POST", fmt.Sprintf("sessions/%d/connect", id))
+}
+
+//ListStatements 列出session中的statement
+func (c *LivyClient) ListStatements(ctx context.Context, sessionID int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("sessions/%d/statements", sessionID))
+}
+
+//CreateStatement 在session中创建statement
+func (c *LivyClient) CreateStatement(ctx context.Context, sessionID int, q *NewStatementQuery) ([]byte, error) {
+	return c.query(ctx, "POST", fmt.Sprintf("sessions/%d/statements", sessionID), q)
+}
+
+//GetStatement 获取statement信息
+func (c *LivyClient) GetStatement(ctx context.Context, sessionID, id int) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("sessions/%d/statements/%d", sessionID, id))
+}
+
+//CancelStatement 取消statement的执行
+func (c *LivyClient) CancelStatement(ctx context.Context, sessionID, id int) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/statements/%d/cancel", sessionID, id))
+	return err
+}
+
+//UploadJar 上传jar到session
+func (c *LivyClient) UploadJar(ctx context.Context, sessionID int, name string, r io.Reader) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/upload-jar", sessionID), &UploadFile{Field: "jar", Name: name, Reader: r})
+	return err
+}
+
+//UploadPyFile 上传python文件到session
+func (c *LivyClient) UploadPyFile(ctx context.Context, sessionID int, name string, r io.Reader) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/upload-pyfile", sessionID), &UploadFile{Field: "file", Name: name, Reader: r})
+	return err
+}
+
+//UploadFile 上传文件到session
+func (c *LivyClient) UploadFile(ctx context.Context, sessionID int, name string, r io.Reader) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/upload-file", sessionID), &UploadFile{Field: "file", Name: name, Reader: r})
+	return err
+}
+
+//AddJar 通过uri为session添加jar
+func (c *LivyClient) AddJar(ctx context.Context, sessionID int, uri string) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/add-jar", sessionID), map[string]string{"uri": uri})
+	return err
+}
+
+//AddPyFile 通过uri为session添加python文件
+func (c *LivyClient) AddPyFile(ctx context.Context, sessionID int, uri string) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/add-pyfile", sessionID), map[string]string{"uri": uri})
+	return err
+}
+
+//AddFile 通过uri为session添加文件
+func (c *LivyClient) AddFile(ctx context.Context, sessionID int, uri string) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/add-file", sessionID), map[string]string{"uri": uri})
+	return err
+}
+
+//SubmitJob 在session中提交序列化任务
+func (c *LivyClient) SubmitJob(ctx context.Context, sessionID int, q *SerializedJob) ([]byte, error) {
+	return c.query(ctx, "POST", fmt.Sprintf("sessions/%d/submit-job", sessionID), q)
+}
+
+//RunJob 在session中运行序列化任务
+func (c *LivyClient) RunJob(ctx context.Context, sessionID int, q *SerializedJob) ([]byte, error) {
+	return c.query(ctx, "POST", fmt.Sprintf("sessions/%d/run-job", sessionID), q)
+}
+
+//GetJob 获取任务状态
+func (c *LivyClient) GetJob(ctx context.Context, sessionID int, id int64) ([]byte, error) {
+	return c.query(ctx, "GET", fmt.Sprintf("sessions/%d/jobs/%d", sessionID, id))
+}
+
+//CancelJob 取消任务
+func (c *LivyClient) CancelJob(ctx context.Context, sessionID int, id int64) error {
+	_, err := c.query(ctx, "POST", fmt.Sprintf("sessions/%d/jobs/%d/cancel", sessionID, id))
+	return err
+}
@@ -0,0 +1,352 @@
+package golivyclient
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//queryBuilder BatchBuilder和SessionBuilder共用的部分,方法返回B以便链式调用
+type queryBuilder[B any] struct {
+	self      B
+	client    *LivyClient
+	name      string
+	proxyUser string
+	res       Resources
+	jars      []string
+	pyFiles   []string
+	files     []string
+	archives  []string
+	err       error
+}
+
+func (q *queryBuilder[B]) init(self B, c *LivyClient) {
+	q.self = self
+	q.client = c
+	q.res.Conf = map[string]interface{}{}
+}
+
+//Name 设置名称
+func (q *queryBuilder[B]) Name(name string) B {
+	q.name = name
+	return q.self
+}
+
+//ProxyUser 设置代理的用户
+func (q *queryBuilder[B]) ProxyUser(user string) B {
+	q.proxyUser = user
+	return q.self
+}
+
+//Queue 设置yarn队列
+func (q *queryBuilder[B]) Queue(queue string) B {
+	q.res.Queue = queue
+	return q.self
+}
+
+//DriverMemory 设置driver的内存
+func (q *queryBuilder[B]) DriverMemory(m Memory) B {
+	q.res.DriverMemory = m
+	return q.self
+}
+
+//DriverCores 设置driver的cpu核数
+func (q *queryBuilder[B]) DriverCores(n int) B {
+	q.res.DriverCores = n
+	return q.self
+}
+
+//ExecutorMemory 设置每个executor的内存
+func (q *queryBuilder[B]) ExecutorMemory(m Memory) B {
+	q.res.ExecutorMemory = m
+	return q.self
+}
+
+//ExecutorCores 设置每个executor的cpu核数
+func (q *queryBuilder[B]) ExecutorCores(n int) B {
+	q.res.ExecutorCores = n
+	return q.self
+}
+
+//NumExecutors 设置executor的数量
+func (q *queryBuilder[B]) NumExecutors(n int) B {
+	q.res.NumExecutors = n
+	return q.self
+}
+
+//Jars 添加jar包
+func (q *queryBuilder[B]) Jars(jars ...string) B {
+	q.jars = append(q.jars, jars...)
+	return q.self
+}
+
+//PyFiles 添加python文件
+func (q *queryBuilder[B]) PyFiles(files ...string) B {
+	q.pyFiles = append(q.pyFiles, files...)
+	return q.self
+}
+
+//Files 添加文件
+func (q *queryBuilder[B]) Files(files ...string) B {
+	q.files = append(q.files, files...)
+	return q.self
+}
+
+//Archives 添加压缩包
+func (q *queryBuilder[B]) Archives(archives ...string) B {
+	q.archives = append(q.archives, archives...)
+	return q.self
+}
+
+//Resources 应用一组资源设置,其中不为零值的字段覆盖之前的设置,Conf合并到已有的配置中
+func (q *queryBuilder[B]) Resources(r Resources) B {
+	if r.DriverMemory != 0 {
+		q.res.DriverMemory = r.DriverMemory
+	}
+	if r.DriverCores != 0 {
+		q.res.DriverCores = r.DriverCores
+	}
+	if r.ExecutorMemory != 0 {
+		q.res.ExecutorMemory = r.ExecutorMemory
+	}
+	if r.ExecutorCores != 0 {
+		q.res.ExecutorCores = r.ExecutorCores
+	}
+	if r.NumExecutors != 0 {
+		q.res.NumExecutors = r.NumExecutors
+	}
+	if r.Queue != "" {
+		q.res.Queue = r.Queue
+	}
+	for key, value := range r.Conf {
+		q.res.Conf[key] = value
+	}
+	return q.self
+}
+
+//Preset 应用命名的资源预设,先在LivyClient.Presets中查找,再在DefaultPresets中查找,
+//与Resources相同,之后的设置会覆盖预设;未找到时Build返回错误
+func (q *queryBuilder[B]) Preset(name string) B {
+	r, err := q.client.preset(name)
+	if err != nil {
+		if q.err == nil {
+			q.err = err
+		}
+		return q.self
+	}
+	return q.Resources(r)
+}
+
+//Conf 设置spark配置
+func (q *queryBuilder[B]) Conf(key string, value interface{}) B {
+	q.res.Conf[key] = value
+	return q.self
+}
+
+//DynamicAllocation 开启动态分配executor,数量在min和max之间;
+//同时开启shuffleTracking,不需要外部shuffle服务(spark 3.0以上)
+func (q *queryBuilder[B]) DynamicAllocation(min int, max int) B {
+	q.res.Conf["spark.dynamicAllocation.enabled"] = "true"
+	q.res.Conf["spark.dynamicAllocation.shuffleTracking.enabled"] = "true"
+	q.res.Conf["spark.dynamicAllocation.minExecutors"] = strconv.Itoa(min)
+	q.res.Conf["spark.dynamicAllocation.maxExecutors"] = strconv.Itoa(max)
+	return q.self
+}
+
+//ShufflePartitions 设置spark sql的shuffle分区数
+func (q *queryBuilder[B]) ShufflePartitions(n int) B {
+	q.res.Conf["spark.sql.shuffle.partitions"] = strconv.Itoa(n)
+	return q.self
+}
+
+//YarnConf 设置spark.yarn.开头的配置,key不需要带前缀,如YarnConf("maxAppAttempts", 1)
+func (q *queryBuilder[B]) YarnConf(key string, value interface{}) B {
+	q.res.Conf["spark.yarn."+strings.TrimPrefix(key, "spark.yarn.")] = value
+	return q.self
+}
+
+//YarnTags 添加yarn应用的标签,对应spark.yarn.tags
+func (q *queryBuilder[B]) YarnTags(tags ...string) B {
+	if len(tags) == 0 {
+		return q.self
+	}
+	if old, ok := q.res.Conf["spark.yarn.tags"].(string); ok && old != "" {
+		tags = append([]string{old}, tags...)
+	}
+	q.res.Conf["spark.yarn.tags"] = strings.Join(tags, ",")
+	return q.self
+}
+
+//DriverEnv 设置driver的环境变量,对应spark.yarn.appMasterEnv,只在yarn cluster模式下生效
+func (q *queryBuilder[B]) DriverEnv(name string, value string) B {
+	q.res.Conf["spark.yarn.appMasterEnv."+name] = value
+	return q.self
+}
+
+//ExecutorEnv 设置executor的环境变量,对应spark.executorEnv
+func (q *queryBuilder[B]) ExecutorEnv(name string, value string) B {
+	q.res.Conf["spark.executorEnv."+name] = value
+	return q.self
+}
+
+//Env 同时设置driver和executor的环境变量
+func (q *queryBuilder[B]) Env(name string, value string) B {
+	q.DriverEnv(name, value)
+	return q.ExecutorEnv(name, value)
+}
+
+func (q *queryBuilder[B]) conf() map[string]interface{} {
+	if len(q.res.Conf) == 0 {
+		return nil
+	}
+	conf := make(map[string]interface{}, len(q.res.Conf))
+	for key, value := range q.res.Conf {
+		conf[key] = value
+	}
+	return conf
+}
+
+//BatchBuilder 链式构造NewBatchQuery
+//
+//	q, err := NewBatchBuilder(client, "hdfs:///jobs/etl.jar").
+//		ClassName("com.example.ETL").
+//		Preset("medium").
+//		ExecutorMemory(6 * GB).
+//		DynamicAllocation(2, 20).
+//		Env("TZ", "UTC").
+//		Build()
+type BatchBuilder struct {
+	queryBuilder[*BatchBuilder]
+	file      string
+	className string
+	args      []string
+}
+
+//NewBatchBuilder 创建BatchBuilder,c用于查找资源预设和提交
+func NewBatchBuilder(c *LivyClient, file string) *BatchBuilder {
+	b := new(BatchBuilder)
+	b.init(b, c)
+	b.file = file
+	return b
+}
+
+//ClassName 设置java/scala程序的主类
+func (b *BatchBuilder) ClassName(className string) *BatchBuilder {
+	b.className = className
+	return b
+}
+
+//Args 添加命令行参数
+func (b *BatchBuilder) Args(args ...string) *BatchBuilder {
+	b.args = append(b.args, args...)
+	return b
+}
+
+//Build 生成请求并调用Validate,LivyClient.DefaultConf在提交时合并
+func (b *BatchBuilder) Build() (*NewBatchQuery, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	q := &NewBatchQuery{
+		File:           b.file,
+		ProxyUser:      b.proxyUser,
+		ClassName:      b.className,
+		Args:           b.args,
+		Jars:           b.jars,
+		PyFiles:        b.pyFiles,
+		Files:          b.files,
+		DriverMemory:   b.res.DriverMemory.String(),
+		DriverCores:    b.res.DriverCores,
+		ExecutorMemory: b.res.ExecutorMemory.String(),
+		ExecutorCores:  b.res.ExecutorCores,
+		NumExecutors:   b.res.NumExecutors,
+		Archives:       b.archives,
+		Queue:          b.res.Queue,
+		Name:           b.name,
+		Conf:           b.conf(),
+	}
+	err := q.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+//Submit 生成请求并提交
+func (b *BatchBuilder) Submit(ctx context.Context) (*Batch, error) {
+	q, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	batch := NewBatch(b.client)
+	err = batch.NewWithContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+//SessionBuilder 链式构造NewSessionQuery
+type SessionBuilder struct {
+	queryBuilder[*SessionBuilder]
+	kind             string
+	heartbeatTimeout time.Duration
+}
+
+//NewSessionBuilder 创建SessionBuilder,c用于查找资源预设和提交
+func NewSessionBuilder(c *LivyClient, kind string) *SessionBuilder {
+	b := new(SessionBuilder)
+	b.init(b, c)
+	b.kind = kind
+	return b
+}
+
+//HeartbeatTimeout 设置session的心跳超时,按秒向上取整
+func (b *SessionBuilder) HeartbeatTimeout(d time.Duration) *SessionBuilder {
+	b.heartbeatTimeout = d
+	return b
+}
+
+//Build 生成请求并调用Validate,LivyClient.DefaultConf在提交时合并
+func (b *SessionBuilder) Build() (*NewSessionQuery, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	q := &NewSessionQuery{
+		Name:                     b.name,
+		Kind:                     b.kind,
+		ProxyUser:                b.proxyUser,
+		Jars:                     b.jars,
+		PyFiles:                  b.pyFiles,
+		Files:                    b.files,
+		DriverMemory:             b.res.DriverMemory.String(),
+		DriverCores:              b.res.DriverCores,
+		ExecutorMemory:           b.res.ExecutorMemory.String(),
+		ExecutorCores:            b.res.ExecutorCores,
+		NumExecutors:             b.res.NumExecutors,
+		Archives:                 b.archives,
+		Queue:                    b.res.Queue,
+		Conf:                     b.conf(),
+		HeartbeatTimeoutInSecond: int((b.heartbeatTimeout + time.Second - 1) / time.Second),
+	}
+	err := q.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+//Submit 生成请求并提交,返回的Session需要再调用Wait等待可用
+func (b *SessionBuilder) Submit(ctx context.Context) (*Session, error) {
+	q, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	session := NewSession(b.client)
+	err = session.NewWithContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,240 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchBuilder(t *testing.T) {
+	q, err := NewBatchBuilder(nil, "hdfs:///jobs/etl.jar").
+		Name("etl").
+		ProxyUser("alice").
+		ClassName("com.example.ETL").
+		Args("--date", "2024-01-02").
+		Args("--full").
+		Jars("a.jar").Jars("b.jar").
+		PyFiles("x.py").
+		Files("f.txt").
+		Archives("env.zip").
+		Queue("etl").
+		DriverMemory(1536*MB).DriverCores(2).
+		ExecutorMemory(4*GB).ExecutorCores(3).NumExecutors(5).
+		Conf("spark.sql.adaptive.enabled", true).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &NewBatchQuery{
+		File:           "hdfs:///jobs/etl.jar",
+		ProxyUser:      "alice",
+		ClassName:      "com.example.ETL",
+		Args:           []string{"--date", "2024-01-02", "--full"},
+		Jars:           []string{"a.jar", "b.jar"},
+		PyFiles:        []string{"x.py"},
+		Files:          []string{"f.txt"},
+		DriverMemory:   "1536m",
+		DriverCores:    2,
+		ExecutorMemory: "4g",
+		ExecutorCores:  3,
+		NumExecutors:   5,
+		Archives:       []string{"env.zip"},
+		Queue:          "etl",
+		Name:           "etl",
+		Conf:           map[string]interface{}{"spark.sql.adaptive.enabled": true},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("请求为%+v,应为%+v", q, want)
+	}
+
+	//没有设置的字段为零值,Conf为nil
+	q, err = NewBatchBuilder(nil, "app.py").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q, &NewBatchQuery{File: "app.py"}) {
+		t.Errorf("请求为%+v,应只有File", q)
+	}
+}
+
+func TestSessionBuilder(t *testing.T) {
+	cases := []struct {
+		timeout time.Duration
+		seconds int
+	}{
+		{0, 0},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{10 * time.Minute, 600},
+	}
+	for _, c := range cases {
+		q, err := NewSessionBuilder(nil, KindPySpark).Name("s").HeartbeatTimeout(c.timeout).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Kind != KindPySpark || q.Name != "s" || q.HeartbeatTimeoutInSecond != c.seconds {
+			t.Errorf("HeartbeatTimeout为%s时请求为%+v,应为%d秒", c.timeout, q, c.seconds)
+		}
+	}
+}
+
+func TestBuilderConf(t *testing.T) {
+	b := NewSessionBuilder(nil, KindSpark).
+		DynamicAllocation(2, 20).
+		ShufflePartitions(400).
+		YarnConf("maxAppAttempts", 1).
+		YarnConf("spark.yarn.priority", 3).
+		YarnTags("etl").YarnTags().YarnTags("daily", "team-a").
+		DriverEnv("A", "1").
+		ExecutorEnv("B", "2").
+		Env("TZ", "UTC")
+	q, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"spark.dynamicAllocation.enabled":                 "true",
+		"spark.dynamicAllocation.shuffleTracking.enabled": "true",
+		"spark.dynamicAllocation.minExecutors":            "2",
+		"spark.dynamicAllocation.maxExecutors":            "20",
+		"spark.sql.shuffle.partitions":                    "400",
+		"spark.yarn.maxAppAttempts":                       1,
+		"spark.yarn.priority":                             3,
+		"spark.yarn.tags":                                 "etl,daily,team-a",
+		"spark.yarn.appMasterEnv.A":                       "1",
+		"spark.executorEnv.B":                             "2",
+		"spark.yarn.appMasterEnv.TZ":                      "UTC",
+		"spark.executorEnv.TZ":                            "UTC",
+	}
+	if !reflect.DeepEqual(q.Conf, want) {
+		t.Errorf("Conf为%v,应为%v", q.Conf, want)
+	}
+	//Build返回的Conf是副本,之后的修改不影响已生成的请求
+	b.Conf("spark.executor.instances", "3")
+	if _, ok := q.Conf["spark.executor.instances"]; ok {
+		t.Error("Build之后的修改不应影响已生成的请求")
+	}
+}
+
+func TestBuilderPreset(t *testing.T) {
+	c := NewClient("http://localhost:8998")
+	c.Presets = map[string]Resources{
+		"medium": {ExecutorMemory: 3 * GB, Queue: "etl", Conf: map[string]interface{}{"spark.a": "preset", "spark.b": "preset"}},
+	}
+	//客户端的预设优先于DefaultPresets,之后的设置覆盖预设
+	q, err := NewBatchBuilder(c, "app.jar").
+		Conf("spark.a", "before").
+		Preset("medium").
+		Conf("spark.b", "after").
+		NumExecutors(4).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &NewBatchQuery{
+		File: "app.jar", ExecutorMemory: "3g", NumExecutors: 4, Queue: "etl",
+		Conf: map[string]interface{}{"spark.a": "preset", "spark.b": "after"},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("请求为%+v,应为%+v", q, want)
+	}
+
+	//客户端中没有的预设从DefaultPresets中查找,c可以为nil
+	for _, client := range []*LivyClient{c, nil} {
+		q, err := NewSessionBuilder(client, KindSQL).Preset("small").DriverMemory(512 * MB).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.DriverMemory != "512m" || q.DriverCores != 1 || q.ExecutorMemory != "2g" || q.NumExecutors != 2 {
+			t.Errorf("请求为%+v", q)
+		}
+	}
+
+	//Resources中为零值的字段不覆盖之前的设置
+	q, err = NewBatchBuilder(nil, "app.jar").ExecutorCores(2).Queue("q").Resources(Resources{NumExecutors: 3}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.ExecutorCores != 2 || q.Queue != "q" || q.NumExecutors != 3 {
+		t.Errorf("请求为%+v", q)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	//Build返回第一个未找到的预设
+	_, err := NewSessionBuilder(nil, KindSpark).Preset("huge").Preset("tiny").Preset("small").Build()
+	if err == nil || err.Error() != "未找到资源预设:huge" {
+		t.Errorf("err为%v,应为未找到资源预设:huge", err)
+	}
+
+	_, err = NewBatchBuilder(nil, "app.py").ClassName("Main").ExecutorCores(-1).Jars("").Build()
+	ve := new(ValidationError)
+	if !errors.As(err, &ve) || len(ve.Errors) != 3 {
+		t.Fatalf("err为%v,应为3个字段的ValidationError", err)
+	}
+	fields := []string{}
+	for _, fe := range ve.Errors {
+		fields = append(fields, fe.Field)
+	}
+	for _, field := range []string{"ClassName", "ExecutorCores", "Jars[0]"} {
+		if !strings.Contains(strings.Join(fields, ","), field) {
+			t.Errorf("错误的字段为%v,应包含%s", fields, field)
+		}
+	}
+
+	_, err = NewSessionBuilder(nil, "scala").HeartbeatTimeout(-2 * time.Second).Build()
+	if !errors.As(err, &ve) || len(ve.Errors) != 2 {
+		t.Errorf("err为%v,应为Kind和HeartbeatTimeoutInSecond的错误", err)
+	}
+
+	s, c, _ := newTestClient(t)
+	if _, err := NewBatchBuilder(c, "").Submit(context.Background()); err == nil {
+		t.Error("校验失败时Submit应返回错误")
+	}
+	if _, err := NewSessionBuilder(c, KindSpark).Preset("huge").Submit(context.Background()); err == nil {
+		t.Error("预设不存在时Submit应返回错误")
+	}
+	if n := len(s.Requests()); n != 0 {
+		t.Errorf("出错时不应发送请求,发送了%d个", n)
+	}
+}
+
+func TestBuilderSubmit(t *testing.T) {
+	s, c, _ := newTestClient(t)
+	c.DefaultConf = map[string]interface{}{"spark.a": "default", "spark.b": "default"}
+	batch, err := NewBatchBuilder(c, "app.jar").Conf("spark.b", "batch").Submit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := NewSessionBuilder(c, KindSQL).HeartbeatTimeout(time.Minute).Submit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Client != c || session.Client != c || session.HeartbeatTimeout != time.Minute {
+		t.Errorf("batch为%+v,session为%+v", batch, session)
+	}
+
+	//DefaultConf在提交时合并,请求中的同名配置优先
+	bq, sq := NewBatchQuery{}, NewSessionQuery{}
+	for _, r := range s.Requests() {
+		switch {
+		case r.Method == http.MethodPost && r.Path == "/batches":
+			err = json.Unmarshal(r.Body, &bq)
+		case r.Method == http.MethodPost && r.Path == "/sessions":
+			err = json.Unmarshal(r.Body, &sq)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bq.File != "app.jar" || !reflect.DeepEqual(bq.Conf, map[string]interface{}{"spark.a": "default", "spark.b": "batch"}) {
+		t.Errorf("提交的batch为%+v", bq)
+	}
+	if sq.Kind != KindSQL || sq.HeartbeatTimeoutInSecond != 60 || !reflect.DeepEqual(sq.Conf, c.DefaultConf) {
+		t.Errorf("提交的session为%+v", sq)
+	}
+}
@@ -0,0 +1,30 @@
+package golivyclient
+
+import "time"
+
+//Clock 时钟接口,客户端中所有的轮询,等待和退避都通过它进行
+type Clock interface {
+	//Now 当前时间
+	Now() time.Time
+	//Sleep 阻塞等待一段时间
+	Sleep(d time.Duration)
+	//After 在一段时间后向返回的channel中发送当时的时间
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+//SystemClock 使用系统时间的时钟,为客户端的默认时钟
+var SystemClock Clock = systemClock{}
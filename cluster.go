@@ -0,0 +1,361 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//ClusterID 带集群名称的batch或session ID,文本形式为"集群:ID",如prod:42
+type ClusterID struct {
+	Cluster string
+	ID      int
+}
+
+//ParseClusterID 解析"集群:ID"形式的ID
+func ParseClusterID(s string) (ClusterID, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return ClusterID{}, fmt.Errorf("ID格式错误:%q,应为集群:ID", s)
+	}
+	id, err := strconv.Atoi(s[i+1:])
+	if err != nil || id < 0 {
+		return ClusterID{}, fmt.Errorf("ID格式错误:%q,应为集群:ID", s)
+	}
+	return ClusterID{Cluster: s[:i], ID: id}, nil
+}
+
+func (id ClusterID) String() string {
+	return id.Cluster + ":" + strconv.Itoa(id.ID)
+}
+
+//MarshalText 实现encoding.TextMarshaler
+func (id ClusterID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+//UnmarshalText 实现encoding.TextUnmarshaler
+func (id *ClusterID) UnmarshalText(text []byte) error {
+	v, err := ParseClusterID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = v
+	return nil
+}
+
+//ClusterID 带集群名称的ID,Cluster在通过ClusterRegistry提交或查找时设置
+func (b *Batch) ClusterID() ClusterID {
+	return ClusterID{Cluster: b.Cluster, ID: b.ID}
+}
+
+//ClusterID 带集群名称的ID,Cluster在通过ClusterRegistry提交或查找时设置
+func (b *Session) ClusterID() ClusterID {
+	return ClusterID{Cluster: b.Cluster, ID: b.ID}
+}
+
+//Submission 路由时使用的提交请求信息,由NewBatchQuery或NewSessionQuery得到
+type Submission struct {
+	//Type batch或session
+	Type      string
+	Queue     string
+	ProxyUser string
+	//Tags spark.yarn.tags中逗号分隔的标签
+	Tags           []string
+	DriverMemory   Memory
+	DriverCores    int
+	ExecutorMemory Memory
+	ExecutorCores  int
+	//NumExecutors 请求中没有设置时使用spark.executor.instances
+	NumExecutors int
+	Conf         map[string]interface{}
+}
+
+//BatchSubmission 从batch请求得到路由信息
+func BatchSubmission(q *NewBatchQuery) (*Submission, error) {
+	return newSubmission("batch", q.Queue, q.ProxyUser, q.DriverMemory, q.DriverCores, q.ExecutorMemory, q.ExecutorCores, q.NumExecutors, q.Conf)
+}
+
+//SessionSubmission 从session请求得到路由信息
+func SessionSubmission(q *NewSessionQuery) (*Submission, error) {
+	return newSubmission("session", q.Queue, q.ProxyUser, q.DriverMemory, q.DriverCores, q.ExecutorMemory, q.ExecutorCores, q.NumExecutors, q.Conf)
+}
+
+func newSubmission(typ string, queue string, proxyUser string, driverMemory string, driverCores int, executorMemory string, executorCores int, numExecutors int, conf map[string]interface{}) (*Submission, error) {
+	s := &Submission{
+		Type:          typ,
+		Queue:         queue,
+		ProxyUser:     proxyUser,
+		DriverCores:   driverCores,
+		ExecutorCores: executorCores,
+		NumExecutors:  numExecutors,
+		Conf:          conf,
+	}
+	var err error
+	if driverMemory != "" {
+		s.DriverMemory, err = ParseMemory(driverMemory)
+		if err != nil {
+			return nil, fmt.Errorf("DriverMemory:%w", err)
+		}
+	}
+	if executorMemory != "" {
+		s.ExecutorMemory, err = ParseMemory(executorMemory)
+		if err != nil {
+			return nil, fmt.Errorf("ExecutorMemory:%w", err)
+		}
+	}
+	if s.NumExecutors == 0 {
+		if n, err := strconv.Atoi(fmt.Sprint(conf["spark.executor.instances"])); err == nil {
+			s.NumExecutors = n
+		}
+	}
+	if tags, ok := conf["spark.yarn.tags"].(string); ok {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				s.Tags = append(s.Tags, tag)
+			}
+		}
+	}
+	return s, nil
+}
+
+//TotalMemory driver和所有executor的内存之和
+func (s *Submission) TotalMemory() Memory {
+	return s.DriverMemory + s.ExecutorMemory*Memory(s.NumExecutors)
+}
+
+//TotalCores driver和所有executor的cpu核数之和
+func (s *Submission) TotalCores() int {
+	return s.DriverCores + s.ExecutorCores*s.NumExecutors
+}
+
+//HasTag 是否带有标签
+func (s *Submission) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+//Rule 路由规则,所有设置了的条件都满足时提交到Cluster
+type Rule struct {
+	Cluster string
+	//Type batch或session,为空时匹配两者
+	Type string
+	//Queue 队列,可以使用path.Match的通配符,如"etl-*"
+	Queue string
+	//ProxyUser 代理用户,可以使用path.Match的通配符
+	ProxyUser string
+	//Tags 请求需要带有所有这些标签
+	Tags []string
+	//MinMemory和MaxMemory TotalMemory的范围,为0时不限制
+	MinMemory Memory
+	MaxMemory Memory
+	//MinCores和MaxCores TotalCores的范围,为0时不限制
+	MinCores int
+	MaxCores int
+	//Match 自定义条件,为nil时不使用
+	Match func(s *Submission) bool
+}
+
+//Matches 请求是否满足规则
+func (r *Rule) Matches(s *Submission) bool {
+	if r.Type != "" && r.Type != s.Type {
+		return false
+	}
+	if r.Queue != "" && !globMatch(r.Queue, s.Queue) {
+		return false
+	}
+	if r.ProxyUser != "" && !globMatch(r.ProxyUser, s.ProxyUser) {
+		return false
+	}
+	for _, tag := range r.Tags {
+		if !s.HasTag(tag) {
+			return false
+		}
+	}
+	if r.MinMemory > 0 && s.TotalMemory() < r.MinMemory {
+		return false
+	}
+	if r.MaxMemory > 0 && s.TotalMemory() > r.MaxMemory {
+		return false
+	}
+	if r.MinCores > 0 && s.TotalCores() < r.MinCores {
+		return false
+	}
+	if r.MaxCores > 0 && s.TotalCores() > r.MaxCores {
+		return false
+	}
+	return r.Match == nil || r.Match(s)
+}
+
+func globMatch(pattern string, value string) bool {
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
+
+//ClusterRegistry 多个命名的livy集群,按规则选择提交的集群
+type ClusterRegistry struct {
+	//Default 没有规则匹配时使用的集群,为空时返回错误
+	Default string
+
+	mu       sync.RWMutex
+	clusters map[string]*LivyClient
+	rules    []Rule
+}
+
+//NewClusterRegistry 创建ClusterRegistry
+func NewClusterRegistry() *ClusterRegistry {
+	r := new(ClusterRegistry)
+	r.clusters = map[string]*LivyClient{}
+	return r
+}
+
+//Register 注册集群,名称不能为空或包含冒号,同名的集群会被替换
+func (r *ClusterRegistry) Register(name string, c *LivyClient) error {
+	if name == "" || strings.Contains(name, ":") {
+		return fmt.Errorf("集群名称不能为空或包含冒号:%q", name)
+	}
+	if c == nil {
+		return errors.New("集群的客户端不能为nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clusters[name] = c
+	return nil
+}
+
+//Client 获取集群的客户端
+func (r *ClusterRegistry) Client(name string) (*LivyClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("未注册的集群:%s", name)
+	}
+	return c, nil
+}
+
+//Names 所有集群的名称,按名称排序
+func (r *ClusterRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.clusters))
+	for name := range r.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//AddRule 添加路由规则,规则按添加的顺序匹配,第一个匹配的规则生效
+func (r *ClusterRegistry) AddRule(rules ...Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rules...)
+}
+
+//Route 选择提交的集群
+func (r *ClusterRegistry) Route(s *Submission) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := range r.rules {
+		if r.rules[i].Matches(s) {
+			return r.rules[i].Cluster, nil
+		}
+	}
+	if r.Default == "" {
+		return "", fmt.Errorf("没有匹配的路由规则:queue=%s,proxyUser=%s,tags=%s", s.Queue, s.ProxyUser, strings.Join(s.Tags, ","))
+	}
+	return r.Default, nil
+}
+
+//route 选择集群并返回其客户端
+func (r *ClusterRegistry) route(s *Submission) (string, *LivyClient, error) {
+	name, err := r.Route(s)
+	if err != nil {
+		return "", nil, err
+	}
+	c, err := r.Client(name)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, c, nil
+}
+
+//SubmitBatch 按规则选择集群并提交batch,返回的Batch的Cluster为所选的集群
+func (r *ClusterRegistry) SubmitBatch(ctx context.Context, q *NewBatchQuery) (*Batch, error) {
+	s, err := BatchSubmission(q)
+	if err != nil {
+		return nil, err
+	}
+	name, c, err := r.route(s)
+	if err != nil {
+		return nil, err
+	}
+	b := NewBatch(c)
+	b.Cluster = name
+	err = b.NewWithContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("集群%s:%w", name, err)
+	}
+	return b, nil
+}
+
+//SubmitSession 按规则选择集群并创建session,返回的Session的Cluster为所选的集群
+func (r *ClusterRegistry) SubmitSession(ctx context.Context, q *NewSessionQuery) (*Session, error) {
+	s, err := SessionSubmission(q)
+	if err != nil {
+		return nil, err
+	}
+	name, c, err := r.route(s)
+	if err != nil {
+		return nil, err
+	}
+	b := NewSession(c)
+	b.Cluster = name
+	err = b.NewWithContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("集群%s:%w", name, err)
+	}
+	return b, nil
+}
+
+//Batch 按带集群名称的ID查找batch,并从livy获取最新的状态
+func (r *ClusterRegistry) Batch(ctx context.Context, id ClusterID) (*Batch, error) {
+	c, err := r.Client(id.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	b := NewBatch(c)
+	b.Cluster = id.Cluster
+	b.ID = id.ID
+	_, err = b.update(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+//Session 按带集群名称的ID查找session,并从livy获取最新的状态
+func (r *ClusterRegistry) Session(ctx context.Context, id ClusterID) (*Session, error) {
+	c, err := r.Client(id.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	b := NewSession(c)
+	b.Cluster = id.Cluster
+	b.ID = id.ID
+	_, err = b.update(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,296 @@
+package golivyclient
+
+import (
+	"context"
+	jsonl "encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golivyclient/livytest"
+)
+
+func TestParseClusterID(t *testing.T) {
+	cases := []struct {
+		s    string
+		want ClusterID
+	}{
+		{"prod:42", ClusterID{"prod", 42}},
+		{"prod:0", ClusterID{"prod", 0}},
+		//集群名称中的冒号以最后一个为准
+		{"a:b:7", ClusterID{"a:b", 7}},
+	}
+	for _, c := range cases {
+		id, err := ParseClusterID(c.s)
+		if err != nil || id != c.want {
+			t.Errorf("ParseClusterID(%q)为%v,%v,应为%v", c.s, id, err, c.want)
+		}
+		if id.String() != c.s {
+			t.Errorf("%v的String为%s,应为%s", id, id.String(), c.s)
+		}
+	}
+	for _, s := range []string{"", "42", ":1", "prod:", "prod:x", "prod:-1", "prod 42"} {
+		if _, err := ParseClusterID(s); err == nil {
+			t.Errorf("ParseClusterID(%q)应返回错误", s)
+		}
+	}
+}
+
+func TestClusterIDText(t *testing.T) {
+	v := struct {
+		ID  ClusterID            `json:"id"`
+		IDs map[ClusterID]string `json:"ids"`
+	}{ClusterID{"prod", 42}, map[ClusterID]string{{"dev", 1}: "x"}}
+	bs, err := jsonl.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != `{"id":"prod:42","ids":{"dev:1":"x"}}` {
+		t.Errorf("json为%s", bs)
+	}
+	v.ID, v.IDs = ClusterID{}, nil
+	err = jsonl.Unmarshal(bs, &v)
+	if err != nil || v.ID != (ClusterID{"prod", 42}) || v.IDs[ClusterID{"dev", 1}] != "x" {
+		t.Errorf("解析后为%+v,err为%v", v, err)
+	}
+	if err := jsonl.Unmarshal([]byte(`{"id":"prod"}`), &v); err == nil {
+		t.Error("格式错误时应返回错误")
+	}
+}
+
+func TestSubmission(t *testing.T) {
+	s, err := BatchSubmission(&NewBatchQuery{
+		File: "app.jar", Queue: "etl", ProxyUser: "alice",
+		DriverMemory: "2g", DriverCores: 2, ExecutorMemory: "512m", ExecutorCores: 3,
+		Conf: map[string]interface{}{"spark.executor.instances": "4", "spark.yarn.tags": "daily, team-a,,"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != "batch" || s.Queue != "etl" || s.ProxyUser != "alice" || s.NumExecutors != 4 {
+		t.Errorf("路由信息为%+v", s)
+	}
+	if !reflect.DeepEqual(s.Tags, []string{"daily", "team-a"}) || !s.HasTag("team-a") || s.HasTag("team") {
+		t.Errorf("Tags为%q", s.Tags)
+	}
+	if s.TotalMemory() != 4*GB || s.TotalCores() != 14 {
+		t.Errorf("TotalMemory为%s,TotalCores为%d,应为4g和14", s.TotalMemory(), s.TotalCores())
+	}
+
+	//请求中的NumExecutors优先于spark.executor.instances
+	s, err = SessionSubmission(&NewSessionQuery{NumExecutors: 2, Conf: map[string]interface{}{"spark.executor.instances": 8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != "session" || s.NumExecutors != 2 || s.Tags != nil || s.TotalMemory() != 0 {
+		t.Errorf("路由信息为%+v", s)
+	}
+
+	if _, err := BatchSubmission(&NewBatchQuery{DriverMemory: "2x"}); err == nil || !strings.HasPrefix(err.Error(), "DriverMemory:") {
+		t.Errorf("err为%v,应为DriverMemory的错误", err)
+	}
+	if _, err := SessionSubmission(&NewSessionQuery{ExecutorMemory: "lots"}); err == nil || !strings.HasPrefix(err.Error(), "ExecutorMemory:") {
+		t.Errorf("err为%v,应为ExecutorMemory的错误", err)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	s := &Submission{
+		Type: "batch", Queue: "etl-daily", ProxyUser: "alice", Tags: []string{"a", "b"},
+		DriverMemory: GB, DriverCores: 1, ExecutorMemory: GB, ExecutorCores: 1, NumExecutors: 3,
+	}
+	cases := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{"没有条件", Rule{}, true},
+		{"类型", Rule{Type: "batch"}, true},
+		{"类型不同", Rule{Type: "session"}, false},
+		{"队列通配符", Rule{Queue: "etl-*"}, true},
+		{"队列不同", Rule{Queue: "adhoc"}, false},
+		{"非法的通配符", Rule{Queue: "etl-["}, false},
+		{"用户", Rule{ProxyUser: "a*"}, true},
+		{"用户不同", Rule{ProxyUser: "bob"}, false},
+		{"所有标签", Rule{Tags: []string{"b", "a"}}, true},
+		{"缺少标签", Rule{Tags: []string{"a", "c"}}, false},
+		{"内存范围", Rule{MinMemory: 4 * GB, MaxMemory: 4 * GB}, true},
+		{"内存不足", Rule{MinMemory: 5 * GB}, false},
+		{"内存过多", Rule{MaxMemory: 3 * GB}, false},
+		{"核数范围", Rule{MinCores: 4, MaxCores: 4}, true},
+		{"核数不足", Rule{MinCores: 5}, false},
+		{"核数过多", Rule{MaxCores: 3}, false},
+		{"自定义条件", Rule{Match: func(s *Submission) bool { return s.NumExecutors == 3 }}, true},
+		{"自定义条件不满足", Rule{Queue: "etl-*", Match: func(s *Submission) bool { return false }}, false},
+	}
+	for _, c := range cases {
+		if got := c.rule.Matches(s); got != c.want {
+			t.Errorf("%s:Matches为%v,应为%v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestClusterRegistry(t *testing.T) {
+	r := NewClusterRegistry()
+	prod, dev := NewClient("http://prod:8998"), NewClient("http://dev:8998")
+	for _, name := range []string{"", "a:b"} {
+		if err := r.Register(name, prod); err == nil {
+			t.Errorf("集群名称为%q时应返回错误", name)
+		}
+	}
+	if err := r.Register("prod", nil); err == nil {
+		t.Error("客户端为nil时应返回错误")
+	}
+	for name, c := range map[string]*LivyClient{"prod": dev, "dev": dev} {
+		if err := r.Register(name, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//同名的集群会被替换
+	if err := r.Register("prod", prod); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := r.Client("prod"); err != nil || c != prod {
+		t.Errorf("prod的客户端为%v,err为%v", c, err)
+	}
+	if _, err := r.Client("test"); err == nil {
+		t.Error("未注册的集群应返回错误")
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"dev", "prod"}) {
+		t.Errorf("Names为%v", names)
+	}
+
+	r.AddRule(Rule{Cluster: "dev", ProxyUser: "test-*"})
+	r.AddRule(Rule{Cluster: "prod", Queue: "etl"}, Rule{Cluster: "dev", Queue: "etl"})
+	cases := []struct {
+		s    Submission
+		want string
+	}{
+		{Submission{Queue: "etl", ProxyUser: "alice"}, "prod"},
+		//第一个匹配的规则生效
+		{Submission{Queue: "etl", ProxyUser: "test-bob"}, "dev"},
+	}
+	for _, c := range cases {
+		if got, err := r.Route(&c.s); err != nil || got != c.want {
+			t.Errorf("%+v路由到%s,err为%v,应为%s", c.s, got, err, c.want)
+		}
+	}
+	if _, err := r.Route(&Submission{Queue: "adhoc"}); err == nil || !strings.Contains(err.Error(), "queue=adhoc") {
+		t.Errorf("没有匹配的规则且没有Default时应返回错误,err为%v", err)
+	}
+	r.Default = "dev"
+	if got, err := r.Route(&Submission{Queue: "adhoc"}); err != nil || got != "dev" {
+		t.Errorf("没有匹配的规则时应使用Default,路由到%s,err为%v", got, err)
+	}
+}
+
+//newTestRegistry 注册两个假服务作为prod和dev集群,queue为etl的请求提交到prod
+func newTestRegistry(t *testing.T) (*ClusterRegistry, map[string]*livytest.Server) {
+	t.Helper()
+	r := NewClusterRegistry()
+	servers := map[string]*livytest.Server{}
+	for _, name := range []string{"prod", "dev"} {
+		s, c, _ := newTestClient(t)
+		servers[name] = s
+		if err := r.Register(name, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.AddRule(Rule{Cluster: "prod", Queue: "etl"}, Rule{Cluster: "test", Queue: "test"})
+	r.Default = "dev"
+	return r, servers
+}
+
+func TestClusterRegistrySubmit(t *testing.T) {
+	r, servers := newTestRegistry(t)
+	ctx := context.Background()
+	b, err := r.SubmitBatch(ctx, &NewBatchQuery{File: "app.jar", Queue: "etl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.SubmitSession(ctx, &NewSessionQuery{Kind: KindSQL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ClusterID() != (ClusterID{"prod", 0}) || s.ClusterID() != (ClusterID{"dev", 0}) {
+		t.Errorf("batch为%v,session为%v,应为prod:0和dev:0", b.ClusterID(), s.ClusterID())
+	}
+	if countRequests(servers["prod"], http.MethodPost, "/batches") != 1 || countRequests(servers["dev"], http.MethodPost, "/sessions") != 1 {
+		t.Error("batch应提交到prod,session应提交到dev")
+	}
+
+	//按ID查找时从对应的集群获取状态
+	found, err := r.Batch(ctx, b.ClusterID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Cluster != "prod" || found.ID != 0 || found.State != servers["prod"].BatchStates[1] {
+		t.Errorf("找到的batch为%+v", found)
+	}
+	fs, err := r.Session(ctx, s.ClusterID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Cluster != "dev" || fs.State != servers["dev"].SessionStates[1] {
+		t.Errorf("找到的session为%+v", fs)
+	}
+	for _, id := range []ClusterID{{"test", 0}, {"prod", 9}} {
+		if _, err := r.Batch(ctx, id); err == nil {
+			t.Errorf("查找batch %v时应返回错误", id)
+		}
+		if _, err := r.Session(ctx, id); err == nil {
+			t.Errorf("查找session %v时应返回错误", id)
+		}
+	}
+}
+
+func TestClusterRegistrySubmitErrors(t *testing.T) {
+	r, servers := newTestRegistry(t)
+	ctx := context.Background()
+	//规则指向未注册的集群
+	if _, err := r.SubmitBatch(ctx, &NewBatchQuery{File: "app.jar", Queue: "test"}); err == nil || !strings.Contains(err.Error(), "未注册的集群") {
+		t.Errorf("err为%v,应为未注册的集群", err)
+	}
+	if _, err := r.SubmitSession(ctx, &NewSessionQuery{DriverMemory: "2x"}); err == nil {
+		t.Error("内存格式错误时应返回错误")
+	}
+	servers["prod"].InjectFailure(livytest.Failure{Path: "/sessions", Status: http.StatusInternalServerError})
+	_, err := r.SubmitSession(ctx, &NewSessionQuery{Kind: KindSQL, Queue: "etl"})
+	if err == nil || !strings.HasPrefix(err.Error(), "集群prod:") {
+		t.Errorf("err为%v,应带有集群名称", err)
+	}
+	for name, s := range servers {
+		if n := countRequests(s, http.MethodPost, "/batches"); n != 0 {
+			t.Errorf("%s收到了%d个batch请求", name, n)
+		}
+	}
+}
+
+func TestClusterRegistryConcurrent(t *testing.T) {
+	r := NewClusterRegistry()
+	r.Default = "c0"
+	c := NewClient("http://localhost:8998")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("c%d", i)
+			if err := r.Register(name, c); err != nil {
+				t.Error(err)
+			}
+			r.AddRule(Rule{Cluster: name, Queue: name})
+			if got, err := r.Route(&Submission{Queue: name}); err != nil || got != name {
+				t.Errorf("%s路由到%s,err为%v", name, got, err)
+			}
+			r.Names()
+		}(i)
+	}
+	wg.Wait()
+	if n := len(r.Names()); n != 8 {
+		t.Errorf("注册了%d个集群,应为8个", n)
+	}
+}
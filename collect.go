@@ -0,0 +1,275 @@
+package golivyclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+//DefaultPageSize Collect的pageSize为0时每页的行数
+var DefaultPageSize = 1000
+
+//collectIndexColumn Collect为缓存的DataFrame添加的行号列
+const collectIndexColumn = "__livy_row"
+
+//collectPartitionColumn sql和sparkr缓存源数据时添加的monotonically_increasing_id列
+const collectPartitionColumn = "__livy_mid"
+
+//collectSetup pyspark和spark缓存DataFrame并注册为带行号的临时视图的代码,参数依次为表达式和视图名
+//
+//行号由zipWithIndex生成,不需要把数据移到一个分区中
+var collectSetup = map[string]string{
+	KindPySpark: `from pyspark.sql.types import StructType as __livy_StructType, StructField as __livy_StructField, LongType as __livy_LongType
+__livy_df = (%s)
+spark.createDataFrame(
+    __livy_df.rdd.zipWithIndex().map(lambda r: tuple(r[0]) + (r[1],)),
+    __livy_StructType(__livy_df.schema.fields + [__livy_StructField("` + collectIndexColumn + `", __livy_LongType(), False)]),
+).cache().createOrReplaceTempView("%s")
+del __livy_df`,
+	KindSpark: `{
+  val __livy_df = (%s)
+  val __livy_rows = __livy_df.rdd.zipWithIndex.map { case (r, i) => org.apache.spark.sql.Row.fromSeq(r.toSeq :+ i) }
+  spark.createDataFrame(__livy_rows, __livy_df.schema.add("` + collectIndexColumn + `", org.apache.spark.sql.types.LongType, false)).cache().createOrReplaceTempView("%s")
+}`,
+}
+
+//collectSQL sql和sparkr使用的建立行号的sql语句,from为数据源
+//
+//monotonically_increasing_id的高31位为分区号,低33位为分区内的序号;
+//先缓存带该列的源数据,再按分区统计行数得到每个分区的起始行号,
+//窗口函数只作用于每个分区一行的统计结果,数据本身不会被移到一个分区中
+func collectSQL(view string, from string) []string {
+	src := view + "_src"
+	return []string{
+		fmt.Sprintf("CACHE TABLE %s AS SELECT *, monotonically_increasing_id() AS `%s` FROM %s", src, collectPartitionColumn, from),
+		fmt.Sprintf("CACHE TABLE %[1]s AS SELECT s.*, o.start + (s.`%[3]s` & 8589934591) AS `%[4]s` FROM %[2]s s JOIN ("+
+			"SELECT pid, coalesce(sum(n) OVER (ORDER BY pid ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING), 0) AS start "+
+			"FROM (SELECT shiftright(`%[3]s`, 33) AS pid, count(*) AS n FROM %[2]s GROUP BY shiftright(`%[3]s`, 33)) c"+
+			") o ON shiftright(s.`%[3]s`, 33) = o.pid",
+			view, src, collectPartitionColumn, collectIndexColumn),
+	}
+}
+
+//collectSetupCode 缓存结果并建立带行号的视图的statement
+func collectSetupCode(kind string, expr string, view string) ([]*NewStatementQuery, error) {
+	switch kind {
+	case KindPySpark, KindSpark:
+		return []*NewStatementQuery{{Code: fmt.Sprintf(collectSetup[kind], expr, view), Kind: kind}}, nil
+	case KindSQL:
+		qs := []*NewStatementQuery{}
+		for _, stmt := range collectSQL(view, "("+expr+") __livy_in") {
+			qs = append(qs, &NewStatementQuery{Code: stmt, Kind: KindSQL})
+		}
+		return qs, nil
+	case KindSparkR:
+		code := fmt.Sprintf("local({\n  createOrReplaceTempView((%s), \"%s_in\")\n", expr, view)
+		for _, stmt := range collectSQL(view, view+"_in") {
+			lit, err := Literal(KindSparkR, stmt)
+			if err != nil {
+				return nil, err
+			}
+			code += "  sql(" + lit + ")\n"
+		}
+		code += "  invisible(NULL)\n})"
+		return []*NewStatementQuery{{Code: code, Kind: KindSparkR}}, nil
+	}
+	return nil, fmt.Errorf("session的kind为%s,不支持Collect", kind)
+}
+
+//RowIterator Collect返回的分页结果的迭代器,用法与sql.Rows相同,使用结束后必须调用Close释放缓存
+type RowIterator struct {
+	session  *Session
+	ctx      context.Context
+	view     string
+	pageSize int
+	total    int64
+	offset   int64
+	columns  []TableColumn
+	page     [][]interface{}
+	cur      int
+	width    int
+	row      []interface{}
+	err      error
+	closed   bool
+	//keep 结果中除行号等辅助列以外的列的位置
+	keep []int
+}
+
+//Collect 将dataframeExpr的结果缓存在session中,并以sql类型的statement按页获取,避免一次输出过大的结果
+//
+//dataframeExpr为session的Kind对应语言的DataFrame表达式,Kind为sql时为查询语句;
+//pageSize为每页的行数,为0时使用DefaultPageSize。ctx用于之后所有分页的请求
+func (b *Session) Collect(ctx context.Context, dataframeExpr string, pageSize int) (*RowIterator, error) {
+	if pageSize < 0 {
+		return nil, fmt.Errorf("pageSize必须为非负数")
+	}
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	suffix := make([]byte, 8)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return nil, err
+	}
+	it := new(RowIterator)
+	it.session = b
+	it.ctx = ctx
+	it.view = "livy_collect_" + hex.EncodeToString(suffix)
+	it.pageSize = pageSize
+	setup, err := collectSetupCode(b.Kind, dataframeExpr, it.view)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range setup {
+		_, err = b.Run(ctx, q)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+	}
+	count := struct {
+		N int64 `livy:"n"`
+	}{}
+	err = b.Query(ctx, fmt.Sprintf("SELECT count(*) AS n FROM %s", it.view), &count)
+	if err != nil {
+		it.Close()
+		return nil, err
+	}
+	it.total = count.N
+	//先取第一页以获得结果的列
+	err = it.fetch()
+	if err != nil {
+		it.Close()
+		return nil, err
+	}
+	return it, nil
+}
+
+//fetch 获取下一页
+func (it *RowIterator) fetch() error {
+	st, err := it.session.Run(it.ctx, &NewStatementQuery{
+		Code: fmt.Sprintf("SELECT * FROM %s WHERE `%s` >= %d AND `%s` < %d ORDER BY `%s`",
+			it.view, collectIndexColumn, it.offset, collectIndexColumn, it.offset+int64(it.pageSize), collectIndexColumn),
+		Kind: KindSQL,
+	})
+	if err != nil {
+		return err
+	}
+	table, err := st.Table()
+	if err != nil {
+		return err
+	}
+	if it.keep == nil {
+		found := false
+		it.keep = []int{}
+		for i, col := range table.Columns {
+			switch col.Name {
+			case collectIndexColumn:
+				found = true
+			case collectPartitionColumn:
+			default:
+				it.keep = append(it.keep, i)
+				it.columns = append(it.columns, col)
+			}
+		}
+		if !found {
+			return fmt.Errorf("分页结果中没有%s列", collectIndexColumn)
+		}
+	}
+	//livy的sql结果最多返回livy.rsc.sql.num-rows行,按实际返回的行数前进
+	if len(table.Rows) == 0 && it.offset < it.total {
+		return fmt.Errorf("第%d行之后的分页没有返回数据,共%d行", it.offset, it.total)
+	}
+	it.width = len(table.Columns)
+	it.page = table.Rows
+	it.cur = 0
+	it.offset += int64(len(table.Rows))
+	return nil
+}
+
+//Total 结果的总行数
+func (it *RowIterator) Total() int64 {
+	return it.total
+}
+
+//Columns 结果的列
+func (it *RowIterator) Columns() []TableColumn {
+	return it.columns
+}
+
+//Next 移动到下一行,没有更多的行或出错时返回false,出错时可以通过Err获取错误
+func (it *RowIterator) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	for it.cur >= len(it.page) {
+		if it.offset >= it.total {
+			it.row = nil
+			return false
+		}
+		it.err = it.fetch()
+		if it.err != nil {
+			it.row = nil
+			return false
+		}
+	}
+	raw := it.page[it.cur]
+	it.cur++
+	if len(raw) != it.width {
+		it.err = fmt.Errorf("结果有%d列,但该行有%d个值", it.width, len(raw))
+		return false
+	}
+	it.row = make([]interface{}, len(it.keep))
+	for i, j := range it.keep {
+		it.row[i] = raw[j]
+	}
+	return true
+}
+
+//Row 当前行的值,数字为json.Number,可以通过TableColumn.Value转换
+func (it *RowIterator) Row() []interface{} {
+	return it.row
+}
+
+//Scan 将当前行扫描到结构体指针dest中,见TableResult.Scan
+func (it *RowIterator) Scan(dest interface{}) error {
+	if it.row == nil {
+		return io.EOF
+	}
+	table := TableResult{Columns: it.columns, Rows: [][]interface{}{it.row}}
+	return table.Scan(dest)
+}
+
+//Err 迭代过程中的错误
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+//Close 释放session中缓存的结果,可以重复调用;某一步清理失败时仍会执行其余的步骤,返回第一个错误
+func (it *RowIterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	it.page = nil
+	it.row = nil
+	ctx := context.Background()
+	cleanup := []string{"UNCACHE TABLE IF EXISTS " + it.view, "DROP VIEW IF EXISTS " + it.view}
+	switch it.session.Kind {
+	case KindSQL, KindSparkR:
+		cleanup = append(cleanup, "UNCACHE TABLE IF EXISTS "+it.view+"_src", "DROP VIEW IF EXISTS "+it.view+"_src")
+		if it.session.Kind == KindSparkR {
+			cleanup = append(cleanup, "DROP VIEW IF EXISTS "+it.view+"_in")
+		}
+	}
+	var first error
+	for _, code := range cleanup {
+		_, err := it.session.Run(ctx, &NewStatementQuery{Code: code, Kind: KindSQL})
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
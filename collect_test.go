@@ -0,0 +1,147 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golivyclient/livytest"
+)
+
+var pageQuery = regexp.MustCompile("`__livy_row` >= (\\d+) AND `__livy_row` < (\\d+)")
+
+//fakeCollect 模拟sql类型的session中有total行的结果,每个statement最多返回SQLRowLimit行
+type fakeCollect struct {
+	total  int
+	server *livytest.Server
+	//failUncache 为true时UNCACHE语句执行失败
+	failUncache bool
+}
+
+func (f *fakeCollect) result(code string) (map[string]interface{}, error) {
+	switch {
+	case strings.HasPrefix(code, "SELECT count(*)"):
+		return map[string]interface{}{JSONMimeType: map[string]interface{}{
+			"schema": map[string]interface{}{"type": "struct", "fields": []interface{}{
+				map[string]interface{}{"name": "n", "type": "long", "nullable": false},
+			}},
+			"data": [][]interface{}{{f.total}},
+		}}, nil
+	case strings.HasPrefix(code, "SELECT * FROM"):
+		m := pageQuery.FindStringSubmatch(code)
+		lo, _ := strconv.Atoi(m[1])
+		hi, _ := strconv.Atoi(m[2])
+		if hi > f.total {
+			hi = f.total
+		}
+		if hi > lo+SQLRowLimit {
+			hi = lo + SQLRowLimit
+		}
+		rows := [][]interface{}{}
+		for i := lo; i < hi; i++ {
+			rows = append(rows, []interface{}{i * 10, i, i})
+		}
+		return map[string]interface{}{JSONMimeType: map[string]interface{}{
+			"schema": map[string]interface{}{"type": "struct", "fields": []interface{}{
+				map[string]interface{}{"name": "v", "type": "long", "nullable": false},
+				map[string]interface{}{"name": collectPartitionColumn, "type": "long", "nullable": false},
+				map[string]interface{}{"name": collectIndexColumn, "type": "long", "nullable": false},
+			}},
+			"data": rows,
+		}}, nil
+	case strings.HasPrefix(code, "UNCACHE") && f.failUncache:
+		return nil, errors.New("uncache failed")
+	}
+	return nil, nil
+}
+
+//submitted 提交的以prefix开头的statement
+func (f *fakeCollect) submitted(prefix string) []string {
+	res := []string{}
+	for _, r := range f.server.Requests() {
+		q := NewStatementQuery{}
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.Path, "/statements") || json.Unmarshal(r.Body, &q) != nil {
+			continue
+		}
+		if strings.HasPrefix(q.Code, prefix) {
+			res = append(res, q.Code)
+		}
+	}
+	return res
+}
+
+func newCollectSession(t *testing.T, f *fakeCollect) *Session {
+	t.Helper()
+	s, b, _ := newTestSession(t, KindSQL)
+	s.StatementStates = []string{"available"}
+	s.StatementResult = f.result
+	f.server = s
+	return b
+}
+
+func TestCollectPagesUnderRowLimit(t *testing.T) {
+	f := &fakeCollect{total: 5432}
+	b := newCollectSession(t, f)
+	it, err := b.Collect(context.Background(), "SELECT v FROM t", 2500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if it.Total() != 5432 {
+		t.Errorf("Total为%d", it.Total())
+	}
+	cols := it.Columns()
+	if len(cols) != 1 || cols[0].Name != "v" {
+		t.Errorf("Columns为%+v,应只有v", cols)
+	}
+	n := 0
+	for it.Next() {
+		row := struct {
+			V int64 `livy:"v"`
+		}{}
+		err := it.Scan(&row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row.V != int64(n*10) {
+			t.Fatalf("第%d行为%d", n, row.V)
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 5432 {
+		t.Errorf("共读取%d行,应为5432行", n)
+	}
+	//每页被截断为SQLRowLimit行,按实际返回的行数翻页
+	if pages := len(f.submitted("SELECT * FROM")); pages != 6 {
+		t.Errorf("请求了%d页,应为6页", pages)
+	}
+}
+
+func TestCollectCloseRunsAllCleanup(t *testing.T) {
+	f := &fakeCollect{total: 3, failUncache: true}
+	b := newCollectSession(t, f)
+	it, err := b.Collect(context.Background(), "SELECT v FROM t", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = it.Close()
+	if err == nil || !strings.Contains(err.Error(), "uncache failed") {
+		t.Errorf("Close返回%v,应返回UNCACHE的错误", err)
+	}
+	if n := len(f.submitted("UNCACHE")); n != 2 {
+		t.Errorf("提交了%d条UNCACHE,应为2条", n)
+	}
+	if n := len(f.submitted("DROP VIEW")); n != 2 {
+		t.Errorf("UNCACHE失败后提交了%d条DROP VIEW,应为2条", n)
+	}
+	if err := it.Close(); err != nil {
+		t.Errorf("重复调用Close返回%v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package golivyclient
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//DefaultHealthPath 健康检查请求的路径
+const DefaultHealthPath = "batches?from=0&size=0"
+
+//Endpoints 高可用部署下的多个livy地址,通过LivyClient.Endpoints启用
+//
+//GET,DELETE等幂等的请求在出错或返回5xx时转到下一个地址,失败的地址在Cooldown内排在最后;
+//POST请求只在连接没有建立时转移,以免重复创建;上传文件的请求不转移
+//
+//没有共享的恢复状态时,每个batch和session只存在于创建它的服务上,不同服务的ID可能重复:
+//New创建的Batch和Session会绑定到创建它的地址,见LivyClient.Endpoints;
+//按ID访问的对象会依次尝试各个地址,第一个没有返回404的地址会被记住
+type Endpoints struct {
+	//URLs livy的地址
+	URLs []string
+	//SharedRecovery livy的恢复状态保存在zookeeper或文件系统中时为true,任何地址都可以处理任何ID,不做粘性路由
+	SharedRecovery bool
+	//Cooldown 地址失败后被降低优先级的时间,为0时使用30秒,按使用它的LivyClient的Clock计时
+	Cooldown time.Duration
+	//HealthPath 健康检查请求的路径,为空时使用DefaultHealthPath
+	HealthPath string
+
+	mu     sync.Mutex
+	next   int
+	failed map[string]time.Time
+	owners map[resourceKey]string
+	clock  Clock
+}
+
+type resourceKey struct {
+	kind string
+	id   int
+}
+
+//NewEndpoints 创建Endpoints
+func NewEndpoints(urls ...string) *Endpoints {
+	e := new(Endpoints)
+	for _, u := range urls {
+		e.URLs = append(e.URLs, strings.TrimSuffix(u, "/"))
+	}
+	return e
+}
+
+//NewClientWithEndpoints 创建使用多个地址的客户端,BASEURL为第一个地址
+func NewClientWithEndpoints(urls ...string) *LivyClient {
+	c := new(LivyClient)
+	c.Endpoints = NewEndpoints(urls...)
+	if len(c.Endpoints.URLs) > 0 {
+		c.BASEURL = c.Endpoints.URLs[0]
+	}
+	return c
+}
+
+func (e *Endpoints) cooldown() time.Duration {
+	if e.Cooldown == 0 {
+		return 30 * time.Second
+	}
+	return e.Cooldown
+}
+
+func (e *Endpoints) healthPath() string {
+	if e.HealthPath == "" {
+		return DefaultHealthPath
+	}
+	return strings.TrimPrefix(e.HealthPath, "/")
+}
+
+//setClock 记录使用Endpoints的客户端的时钟
+func (e *Endpoints) setClock(clock Clock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clock = clock
+}
+
+func (e *Endpoints) nowLocked() time.Time {
+	if e.clock == nil {
+		return SystemClock.Now()
+	}
+	return e.clock.Now()
+}
+
+//Healthy 当前没有处于失败冷却中的地址
+func (e *Endpoints) Healthy() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.nowLocked()
+	res := []string{}
+	for _, u := range e.URLs {
+		if !e.coolingLocked(u, now) {
+			res = append(res, u)
+		}
+	}
+	return res
+}
+
+func (e *Endpoints) coolingLocked(u string, now time.Time) bool {
+	at, ok := e.failed[u]
+	return ok && now.Sub(at) < e.cooldown()
+}
+
+func (e *Endpoints) markFailed(u string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failed == nil {
+		e.failed = map[string]time.Time{}
+	}
+	e.failed[u] = e.nowLocked()
+}
+
+func (e *Endpoints) markHealthy(u string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.failed, u)
+}
+
+//candidates 按轮询顺序排列的地址,冷却中的排在最后
+func (e *Endpoints) candidates() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.nowLocked()
+	n := len(e.URLs)
+	healthy := make([]string, 0, n)
+	cooling := []string{}
+	for i := 0; i < n; i++ {
+		u := e.URLs[(e.next+i)%n]
+		if e.coolingLocked(u, now) {
+			cooling = append(cooling, u)
+		} else {
+			healthy = append(healthy, u)
+		}
+	}
+	if n > 0 {
+		e.next = (e.next + 1) % n
+	}
+	return append(healthy, cooling...)
+}
+
+func (e *Endpoints) owner(key resourceKey) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	u, ok := e.owners[key]
+	return u, ok
+}
+
+func (e *Endpoints) setOwner(key resourceKey, u string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if u == "" {
+		delete(e.owners, key)
+		return
+	}
+	if e.owners == nil {
+		e.owners = map[resourceKey]string{}
+	}
+	e.owners[key] = u
+}
+
+var (
+	resourcePath = regexp.MustCompile(`^/?(batches|sessions)/(\d+)(?:[/?]|$)`)
+	createPath   = regexp.MustCompile(`^/?(batches|sessions)/?$`)
+)
+
+//routeKey context中保存创建请求实际使用的地址
+type routeKey struct{}
+
+//withRoute 在ctx中记录请求实际发往的地址,用于将新建的对象绑定到该地址
+func withRoute(ctx context.Context, route *string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+//shouldFailover 请求失败后是否转到下一个地址
+func shouldFailover(req *Request, resp *Response, err error) bool {
+	if _, ok := req.Body.(*UploadFile); ok {
+		return false
+	}
+	if req.Context != nil && req.Context.Err() != nil {
+		return false
+	}
+	if !idempotent(req.Method) {
+		return err != nil && isDialError(err)
+	}
+	return err != nil || resp.StatusCode >= 500
+}
+
+//wrap 将发往base的请求按路由规则发往各个地址,其他地址的请求不做处理;冷却时间按clock计时
+//
+//每个地址使用请求的浅拷贝,不修改调用方的请求
+func (e *Endpoints) wrap(base string, clock Clock, next RoundTrip) RoundTrip {
+	e.setClock(clock)
+	return func(req *Request) (*Response, error) {
+		if len(e.URLs) == 0 || !strings.HasPrefix(req.URL, base+"/") {
+			return next(req)
+		}
+		path := strings.TrimPrefix(req.URL, base)
+		var key *resourceKey
+		probe := false
+		targets := e.candidates()
+		if m := resourcePath.FindStringSubmatch(path); m != nil && !e.SharedRecovery {
+			id, _ := strconv.Atoi(m[2])
+			key = &resourceKey{kind: m[1], id: id}
+			if u, ok := e.owner(*key); ok {
+				targets = []string{u}
+			} else {
+				probe = true
+			}
+		}
+		var resp *Response
+		var err error
+		for i, u := range targets {
+			r := *req
+			r.URL = u + path
+			resp, err = next(&r)
+			failed := err != nil || resp.StatusCode >= 500
+			if failed {
+				e.markFailed(u)
+			} else {
+				e.markHealthy(u)
+			}
+			last := i == len(targets)-1
+			if probe && !failed && resp.StatusCode == http.StatusNotFound && !last {
+				continue
+			}
+			if failed && !last && shouldFailover(req, resp, err) {
+				continue
+			}
+			if !failed {
+				e.routed(req, resp, path, key, u)
+			}
+			break
+		}
+		return resp, err
+	}
+}
+
+//routed 记录成功的请求所在的地址
+func (e *Endpoints) routed(req *Request, resp *Response, path string, key *resourceKey, u string) {
+	if key != nil {
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			e.setOwner(*key, "")
+		case req.Method == http.MethodDelete && resp.StatusCode < 300 && !strings.Contains(strings.TrimPrefix(path, "/"+key.kind+"/"), "/"):
+			e.setOwner(*key, "")
+		case resp.StatusCode < 300:
+			e.setOwner(*key, u)
+		}
+		return
+	}
+	m := createPath.FindStringSubmatch(path)
+	if m == nil || req.Method != http.MethodPost || resp.StatusCode >= 300 || e.SharedRecovery {
+		return
+	}
+	created := struct {
+		ID *int `json:"id"`
+	}{}
+	if json.Unmarshal(resp.Body, &created) == nil && created.ID != nil {
+		e.setOwner(resourceKey{kind: m[1], id: *created.ID}, u)
+	}
+	if req.Context != nil {
+		if route, ok := req.Context.Value(routeKey{}).(*string); ok {
+			*route = u
+		}
+	}
+}
+
+//CheckHealth 向每个地址发送一次健康检查请求,成功的地址恢复正常,失败的进入冷却;返回失败地址的错误
+func (e *Endpoints) CheckHealth(ctx context.Context, c *LivyClient) map[string]error {
+	e.setClock(c.clock())
+	errs := map[string]error{}
+	for _, u := range e.URLs {
+		_, err := c.Pin(u).query(ctx, http.MethodGet, e.healthPath())
+		if err != nil {
+			e.markFailed(u)
+			errs[u] = err
+			continue
+		}
+		e.markHealthy(u)
+	}
+	return errs
+}
+
+//RunHealthCheck 每隔interval调用一次CheckHealth,直到ctx取消
+func (e *Endpoints) RunHealthCheck(ctx context.Context, c *LivyClient, interval time.Duration) {
+	for {
+		errs := e.CheckHealth(ctx, c)
+		for u, err := range errs {
+			c.logger().Warn("livy endpoint unhealthy", "url", u, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock().After(interval):
+		}
+	}
+}
+
+//Pin 返回只访问地址u的客户端副本,其他设置与c相同
+func (c *LivyClient) Pin(u string) *LivyClient {
+	nc := *c
+	nc.BASEURL = strings.TrimSuffix(u, "/")
+	nc.Endpoints = nil
+	return &nc
+}
+
+//pinRoute 创建对象时准备记录实际使用的地址,返回的函数在创建成功后返回绑定到该地址的客户端
+func (c *LivyClient) pinRoute(ctx context.Context) (context.Context, func() *LivyClient) {
+	if c.Endpoints == nil || c.Endpoints.SharedRecovery || c.API != nil {
+		return ctx, func() *LivyClient { return c }
+	}
+	route := new(string)
+	return withRoute(ctx, route), func() *LivyClient {
+		if *route == "" {
+			return c
+		}
+		return c.Pin(*route)
+	}
+}
@@ -0,0 +1,129 @@
+package golivyclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//newEndpointsClient 创建在多个地址间故障转移且使用假时钟的客户端
+func newEndpointsClient(urls ...string) (*LivyClient, *livytest.FakeClock) {
+	c := NewClientWithEndpoints(urls...)
+	clock := livytest.NewFakeClock(time.Unix(0, 0))
+	c.Clock = clock
+	c.Endpoints.Cooldown = 10 * time.Second
+	return c, clock
+}
+
+func newServers(t *testing.T) (*livytest.Server, *livytest.Server) {
+	t.Helper()
+	a := livytest.NewServer()
+	t.Cleanup(a.Close)
+	b := livytest.NewServer()
+	t.Cleanup(b.Close)
+	return a, b
+}
+
+func TestEndpointsFailoverAndCooldown(t *testing.T) {
+	a, b := newServers(t)
+	a.InjectFailure(livytest.Failure{Method: http.MethodGet, Path: "/batches", Status: http.StatusServiceUnavailable})
+	c, clock := newEndpointsClient(a.URL, b.URL)
+	urls := []string{}
+	c.Use(func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			resp, err := next(req)
+			urls = append(urls, req.URL)
+			return resp, err
+		}
+	})
+	_, err := c.query(context.Background(), http.MethodGet, "batches")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countRequests(a, http.MethodGet, "/batches") != 1 || countRequests(b, http.MethodGet, "/batches") != 1 {
+		t.Errorf("请求应先发往a,失败后转到b")
+	}
+	//转移不修改外层中间件看到的请求
+	if len(urls) != 1 || urls[0] != a.URL+"/batches" {
+		t.Errorf("外层中间件看到的地址为%v", urls)
+	}
+	if healthy := c.Endpoints.Healthy(); len(healthy) != 1 || healthy[0] != b.URL {
+		t.Errorf("Healthy为%v,应只有b", healthy)
+	}
+	clock.Advance(10 * time.Second)
+	if healthy := c.Endpoints.Healthy(); len(healthy) != 2 {
+		t.Errorf("冷却结束后Healthy为%v,应包含所有地址", healthy)
+	}
+}
+
+func TestEndpointsPostNotFailover(t *testing.T) {
+	a, b := newServers(t)
+	a.InjectFailure(livytest.Failure{Method: http.MethodPost, Path: "/batches", Status: http.StatusServiceUnavailable})
+	c, _ := newEndpointsClient(a.URL, b.URL)
+	err := NewBatch(c).New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err == nil {
+		t.Error("POST返回503时应返回错误")
+	}
+	if n := countRequests(b, http.MethodPost, "/batches"); n != 0 {
+		t.Errorf("POST转到了b,请求了%d次", n)
+	}
+}
+
+func TestEndpointsPostFailoverOnDialError(t *testing.T) {
+	down := livytest.NewServer()
+	down.Close()
+	s := livytest.NewServer()
+	defer s.Close()
+	c, _ := newEndpointsClient(down.URL, s.URL)
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//新建的batch绑定到创建它的地址
+	if b.Client.BASEURL != s.URL || b.Client.Endpoints != nil {
+		t.Errorf("batch绑定到了%s", b.Client.BASEURL)
+	}
+	_, err = b.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countRequests(s, http.MethodGet, "/batches/0"); n != 1 {
+		t.Errorf("GET请求了%d次,应为1次", n)
+	}
+}
+
+func TestEndpointsStickyProbe(t *testing.T) {
+	a, b := newServers(t)
+	err := NewBatch(NewClient(b.URL)).New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := newEndpointsClient(a.URL, b.URL)
+	batch := NewBatch(c)
+	for i := 0; i < 3; i++ {
+		_, err := batch.Update()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	//a返回404后转到b,之后的请求只发往b
+	if n := countRequests(a, http.MethodGet, "/batches/0"); n != 1 {
+		t.Errorf("a收到了%d次请求,应为1次", n)
+	}
+	if n := countRequests(b, http.MethodGet, "/batches/0"); n != 3 {
+		t.Errorf("b收到了%d次请求,应为3次", n)
+	}
+	err = batch.Kill()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = batch.Update()
+	if err == nil || !strings.HasPrefix(err.Error(), "未找到资源") {
+		t.Errorf("删除后err为%v,应为未找到资源", err)
+	}
+}
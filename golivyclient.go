@@ -1,8 +1,44 @@
 package golivyclient
 
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
 //LivyClient livy客户端类
 type LivyClient struct {
 	BASEURL string
+	//Clock 轮询等待使用的时钟,为nil时使用SystemClock
+	Clock Clock
+	//HTTPClient 发送请求使用的http客户端,为nil时每次请求使用新的http.Client
+	HTTPClient *http.Client
+	//TLS https连接的证书设置,不为nil时应用到HTTPClient的一个副本上,HTTPClient的Transport需要为nil或*http.Transport
+	TLS *TLSOptions
+	//Endpoints 不为nil时请求在多个地址间故障转移,见Endpoints;
+	//New创建的Batch和Session的Client会被替换为绑定到创建它的地址的副本,见Pin
+	Endpoints *Endpoints
+	//API Batch,Session和Statement实际调用的接口实现,为nil时使用客户端自身的http实现
+	API LivyAPI
+	//Middlewares 请求经过的中间件,先添加的在外层
+	Middlewares []Middleware
+	//Logger 结构化日志,为nil时使用NopLogger
+	Logger Logger
+	//Metrics 指标收集器,为nil时使用NopMetrics
+	Metrics Metrics
+	//TracerProvider 创建span使用的TracerProvider,为nil时使用otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+	//SkipValidation 为true时Batch和Session的New不调用请求的Validate
+	SkipValidation bool
+	//DefaultConf Batch和Session的New时合并到请求Conf中的默认spark配置,请求中的同名配置优先
+	DefaultConf map[string]interface{}
+	//Presets 命名的资源预设,供BatchBuilder和SessionBuilder的Preset使用,未配置的名称使用DefaultPresets
+	Presets map[string]Resources
 }
 
 //NewClient 创建一个新的livy客户端对象
@@ -20,6 +56,87 @@ func (c *LivyClient) Init(baseURL string) {
 	c.BASEURL = baseURL
 }
 
+func (c *LivyClient) clock() Clock {
+	if c.Clock == nil {
+		return SystemClock
+	}
+	return c.Clock
+}
+
+func (c *LivyClient) logger() Logger {
+	if c.Logger == nil {
+		return NopLogger
+	}
+	return c.Logger
+}
+
+func (c *LivyClient) metrics() Metrics {
+	if c.Metrics == nil {
+		return NopMetrics
+	}
+	return c.Metrics
+}
+
+func (c *LivyClient) api() LivyAPI {
+	if c.API == nil {
+		return c
+	}
+	return c.API
+}
+
+func (c *LivyClient) httpClient() *http.Client {
+	if c.TLS != nil {
+		return c.TLS.httpClient(c.HTTPClient, c.clock())
+	}
+	if c.HTTPClient == nil {
+		return &http.Client{}
+	}
+	return c.HTTPClient
+}
+
+//HTTPJSONQuery 使用客户端的HTTPClient和中间件构造http请求
+func (c *LivyClient) HTTPJSONQuery(URL string, Method string, jsonData ...interface{}) ([]byte, error) {
+	return c.do(context.Background(), URL, Method, jsonData...)
+}
+
+func (c *LivyClient) query(ctx context.Context, Method string, path string, jsonData ...interface{}) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s", c.BASEURL, path)
+	return c.do(ctx, url, Method, jsonData...)
+}
+
+func (c *LivyClient) do(ctx context.Context, URL string, Method string, jsonData ...interface{}) (res []byte, err error) {
+	endpoint := endpointOf(c.BASEURL, URL)
+	ctx, span := c.tracer().Start(ctx, fmt.Sprintf("livy %s %s", Method, endpoint),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", Method),
+			attribute.String("url.full", URL),
+		))
+	defer func() {
+		endSpan(span, err)
+	}()
+	req, err := newRequest(ctx, URL, Method, jsonData...)
+	if err != nil {
+		return nil, err
+	}
+	req.clock = c.clock()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	start := c.clock().Now()
+	resp, err := c.roundTrip()(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.metrics().ObserveRequest(Method, endpoint, status, c.clock().Now().Sub(start))
+	if err != nil {
+		c.logger().Warn("livy request error", "method", Method, "url", URL, "err", err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	c.logger().Debug("livy request", "method", Method, "url", URL, "status", resp.StatusCode)
+	return checkResponse(req, resp)
+}
+
 //NewBatch 创建新的Batch
 func (c *LivyClient) NewBatch() *Batch {
 	nb := NewBatch(c)
@@ -0,0 +1,74 @@
+package golivyclient
+
+import (
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//newTestClient 启动livy假服务并创建使用假时钟的客户端,测试结束时关闭服务
+func newTestClient(t *testing.T) (*livytest.Server, *LivyClient, *livytest.FakeClock) {
+	t.Helper()
+	s := livytest.NewServer()
+	t.Cleanup(s.Close)
+	clock := livytest.NewFakeClock(time.Unix(0, 0))
+	c := NewClient(s.URL)
+	c.Clock = clock
+	return s, c, clock
+}
+
+//advanceUntil 被测的goroutine进入等待时把时钟推进step,直到done关闭,返回推进的次数
+func advanceUntil(clock *livytest.FakeClock, step time.Duration, done <-chan struct{}) int {
+	ticks := 0
+	for {
+		select {
+		case <-done:
+			return ticks
+		default:
+		}
+		if clock.Sleepers() > 0 {
+			clock.Advance(step)
+			ticks++
+			continue
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+//runWithClock 在goroutine中执行f,并在它等待时推进时钟,返回推进的次数和f的结果
+func runWithClock(clock *livytest.FakeClock, step time.Duration, f func() error) (int, error) {
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		err = f()
+	}()
+	ticks := advanceUntil(clock, step, done)
+	return ticks, err
+}
+
+//drainWithClock 读取watch的所有消息直到channel关闭,并在watcher等待时推进时钟
+func drainWithClock[T any](clock *livytest.FakeClock, step time.Duration, ch <-chan T) ([]T, int) {
+	done := make(chan struct{})
+	msgs := []T{}
+	go func() {
+		defer close(done)
+		for msg := range ch {
+			msgs = append(msgs, msg)
+		}
+	}()
+	ticks := advanceUntil(clock, step, done)
+	return msgs, ticks
+}
+
+//countRequests 统计假服务收到的某个方法和路径的请求数
+func countRequests(s *livytest.Server, method string, path string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if r.Method == method && r.Path == path {
+			n++
+		}
+	}
+	return n
+}
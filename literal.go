@@ -0,0 +1,535 @@
+package golivyclient
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+//支持生成字面量的代码类型
+const (
+	KindPySpark = "pyspark"
+	KindSpark   = "spark"
+	KindSparkR  = "sparkr"
+	KindSQL     = "sql"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//literalWriter 一种语言的字面量写法
+type literalWriter interface {
+	null() string
+	boolean(v bool) string
+	integer(v int64, bits int) string
+	unsigned(v uint64, bits int) string
+	float(v float64, bits int) (string, error)
+	str(v string) (string, error)
+	time(v time.Time) string
+	list(elems []string, scalar bool) string
+	dict(keys []string, values []string) string
+	//stringKeys map的key是否只能为字符串,为true时其他类型的key会先格式化为字符串
+	stringKeys() bool
+}
+
+func literalWriterOf(kind string) (literalWriter, error) {
+	switch kind {
+	case KindPySpark, "python":
+		return pythonLiteral{}, nil
+	case KindSpark, "scala":
+		return scalaLiteral{}, nil
+	case KindSparkR, "r":
+		return rLiteral{}, nil
+	case KindSQL:
+		return sqlLiteral{}, nil
+	}
+	return nil, fmt.Errorf("不支持生成%s的字面量", kind)
+}
+
+//Literal 将Go的值转为kind对应语言的字面量,kind为pyspark,spark,sparkr或sql
+//
+//支持nil,bool,整数,浮点数,string,[]byte(作为字符串),time.Time,slice,array和map以及它们的指针,
+//map的key按字面量排序以保证生成的代码稳定
+func Literal(kind string, v interface{}) (string, error) {
+	w, err := literalWriterOf(kind)
+	if err != nil {
+		return "", err
+	}
+	return writeLiteral(w, reflect.ValueOf(v))
+}
+
+func writeLiteral(w literalWriter, v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return w.null(), nil
+	}
+	if v.Type() == timeType {
+		return w.time(v.Interface().(time.Time)), nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return w.null(), nil
+		}
+		return writeLiteral(w, v.Elem())
+	case reflect.Bool:
+		return w.boolean(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return w.integer(v.Int(), v.Type().Bits()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return w.unsigned(v.Uint(), v.Type().Bits()), nil
+	case reflect.Float32, reflect.Float64:
+		return w.float(v.Float(), v.Type().Bits())
+	case reflect.String:
+		return w.str(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return w.null(), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			bs := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(bs), v)
+			return w.str(string(bs))
+		}
+		elems := make([]string, v.Len())
+		for i := range elems {
+			ele, err := writeLiteral(w, v.Index(i))
+			if err != nil {
+				return "", fmt.Errorf("[%d]:%w", i, err)
+			}
+			elems[i] = ele
+		}
+		return w.list(elems, isScalar(v.Type().Elem())), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return w.null(), nil
+		}
+		type entry struct {
+			key   string
+			value string
+		}
+		entries := []entry{}
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key()
+			if w.stringKeys() && k.Kind() != reflect.String {
+				k = reflect.ValueOf(fmt.Sprint(k.Interface()))
+			}
+			key, err := writeLiteral(w, k)
+			if err != nil {
+				return "", fmt.Errorf("key %v:%w", iter.Key(), err)
+			}
+			value, err := writeLiteral(w, iter.Value())
+			if err != nil {
+				return "", fmt.Errorf("[%v]:%w", iter.Key(), err)
+			}
+			entries = append(entries, entry{key, value})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+		keys := make([]string, len(entries))
+		values := make([]string, len(entries))
+		for i, e := range entries {
+			keys[i] = e.key
+			values[i] = e.value
+		}
+		return w.dict(keys, values), nil
+	}
+	return "", fmt.Errorf("不支持将%s类型转为字面量", v.Type())
+}
+
+func isScalar(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+//quote 用双引号包裹字符串,escape返回字符需要的转义,返回空字符串时原样输出
+func quote(v string, q byte, escape func(r rune) (string, error)) (string, error) {
+	if !utf8.ValidString(v) {
+		return "", fmt.Errorf("字符串不是合法的utf8:%q", v)
+	}
+	var sb strings.Builder
+	sb.WriteByte(q)
+	for _, r := range v {
+		e, err := escape(r)
+		if err != nil {
+			return "", err
+		}
+		if e != "" {
+			sb.WriteString(e)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte(q)
+	return sb.String(), nil
+}
+
+//isPlain 可以直接写在字符串字面量中的字符
+func isPlain(r rune) bool {
+	return r >= 0x20 && r < 0x7f || r > 0xa0 && strconv.IsPrint(r)
+}
+
+func formatFloat(v float64, bits int) string {
+	s := strconv.FormatFloat(v, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+type pythonLiteral struct{}
+
+func (pythonLiteral) null() string { return "None" }
+
+func (pythonLiteral) boolean(v bool) string {
+	if v {
+		return "True"
+	}
+	return "False"
+}
+
+func (pythonLiteral) integer(v int64, bits int) string { return strconv.FormatInt(v, 10) }
+
+func (pythonLiteral) unsigned(v uint64, bits int) string { return strconv.FormatUint(v, 10) }
+
+func (pythonLiteral) float(v float64, bits int) (string, error) {
+	switch {
+	case math.IsNaN(v):
+		return `float("nan")`, nil
+	case math.IsInf(v, 1):
+		return `float("inf")`, nil
+	case math.IsInf(v, -1):
+		return `float("-inf")`, nil
+	}
+	return formatFloat(v, bits), nil
+}
+
+func (pythonLiteral) str(v string) (string, error) {
+	return quote(v, '"', func(r rune) (string, error) {
+		switch r {
+		case '"', '\\':
+			return `\` + string(r), nil
+		case '\n':
+			return `\n`, nil
+		case '\r':
+			return `\r`, nil
+		case '\t':
+			return `\t`, nil
+		}
+		switch {
+		case isPlain(r):
+			return "", nil
+		case r <= 0xff:
+			return fmt.Sprintf(`\x%02x`, r), nil
+		case r <= 0xffff:
+			return fmt.Sprintf(`\u%04x`, r), nil
+		}
+		return fmt.Sprintf(`\U%08x`, r), nil
+	})
+}
+
+//time 生成带UTC时区的datetime,使用__import__避免依赖代码中已经导入datetime
+func (pythonLiteral) time(v time.Time) string {
+	v = v.UTC()
+	return fmt.Sprintf(`__import__("datetime").datetime(%d, %d, %d, %d, %d, %d, %d, tzinfo=__import__("datetime").timezone.utc)`,
+		v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond()/1000)
+}
+
+func (pythonLiteral) list(elems []string, scalar bool) string {
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+func (pythonLiteral) dict(keys []string, values []string) string {
+	pairs := make([]string, len(keys))
+	for i := range keys {
+		pairs[i] = keys[i] + ": " + values[i]
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func (pythonLiteral) stringKeys() bool { return false }
+
+type scalaLiteral struct{}
+
+func (scalaLiteral) null() string { return "null" }
+
+func (scalaLiteral) boolean(v bool) string { return strconv.FormatBool(v) }
+
+func (scalaLiteral) integer(v int64, bits int) string {
+	if bits == 64 {
+		return strconv.FormatInt(v, 10) + "L"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func (scalaLiteral) unsigned(v uint64, bits int) string {
+	switch {
+	case v > math.MaxInt64:
+		return `BigInt("` + strconv.FormatUint(v, 10) + `")`
+	case bits == 64 || v > math.MaxInt32:
+		return strconv.FormatUint(v, 10) + "L"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func (scalaLiteral) float(v float64, bits int) (string, error) {
+	typ, suffix := "Double", "d"
+	if bits == 32 {
+		typ, suffix = "Float", "f"
+	}
+	switch {
+	case math.IsNaN(v):
+		return typ + ".NaN", nil
+	case math.IsInf(v, 1):
+		return typ + ".PositiveInfinity", nil
+	case math.IsInf(v, -1):
+		return typ + ".NegativeInfinity", nil
+	}
+	return formatFloat(v, bits) + suffix, nil
+}
+
+//str scala 2.12及以前会在词法分析前处理\u转义,所以换行,引号和反斜杠必须使用具名转义
+func (scalaLiteral) str(v string) (string, error) {
+	return quote(v, '"', func(r rune) (string, error) {
+		switch r {
+		case '"', '\\':
+			return `\` + string(r), nil
+		case '\n':
+			return `\n`, nil
+		case '\r':
+			return `\r`, nil
+		case '\t':
+			return `\t`, nil
+		case '\b':
+			return `\b`, nil
+		case '\f':
+			return `\f`, nil
+		}
+		switch {
+		case isPlain(r):
+			return "", nil
+		case r <= 0xffff:
+			return fmt.Sprintf(`\u%04x`, r), nil
+		}
+		r1, r2 := utf16Surrogates(r)
+		return fmt.Sprintf(`\u%04x\u%04x`, r1, r2), nil
+	})
+}
+
+func (scalaLiteral) time(v time.Time) string {
+	return `java.sql.Timestamp.from(java.time.Instant.parse("` + v.UTC().Format(time.RFC3339Nano) + `"))`
+}
+
+func (scalaLiteral) list(elems []string, scalar bool) string {
+	return "Seq(" + strings.Join(elems, ", ") + ")"
+}
+
+func (scalaLiteral) dict(keys []string, values []string) string {
+	pairs := make([]string, len(keys))
+	for i := range keys {
+		pairs[i] = keys[i] + " -> " + values[i]
+	}
+	return "Map(" + strings.Join(pairs, ", ") + ")"
+}
+
+func (scalaLiteral) stringKeys() bool { return false }
+
+func utf16Surrogates(r rune) (rune, rune) {
+	r -= 0x10000
+	return 0xd800 + (r>>10)&0x3ff, 0xdc00 + r&0x3ff
+}
+
+type rLiteral struct{}
+
+func (rLiteral) null() string { return "NULL" }
+
+func (rLiteral) boolean(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+//integer R的整数为32位,超出范围的整数写为double
+func (rLiteral) integer(v int64, bits int) string {
+	if v >= math.MinInt32+1 && v <= math.MaxInt32 {
+		return strconv.FormatInt(v, 10) + "L"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func (rLiteral) unsigned(v uint64, bits int) string {
+	if v <= math.MaxInt32 {
+		return strconv.FormatUint(v, 10) + "L"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func (rLiteral) float(v float64, bits int) (string, error) {
+	switch {
+	case math.IsNaN(v):
+		return "NaN", nil
+	case math.IsInf(v, 1):
+		return "Inf", nil
+	case math.IsInf(v, -1):
+		return "-Inf", nil
+	}
+	return formatFloat(v, bits), nil
+}
+
+func (rLiteral) str(v string) (string, error) {
+	return quote(v, '"', func(r rune) (string, error) {
+		switch r {
+		case 0:
+			return "", fmt.Errorf("R的字符串不能包含\\0:%q", v)
+		case '"', '\\':
+			return `\` + string(r), nil
+		case '\n':
+			return `\n`, nil
+		case '\r':
+			return `\r`, nil
+		case '\t':
+			return `\t`, nil
+		}
+		switch {
+		case isPlain(r):
+			return "", nil
+		case r <= 0xffff:
+			return fmt.Sprintf(`\u%04x`, r), nil
+		}
+		return fmt.Sprintf(`\U%08x`, r), nil
+	})
+}
+
+func (rLiteral) time(v time.Time) string {
+	return `as.POSIXct("` + v.UTC().Format("2006-01-02 15:04:05.999999") + `", tz = "UTC")`
+}
+
+//list 元素为标量时生成向量,否则生成list
+func (rLiteral) list(elems []string, scalar bool) string {
+	if scalar {
+		return "c(" + strings.Join(elems, ", ") + ")"
+	}
+	return "list(" + strings.Join(elems, ", ") + ")"
+}
+
+//dict 生成命名list,key会作为名称使用
+func (rLiteral) dict(keys []string, values []string) string {
+	pairs := make([]string, len(keys))
+	for i := range keys {
+		pairs[i] = keys[i] + " = " + values[i]
+	}
+	return "list(" + strings.Join(pairs, ", ") + ")"
+}
+
+func (rLiteral) stringKeys() bool { return true }
+
+type sqlLiteral struct{}
+
+func (sqlLiteral) null() string { return "NULL" }
+
+func (sqlLiteral) boolean(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (sqlLiteral) integer(v int64, bits int) string { return strconv.FormatInt(v, 10) }
+
+func (sqlLiteral) unsigned(v uint64, bits int) string { return strconv.FormatUint(v, 10) }
+
+func (sqlLiteral) float(v float64, bits int) (string, error) {
+	switch {
+	case math.IsNaN(v):
+		return "CAST('NaN' AS DOUBLE)", nil
+	case math.IsInf(v, 1):
+		return "CAST('Infinity' AS DOUBLE)", nil
+	case math.IsInf(v, -1):
+		return "CAST('-Infinity' AS DOUBLE)", nil
+	}
+	return formatFloat(v, bits) + "D", nil
+}
+
+//str spark sql的字符串字面量默认支持反斜杠转义
+func (sqlLiteral) str(v string) (string, error) {
+	return quote(v, '\'', func(r rune) (string, error) {
+		switch r {
+		case '\'', '\\':
+			return `\` + string(r), nil
+		case '\n':
+			return `\n`, nil
+		case '\r':
+			return `\r`, nil
+		case '\t':
+			return `\t`, nil
+		}
+		switch {
+		case isPlain(r):
+			return "", nil
+		case r <= 0xffff:
+			return fmt.Sprintf(`\u%04x`, r), nil
+		}
+		return fmt.Sprintf(`\U%08x`, r), nil
+	})
+}
+
+func (sqlLiteral) time(v time.Time) string {
+	return `TIMESTAMP '` + v.UTC().Format("2006-01-02 15:04:05.999999") + `Z'`
+}
+
+func (sqlLiteral) list(elems []string, scalar bool) string {
+	return "array(" + strings.Join(elems, ", ") + ")"
+}
+
+func (sqlLiteral) dict(keys []string, values []string) string {
+	pairs := make([]string, len(keys))
+	for i := range keys {
+		pairs[i] = keys[i] + ", " + values[i]
+	}
+	return "map(" + strings.Join(pairs, ", ") + ")"
+}
+
+func (sqlLiteral) stringKeys() bool { return false }
+
+//Template 使用text/template渲染代码,params中的值会先转为kind对应语言的字面量再填入模板
+//
+//模板中使用{{.name}}引用参数,引用不存在的参数会返回错误
+func Template(kind string, code string, params map[string]interface{}) (string, error) {
+	w, err := literalWriterOf(kind)
+	if err != nil {
+		return "", err
+	}
+	literals := make(map[string]string, len(params))
+	for name, v := range params {
+		literal, err := writeLiteral(w, reflect.ValueOf(v))
+		if err != nil {
+			return "", fmt.Errorf("参数%s:%w", name, err)
+		}
+		literals[name] = literal
+	}
+	tmpl, err := template.New("statement").Option("missingkey=error").Parse(code)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, literals)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,94 @@
+package golivyclient
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLiteral(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	special := "it's \"q\" \\ \n\t$x ${y} 中 😀 \x00"
+	cases := []struct {
+		kind string
+		v    interface{}
+		want string
+	}{
+		{KindPySpark, nil, "None"},
+		{KindPySpark, (*int)(nil), "None"},
+		{KindPySpark, true, "True"},
+		{KindPySpark, int64(-3), "-3"},
+		{KindPySpark, uint64(math.MaxUint64), "18446744073709551615"},
+		{KindPySpark, math.Inf(1), `float("inf")`},
+		{KindPySpark, math.NaN(), `float("nan")`},
+		{KindPySpark, special, `"it's \"q\" \\ \n\t$x ${y} 中 😀 \x00"`},
+		{KindPySpark, []byte("ab"), `"ab"`},
+		{KindPySpark, []interface{}{1, "a"}, `[1, "a"]`},
+		{KindPySpark, map[string]int{"b": 2, "a": 1}, `{"a": 1, "b": 2}`},
+		{KindPySpark, map[int]string{1: "x"}, `{1: "x"}`},
+		{KindPySpark, ts, `__import__("datetime").datetime(2024, 1, 2, 3, 4, 5, 0, tzinfo=__import__("datetime").timezone.utc)`},
+
+		{KindSpark, nil, "null"},
+		{KindSpark, true, "true"},
+		{KindSpark, int64(-3), "-3L"},
+		{KindSpark, int32(7), "7"},
+		{KindSpark, uint64(math.MaxUint64), `BigInt("18446744073709551615")`},
+		{KindSpark, 1.5, "1.5d"},
+		{KindSpark, float32(0.1), "0.1f"},
+		{KindSpark, math.Inf(1), "Double.PositiveInfinity"},
+		{KindSpark, special, `"it's \"q\" \\ \n\t$x ${y} 中 😀 \u0000"`},
+		{KindSpark, []int64{1, 2}, "Seq(1L, 2L)"},
+		{KindSpark, map[string]int{"b": 2, "a": 1}, `Map("a" -> 1L, "b" -> 2L)`},
+		{KindSpark, ts, `java.sql.Timestamp.from(java.time.Instant.parse("2024-01-02T03:04:05Z"))`},
+
+		{KindSparkR, nil, "NULL"},
+		{KindSparkR, true, "TRUE"},
+		{KindSparkR, int64(-3), "-3L"},
+		{KindSparkR, math.Inf(1), "Inf"},
+		{KindSparkR, `a"b\c`, `"a\"b\\c"`},
+		{KindSparkR, []int64{1, 2}, "c(1L, 2L)"},
+		{KindSparkR, []interface{}{1, "a"}, `list(1L, "a")`},
+		{KindSparkR, map[string]int{"b": 2, "a": 1}, `list("a" = 1L, "b" = 2L)`},
+		{KindSparkR, map[int]string{1: "x"}, `list("1" = "x")`},
+		{KindSparkR, ts, `as.POSIXct("2024-01-02 03:04:05", tz = "UTC")`},
+
+		{KindSQL, nil, "NULL"},
+		{KindSQL, true, "TRUE"},
+		{KindSQL, int64(-3), "-3"},
+		{KindSQL, 1.5, "1.5D"},
+		{KindSQL, math.Inf(1), "CAST('Infinity' AS DOUBLE)"},
+		{KindSQL, math.NaN(), "CAST('NaN' AS DOUBLE)"},
+		{KindSQL, special, `'it\'s "q" \\ \n\t$x ${y} 中 😀 \u0000'`},
+		{KindSQL, []interface{}{1, "a"}, "array(1, 'a')"},
+		{KindSQL, map[string]int{"b": 2, "a": 1}, "map('a', 1, 'b', 2)"},
+		{KindSQL, ts, "TIMESTAMP '2024-01-02 03:04:05Z'"},
+	}
+	for _, c := range cases {
+		got, err := Literal(c.kind, c.v)
+		if err != nil {
+			t.Errorf("Literal(%s, %#v)返回错误%v", c.kind, c.v, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Literal(%s, %#v)为%s,应为%s", c.kind, c.v, got, c.want)
+		}
+	}
+}
+
+func TestLiteralErrors(t *testing.T) {
+	cases := []struct {
+		kind string
+		v    interface{}
+	}{
+		{KindSparkR, "a\x00b"},
+		{KindSQL, struct{}{}},
+		{KindSQL, func() {}},
+		{"java", 1},
+	}
+	for _, c := range cases {
+		got, err := Literal(c.kind, c.v)
+		if err == nil {
+			t.Errorf("Literal(%s, %#v)为%s,应返回错误", c.kind, c.v, got)
+		}
+	}
+}
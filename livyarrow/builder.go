@@ -0,0 +1,314 @@
+//Package livyarrow 将statement的表格结果转换为Apache Arrow的Record
+//
+//sql类型的statement的输出带有完整的spark schema,其中的struct,array和map列会转换为arrow的嵌套类型;
+//application/vnd.livy.table.v1+json的输出没有元素类型,复杂类型和没有精度的decimal会转换为json字符串
+package livyarrow
+
+import (
+	"encoding/base64"
+	jsonl "encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	lc "golivyclient"
+)
+
+//Schema 将表格结果的列转换为arrow的schema
+func Schema(columns []lc.TableColumn) (*arrow.Schema, error) {
+	_, schema, err := parseColumns(columns)
+	return schema, err
+}
+
+func parseColumns(columns []lc.TableColumn) ([]*sparkType, *arrow.Schema, error) {
+	types := make([]*sparkType, len(columns))
+	fields := make([]arrow.Field, len(columns))
+	for i, col := range columns {
+		st, err := columnType(col)
+		if err != nil {
+			return nil, nil, fmt.Errorf("列%s:%w", col.Name, err)
+		}
+		types[i] = st
+		fields[i] = arrow.Field{Name: col.Name, Type: st.arrowType(), Nullable: true}
+	}
+	return types, arrow.NewSchema(fields, nil), nil
+}
+
+//NewRecord 将表格结果转换为arrow的Record,mem为nil时使用memory.DefaultAllocator,使用结束后需要调用Release
+func NewRecord(mem memory.Allocator, t *lc.TableResult) (arrow.Record, error) {
+	b, err := NewBuilder(mem, t.Columns)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Release()
+	for i, row := range t.Rows {
+		err = b.Append(row)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行:%w", i, err)
+		}
+	}
+	return b.NewRecord(), nil
+}
+
+//Builder 逐行构建Record,可以配合Session.Collect按页生成多个Record
+type Builder struct {
+	columns []lc.TableColumn
+	types   []*sparkType
+	builder *array.RecordBuilder
+}
+
+//NewBuilder 创建Builder,mem为nil时使用memory.DefaultAllocator,使用结束后需要调用Release
+func NewBuilder(mem memory.Allocator, columns []lc.TableColumn) (*Builder, error) {
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	types, schema, err := parseColumns(columns)
+	if err != nil {
+		return nil, err
+	}
+	b := new(Builder)
+	b.columns = columns
+	b.types = types
+	b.builder = array.NewRecordBuilder(mem, schema)
+	return b, nil
+}
+
+//Schema Record的schema
+func (b *Builder) Schema() *arrow.Schema {
+	return b.builder.Schema()
+}
+
+//Append 添加一行,row中的数字为json.Number;出错时已经添加到部分列中的值不会回滚,需要丢弃该Builder
+func (b *Builder) Append(row []interface{}) error {
+	if len(row) != len(b.columns) {
+		return fmt.Errorf("结果有%d列,但该行有%d个值", len(b.columns), len(row))
+	}
+	for i, col := range b.columns {
+		err := appendValue(b.builder.Field(i), b.types[i], col.Name, row[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//NewRecord 用已经添加的行创建Record,之后Builder可以继续添加新的行
+func (b *Builder) NewRecord() arrow.Record {
+	return b.builder.NewRecord()
+}
+
+//Release 释放Builder
+func (b *Builder) Release() {
+	b.builder.Release()
+}
+
+func appendValue(ab array.Builder, st *sparkType, path string, raw interface{}) error {
+	if raw == nil {
+		ab.AppendNull()
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("%s的值%v不是%s类型", path, raw, st.name)
+	}
+	switch st.name {
+	case "array":
+		elems, ok := raw.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		lb := ab.(*array.ListBuilder)
+		lb.Append(true)
+		for i, ele := range elems {
+			err := appendValue(lb.ValueBuilder(), st.elem, fmt.Sprintf("%s[%d]", path, i), ele)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "map":
+		return appendMap(ab.(*array.MapBuilder), st, path, raw)
+	case "struct":
+		sb := ab.(*array.StructBuilder)
+		switch v := raw.(type) {
+		case map[string]interface{}:
+			sb.Append(true)
+			for i, f := range st.fields {
+				err := appendValue(sb.FieldBuilder(i), f.typ, path+"."+f.name, v[f.name])
+				if err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			if len(v) != len(st.fields) {
+				return fmt.Errorf("%s有%d个字段,但值有%d个", path, len(st.fields), len(v))
+			}
+			sb.Append(true)
+			for i, f := range st.fields {
+				err := appendValue(sb.FieldBuilder(i), f.typ, path+"."+f.name, v[i])
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch()
+		}
+		return nil
+	case "null", "void":
+		ab.AppendNull()
+		return nil
+	case "binary":
+		bs, err := binaryValue(raw)
+		if err != nil {
+			return fmt.Errorf("%s:%w", path, err)
+		}
+		ab.(*array.BinaryBuilder).Append(bs)
+		return nil
+	}
+	typeName := st.name
+	if typeName == "timestamp_ntz" {
+		typeName = "timestamp"
+	}
+	v, err := lc.TableColumn{Name: path, Type: typeName}.Value(raw)
+	if err != nil {
+		return err
+	}
+	outOfRange := func(min int64, max int64) bool {
+		return v.(int64) < min || v.(int64) > max
+	}
+	switch st.name {
+	case "long":
+		ab.(*array.Int64Builder).Append(v.(int64))
+	case "integer":
+		if outOfRange(math.MinInt32, math.MaxInt32) {
+			return fmt.Errorf("%s的值%v超出integer的范围", path, v)
+		}
+		ab.(*array.Int32Builder).Append(int32(v.(int64)))
+	case "short":
+		if outOfRange(math.MinInt16, math.MaxInt16) {
+			return fmt.Errorf("%s的值%v超出short的范围", path, v)
+		}
+		ab.(*array.Int16Builder).Append(int16(v.(int64)))
+	case "byte":
+		if outOfRange(math.MinInt8, math.MaxInt8) {
+			return fmt.Errorf("%s的值%v超出byte的范围", path, v)
+		}
+		ab.(*array.Int8Builder).Append(int8(v.(int64)))
+	case "double":
+		ab.(*array.Float64Builder).Append(v.(float64))
+	case "float":
+		ab.(*array.Float32Builder).Append(float32(v.(float64)))
+	case "boolean":
+		bv, ok := v.(bool)
+		if !ok {
+			return mismatch()
+		}
+		ab.(*array.BooleanBuilder).Append(bv)
+	case "date":
+		ab.(*array.Date32Builder).Append(arrow.Date32FromTime(v.(time.Time)))
+	case "timestamp", "timestamp_ntz":
+		ab.(*array.TimestampBuilder).Append(arrow.Timestamp(v.(time.Time).UnixMicro()))
+	case "decimal":
+		n, err := decimal128.FromString(v.(string), st.precision, st.scale)
+		if err != nil {
+			return fmt.Errorf("%s的值%v不是decimal(%d,%d):%w", path, v, st.precision, st.scale, err)
+		}
+		ab.(*array.Decimal128Builder).Append(n)
+	default:
+		s, ok := v.(string)
+		if !ok {
+			bs, err := jsonl.Marshal(v)
+			if err != nil {
+				return err
+			}
+			s = string(bs)
+		}
+		ab.(*array.StringBuilder).Append(s)
+	}
+	return nil
+}
+
+//appendMap map的值可以是json对象,[key,value]数组的数组或{"key":..,"value":..}对象的数组
+func appendMap(mb *array.MapBuilder, st *sparkType, path string, raw interface{}) error {
+	type entry struct {
+		key   interface{}
+		value interface{}
+	}
+	entries := []entry{}
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			var key interface{} = k
+			switch {
+			case st.key.isNumeric():
+				key = jsonl.Number(k)
+			case st.key.name == "boolean" && (k == "true" || k == "false"):
+				key = k == "true"
+			}
+			entries = append(entries, entry{key, v[k]})
+		}
+	case []interface{}:
+		for _, ele := range v {
+			switch pair := ele.(type) {
+			case []interface{}:
+				if len(pair) != 2 {
+					return fmt.Errorf("%s的元素%v不是键值对", path, ele)
+				}
+				entries = append(entries, entry{pair[0], pair[1]})
+			case map[string]interface{}:
+				entries = append(entries, entry{pair["key"], pair["value"]})
+			default:
+				return fmt.Errorf("%s的元素%v不是键值对", path, ele)
+			}
+		}
+	default:
+		return fmt.Errorf("%s的值%v不是map类型", path, raw)
+	}
+	mb.Append(true)
+	for _, e := range entries {
+		if e.key == nil {
+			return fmt.Errorf("%s的key不能为null", path)
+		}
+		err := appendValue(mb.KeyBuilder(), st.key, path+".key", e.key)
+		if err != nil {
+			return err
+		}
+		err = appendValue(mb.ItemBuilder(), st.value, fmt.Sprintf("%s[%v]", path, e.key), e.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//binaryValue 二进制的值可以是base64字符串或字节数组
+func binaryValue(raw interface{}) ([]byte, error) {
+	switch v := raw.(type) {
+	case string:
+		return base64.StdEncoding.DecodeString(v)
+	case []interface{}:
+		bs := make([]byte, len(v))
+		for i, ele := range v {
+			n, ok := ele.(jsonl.Number)
+			if !ok {
+				return nil, fmt.Errorf("%v不是字节", ele)
+			}
+			b, err := n.Int64()
+			if err != nil || b < -128 || b > 255 {
+				return nil, fmt.Errorf("%v不是字节", ele)
+			}
+			bs[i] = byte(b)
+		}
+		return bs, nil
+	}
+	return nil, fmt.Errorf("%v不是二进制数据", raw)
+}
@@ -0,0 +1,230 @@
+package livyarrow
+
+import (
+	jsonl "encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	lc "golivyclient"
+)
+
+//decodeRows 解析行,行中的数字为json.Number
+func decodeRows(t *testing.T, rows string) [][]interface{} {
+	t.Helper()
+	res := [][]interface{}{}
+	dec := jsonl.NewDecoder(strings.NewReader(rows))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+//newTestRecord 构建Record,测试结束时检查内存是否全部释放
+func newTestRecord(t *testing.T, columns []lc.TableColumn, rows string) arrow.Record {
+	t.Helper()
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	rec, err := NewRecord(mem, &lc.TableResult{Columns: columns, Rows: decodeRows(t, rows)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rec.Release()
+		mem.AssertSize(t, 0)
+	})
+	return rec
+}
+
+//assertColumns 将Record的每一列与json表示的期望值比较
+func assertColumns(t *testing.T, rec arrow.Record, want map[string]string) {
+	t.Helper()
+	for i, f := range rec.Schema().Fields() {
+		data, ok := want[f.Name]
+		if !ok {
+			continue
+		}
+		expected, _, err := array.FromJSON(memory.DefaultAllocator, f.Type, strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s:%v", f.Name, err)
+		}
+		if !array.Equal(rec.Column(i), expected) {
+			t.Errorf("%s为%s,应为%s", f.Name, rec.Column(i), expected)
+		}
+		expected.Release()
+	}
+}
+
+func TestNewRecordPrimitive(t *testing.T) {
+	columns := []lc.TableColumn{
+		{Name: "id", Type: "BIGINT_TYPE"}, {Name: "n", Type: "int"}, {Name: "s", Type: "smallint"}, {Name: "b", Type: "tinyint"},
+		{Name: "d", Type: "double"}, {Name: "f", Type: "float"}, {Name: "ok", Type: "boolean"}, {Name: "day", Type: "date"},
+		{Name: "ts", Type: "timestamp"}, {Name: "amt", Type: "decimal(10,2)"}, {Name: "name", Type: "string"},
+		{Name: "plain", Type: "DECIMAL_TYPE"}, {Name: "tags", Type: "ARRAY_TYPE"},
+	}
+	rec := newTestRecord(t, columns, `[
+		[9007199254740993,2147483647,-32768,127,1.5,0.25,true,"2024-01-02","2024-01-02 03:04:05.000006","12.30","x",3.14,[1,2]],
+		[null,null,null,null,null,null,null,null,null,null,null,null,null],
+		[-1,-2147483648,32767,-128,"-Infinity",-0.5,false,"1969-12-31",0,-0.05,"","-1",[]]]`)
+	if rec.NumRows() != 3 || rec.NumCols() != int64(len(columns)) {
+		t.Fatalf("Record有%d行%d列", rec.NumRows(), rec.NumCols())
+	}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC).UnixMicro()
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	assertColumns(t, rec, map[string]string{
+		"n":     `[2147483647,null,-2147483648]`,
+		"s":     `[-32768,null,32767]`,
+		"b":     `[127,null,-128]`,
+		"f":     `[0.25,null,-0.5]`,
+		"ok":    `[true,null,false]`,
+		"day":   `[` + strconv.FormatInt(day, 10) + `,null,-1]`,
+		"ts":    `[` + strconv.FormatInt(ts, 10) + `,null,0]`,
+		"amt":   `["12.30",null,"-0.05"]`,
+		"name":  `["x",null,""]`,
+		"plain": `["3.14",null,"-1"]`,
+		"tags":  `["[1,2]",null,"[]"]`,
+	})
+	//大整数不能丢失精度,json中无法表示无穷
+	ids := rec.Column(0).(*array.Int64)
+	if ids.Value(0) != 9007199254740993 || !ids.IsNull(1) || ids.Value(2) != -1 {
+		t.Errorf("id为%s", ids)
+	}
+	ds := rec.Column(4).(*array.Float64)
+	if ds.Value(0) != 1.5 || !ds.IsNull(1) || !math.IsInf(ds.Value(2), -1) {
+		t.Errorf("d为%s", ds)
+	}
+	if tt := rec.Schema().Field(8).Type.(*arrow.TimestampType); tt.Unit != arrow.Microsecond || tt.TimeZone != "UTC" {
+		t.Errorf("timestamp的类型为%s", tt)
+	}
+	if dt := rec.Schema().Field(9).Type.(*arrow.Decimal128Type); dt.Precision != 10 || dt.Scale != 2 {
+		t.Errorf("decimal的类型为%s", dt)
+	}
+}
+
+//schemaColumn sql类型statement的输出中带schema的列
+func schemaColumn(name string, schema string) lc.TableColumn {
+	return lc.TableColumn{Name: name, Schema: jsonl.RawMessage(schema)}
+}
+
+func TestNewRecordNested(t *testing.T) {
+	columns := []lc.TableColumn{
+		schemaColumn("arr", `{"type":"array","elementType":"integer","containsNull":true}`),
+		schemaColumn("m", `{"type":"map","keyType":"integer","valueType":"string","valueContainsNull":true}`),
+		schemaColumn("bm", `{"type":"map","keyType":"boolean","valueType":"long","valueContainsNull":true}`),
+		schemaColumn("dm", `{"type":"map","keyType":"decimal(4,1)","valueType":"date","valueContainsNull":true}`),
+		schemaColumn("st", `{"type":"struct","fields":[{"name":"a","type":"long","nullable":true},
+			{"name":"b","type":{"type":"array","elementType":"string","containsNull":true},"nullable":true}]}`),
+		schemaColumn("bin", `"binary"`),
+		schemaColumn("ntz", `"timestamp_ntz"`),
+		schemaColumn("point", `{"type":"udt","class":"org.example.PointUDT","sqlType":"double"}`),
+		schemaColumn("none", `"void"`),
+	}
+	rec := newTestRecord(t, columns, `[
+		[[1,null,3],{"2":"b","10":"j","1":null},{"true":1,"false":0},{"1.5":"2024-01-02"},{"a":1,"b":["x",null]},"AQL/",
+			"2024-01-02T03:04:05",1.5,null],
+		[null,[[3,"c"]],[],[{"key":"-0.5","value":null}],[2,null],[1,2,255],null,null,null],
+		[[],{},null,null,{"b":[]},null,"1970-01-01T00:00:00.000001",null,null]]`)
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMicro()
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	assertColumns(t, rec, map[string]string{
+		"arr": `[[1,null,3],null,[]]`,
+		//json对象的key按字符串排序后转换为数字
+		"m":     `[[{"key":1,"value":null},{"key":10,"value":"j"},{"key":2,"value":"b"}],[{"key":3,"value":"c"}],[]]`,
+		"bm":    `[[{"key":false,"value":0},{"key":true,"value":1}],[],null]`,
+		"dm":    `[[{"key":"1.5","value":` + strconv.FormatInt(day, 10) + `}],[{"key":"-0.5","value":null}],null]`,
+		"st":    `[{"a":1,"b":["x",null]},{"a":2,"b":null},{"a":null,"b":[]}]`,
+		"bin":   `["AQL/","AQL/",null]`,
+		"ntz":   `[` + strconv.FormatInt(ts, 10) + `,null,1]`,
+		"point": `[1.5,null,null]`,
+		"none":  `[null,null,null]`,
+	})
+	if tt := rec.Schema().Field(6).Type.(*arrow.TimestampType); tt.TimeZone != "" {
+		t.Errorf("timestamp_ntz不应有时区,类型为%s", tt)
+	}
+}
+
+func TestAppendValueErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		raw    string
+		path   string
+	}{
+		{"超出integer的范围", `"integer"`, `2147483648`, "v"},
+		{"超出short的范围", `"short"`, `-32769`, "v"},
+		{"超出byte的范围", `"byte"`, `128`, "v"},
+		{"超出long的范围", `"long"`, `9223372036854775808`, "v"},
+		{"小数到long", `"long"`, `1.5`, "v"},
+		{"字符串到boolean", `"boolean"`, `"yes"`, "v"},
+		{"超出decimal的精度", `"decimal(4,2)"`, `"123.45"`, "v"},
+		{"非法的日期", `"date"`, `"soon"`, "v"},
+		{"非法的base64", `"binary"`, `"%%%"`, "v"},
+		{"超出字节的范围", `"binary"`, `[1,256]`, "v"},
+		{"数组元素的类型错误", `{"type":"array","elementType":"integer"}`, `[1,"x"]`, "v[1]"},
+		{"数组的值不是数组", `{"type":"array","elementType":"integer"}`, `{"a":1}`, "v"},
+		{"struct的字段数不一致", `{"type":"struct","fields":[{"name":"a","type":"long"}]}`, `[1,2]`, "v"},
+		{"struct字段的类型错误", `{"type":"struct","fields":[{"name":"a","type":"long"}]}`, `{"a":"x"}`, "v.a"},
+		{"map的值不是map", `{"type":"map","keyType":"string","valueType":"long"}`, `"x"`, "v"},
+		{"map的key为null", `{"type":"map","keyType":"string","valueType":"long"}`, `[[null,1]]`, "v"},
+		{"map的元素不是键值对", `{"type":"map","keyType":"string","valueType":"long"}`, `[[1,2,3]]`, "v"},
+		{"map的值的类型错误", `{"type":"map","keyType":"string","valueType":"long"}`, `{"k":"x"}`, "v[k]"},
+		{"json对象的key不是数字", `{"type":"map","keyType":"integer","valueType":"long"}`, `{"k":1}`, "v.key"},
+		{"json对象的key不是布尔值", `{"type":"map","keyType":"boolean","valueType":"long"}`, `{"yes":1}`, "v"},
+	}
+	for _, c := range cases {
+		b, err := NewBuilder(nil, []lc.TableColumn{schemaColumn("v", c.schema)})
+		if err != nil {
+			t.Fatalf("%s:%v", c.name, err)
+		}
+		err = b.Append(decodeRows(t, `[[`+c.raw+`]]`)[0])
+		b.Release()
+		if err == nil {
+			t.Errorf("%s时应返回错误", c.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.path) {
+			t.Errorf("%s:错误%v中应包含%s", c.name, err, c.path)
+		}
+	}
+
+	b, err := NewBuilder(nil, []lc.TableColumn{{Name: "a", Type: "long"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Release()
+	if err := b.Append([]interface{}{jsonl.Number("1"), jsonl.Number("2")}); err == nil {
+		t.Error("列数不一致时应返回错误")
+	}
+	if _, err := NewRecord(nil, &lc.TableResult{Columns: b.columns, Rows: decodeRows(t, `[[1],["x"]]`)}); err == nil || !strings.HasPrefix(err.Error(), "第1行:") {
+		t.Errorf("错误中应包含行号,err为%v", err)
+	}
+}
+
+func TestBuilderMultipleRecords(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+	b, err := NewBuilder(mem, []lc.TableColumn{{Name: "a", Type: "long"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Release()
+	for page, rows := range []string{`[[1],[2]]`, `[[3]]`} {
+		for _, row := range decodeRows(t, rows) {
+			if err := b.Append(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec := b.NewRecord()
+		if page == 0 {
+			assertColumns(t, rec, map[string]string{"a": `[1,2]`})
+		} else {
+			assertColumns(t, rec, map[string]string{"a": `[3]`})
+		}
+		rec.Release()
+	}
+}
@@ -0,0 +1,161 @@
+package livyarrow
+
+import (
+	jsonl "encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	lc "golivyclient"
+)
+
+//sparkType 解析后的spark类型
+type sparkType struct {
+	//name 基础类型名,与TableColumn.BaseType相同,复杂类型为array,map或struct,无法解析的类型为json
+	name      string
+	precision int32
+	scale     int32
+	elem      *sparkType
+	key       *sparkType
+	value     *sparkType
+	fields    []sparkField
+}
+
+type sparkField struct {
+	name     string
+	typ      *sparkType
+	nullable bool
+}
+
+var decimalType = regexp.MustCompile(`^\s*(?i:decimal)\s*\(\s*(\d+)\s*,\s*(\d+)\s*\)\s*$`)
+
+//columnType 解析列的类型,有Schema时使用Schema,否则使用Type,没有元素类型的复杂类型转为json字符串
+func columnType(col lc.TableColumn) (*sparkType, error) {
+	if len(col.Schema) > 0 {
+		return parseSchema(col.Schema)
+	}
+	return primitiveType(col.Type), nil
+}
+
+func primitiveType(name string) *sparkType {
+	st := &sparkType{name: lc.TableColumn{Type: name}.BaseType()}
+	switch st.name {
+	case "decimal":
+		m := decimalType.FindStringSubmatch(name)
+		if m == nil {
+			//livy的表格输出中decimal没有精度,按字符串保存以免丢失精度
+			st.name = "json"
+			break
+		}
+		p, _ := strconv.Atoi(m[1])
+		s, _ := strconv.Atoi(m[2])
+		st.precision, st.scale = int32(p), int32(s)
+	case "array", "map", "struct":
+		st.name = "json"
+	}
+	return st
+}
+
+//parseSchema 解析spark DataType的json表示
+func parseSchema(raw jsonl.RawMessage) (*sparkType, error) {
+	var name string
+	if jsonl.Unmarshal(raw, &name) == nil {
+		return primitiveType(name), nil
+	}
+	def := struct {
+		Type        string           `json:"type"`
+		ElementType jsonl.RawMessage `json:"elementType"`
+		KeyType     jsonl.RawMessage `json:"keyType"`
+		ValueType   jsonl.RawMessage `json:"valueType"`
+		SQLType     jsonl.RawMessage `json:"sqlType"`
+		Fields      []struct {
+			Name     string           `json:"name"`
+			Type     jsonl.RawMessage `json:"type"`
+			Nullable bool             `json:"nullable"`
+		} `json:"fields"`
+	}{}
+	err := jsonl.Unmarshal(raw, &def)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析spark类型%s:%w", raw, err)
+	}
+	st := &sparkType{name: def.Type}
+	switch def.Type {
+	case "array":
+		st.elem, err = parseSchema(def.ElementType)
+	case "map":
+		st.key, err = parseSchema(def.KeyType)
+		if err == nil {
+			st.value, err = parseSchema(def.ValueType)
+		}
+	case "struct":
+		for _, f := range def.Fields {
+			ft, ferr := parseSchema(f.Type)
+			if ferr != nil {
+				return nil, fmt.Errorf("字段%s:%w", f.Name, ferr)
+			}
+			st.fields = append(st.fields, sparkField{name: f.Name, typ: ft, nullable: f.Nullable})
+		}
+	case "udt":
+		//自定义类型按其底层的sql类型转换
+		return parseSchema(def.SQLType)
+	default:
+		return nil, fmt.Errorf("无法解析spark类型%s", raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+//arrowType spark类型对应的arrow类型
+func (st *sparkType) arrowType() arrow.DataType {
+	switch st.name {
+	case "long":
+		return arrow.PrimitiveTypes.Int64
+	case "integer":
+		return arrow.PrimitiveTypes.Int32
+	case "short":
+		return arrow.PrimitiveTypes.Int16
+	case "byte":
+		return arrow.PrimitiveTypes.Int8
+	case "double":
+		return arrow.PrimitiveTypes.Float64
+	case "float":
+		return arrow.PrimitiveTypes.Float32
+	case "boolean":
+		return arrow.FixedWidthTypes.Boolean
+	case "binary":
+		return arrow.BinaryTypes.Binary
+	case "date":
+		return arrow.FixedWidthTypes.Date32
+	case "timestamp":
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	case "timestamp_ntz":
+		return &arrow.TimestampType{Unit: arrow.Microsecond}
+	case "decimal":
+		return &arrow.Decimal128Type{Precision: st.precision, Scale: st.scale}
+	case "null", "void":
+		return arrow.Null
+	case "array":
+		return arrow.ListOf(st.elem.arrowType())
+	case "map":
+		return arrow.MapOf(st.key.arrowType(), st.value.arrowType())
+	case "struct":
+		fields := make([]arrow.Field, len(st.fields))
+		for i, f := range st.fields {
+			fields[i] = arrow.Field{Name: f.name, Type: f.typ.arrowType(), Nullable: f.nullable}
+		}
+		return arrow.StructOf(fields...)
+	}
+	return arrow.BinaryTypes.String
+}
+
+//isNumeric map的key从json对象中解析出来时为字符串,数字和布尔类型的key需要转换
+func (st *sparkType) isNumeric() bool {
+	switch st.name {
+	case "long", "integer", "short", "byte", "double", "float", "decimal":
+		return true
+	}
+	return false
+}
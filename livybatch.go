@@ -1,12 +1,13 @@
 package golivyclient
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	log "github.com/Basic-Components/loggerhelper"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //Batch livy的批,用于管理固定任务
@@ -18,6 +19,8 @@ type Batch struct {
 	AppInfo map[string]interface{} `json:"appInfo"`
 	Log     []string               `json:"log"`
 	State   string                 `json:"state"`
+	//Cluster 所在集群的名称,通过ClusterRegistry提交或查找时设置
+	Cluster string `json:"-"`
 }
 
 //NewBatchQuery livy批的创建请求,用于提交固定任务
@@ -65,14 +68,33 @@ func NewBatch(c *LivyClient) *Batch {
 	return b
 }
 
-//New 新建一个batch请求并将结果更新到自身
+//New 新建一个batch请求并将结果更新到自身,提交前会合并LivyClient.DefaultConf并调用q.Validate,见LivyClient.SkipValidation
 func (b *Batch) New(q *NewBatchQuery) error {
-	url := fmt.Sprintf("%s/%s", b.Client.BASEURL, b.URI)
-	resBytes, err := HTTPJSONQuery(url, "POST", q)
+	return b.NewWithContext(context.Background(), q)
+}
+
+//NewWithContext 与New相同,ctx用于取消请求和传递追踪信息
+func (b *Batch) NewWithContext(ctx context.Context, q *NewBatchQuery) (err error) {
+	ctx, span := b.Client.tracer().Start(ctx, "livy.batch.new", trace.WithAttributes(AttrQueue.String(q.Queue)))
+	defer func() {
+		endSpan(span, err)
+	}()
+	q = q.withDefaultConf(b.Client.DefaultConf)
+	if !b.Client.SkipValidation {
+		err = q.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	ctx, pinned := b.Client.pinRoute(ctx)
+	resBytes, err := b.Client.api().CreateBatch(ctx, q)
 	if err != nil {
 		return err
 	}
 	json.Unmarshal(resBytes, b)
+	b.Client = pinned()
+	span.SetAttributes(AttrBatchID.Int(b.ID), AttrAppID.String(b.AppID), AttrState.String(b.State))
+	b.Client.metrics().StateChanged("batch", b.ID, "", b.State)
 	return nil
 }
 
@@ -91,6 +113,7 @@ func (b *Batch) Copy() *Batch {
 	newone := Batch{
 		Client:  b.Client,
 		URI:     b.URI,
+		Cluster: b.Cluster,
 		ID:      b.ID,
 		AppID:   b.AppID,
 		AppInfo: newAppInfo,
@@ -112,8 +135,11 @@ func (b *Batch) ToJSON() ([]byte, error) {
 
 //BytesInfo 获取Batch对象的信息
 func (b *Batch) BytesInfo() ([]byte, error) {
-	url := fmt.Sprintf("%s/%s/%d", b.Client.BASEURL, b.URI, b.ID)
-	resBytes, err := HTTPJSONQuery(url, "GET")
+	return b.bytesInfo(context.Background())
+}
+
+func (b *Batch) bytesInfo(ctx context.Context) ([]byte, error) {
+	resBytes, err := b.Client.api().GetBatch(ctx, b.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -133,12 +159,17 @@ func (b *Batch) Info() (*Batch, error) {
 	}
 	nb.Client = b.Client
 	nb.URI = b.URI
+	nb.Cluster = b.Cluster
 	return &nb, nil
 }
 
 //Update 更新自身
 func (b *Batch) Update() ([]byte, error) {
-	resb, err := b.BytesInfo()
+	return b.update(context.Background())
+}
+
+func (b *Batch) update(ctx context.Context) ([]byte, error) {
+	resb, err := b.bytesInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -151,17 +182,20 @@ func (b *Batch) Update() ([]byte, error) {
 	b.AppID = nb.AppID
 	b.AppInfo = nb.AppInfo
 	b.Log = nb.Log
+	if b.State != nb.State {
+		b.Client.metrics().StateChanged("batch", b.ID, b.State, nb.State)
+	}
 	b.State = nb.State
 	return resb, nil
 }
 
 //Kill 关闭batch所指向的任务
 func (b *Batch) Kill() error {
-	url := fmt.Sprintf("%s/%s/%d", b.Client.BASEURL, b.URI, b.ID)
-	_, err := HTTPJSONQuery(url, "DELETE")
+	err := b.Client.api().DeleteBatch(context.Background(), b.ID)
 	if err != nil {
 		return err
 	}
+	b.Client.metrics().StateChanged("batch", b.ID, b.State, "")
 	return nil
 }
 
@@ -172,14 +206,22 @@ type BatchUpdateMsg struct {
 	Old   *Batch `json:"Old"`
 }
 
-func (b *Batch) watch(interval time.Duration, ch chan BatchUpdateMsg) {
+func (b *Batch) url() string {
+	return fmt.Sprintf("%s/%s/%d", b.Client.BASEURL, b.URI, b.ID)
+}
+
+func (b *Batch) watch(ctx context.Context, interval time.Duration, ch chan BatchUpdateMsg) {
+	logger := b.Client.logger()
+	attempt := 0
+	ctx, span := b.Client.tracer().Start(ctx, "livy.batch.watch", trace.WithAttributes(AttrBatchID.Int(b.ID), AttrAppID.String(b.AppID)))
+	b.Client.metrics().WatcherStarted("batch")
+	defer b.Client.metrics().WatcherStopped("batch")
 	defer func() {
+		var errE error
 		err := recover()
 		if err != nil {
-			errE := err.(error)
-			log.Error(map[string]interface{}{
-				"err": errE,
-			}, "batch watch error")
+			errE = err.(error)
+			logger.Error("batch watch error", "batch_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt, "err", errE)
 			if strings.HasPrefix(errE.Error(), "未找到资源") {
 				ch <- BatchUpdateMsg{
 					State: "cancelled",
@@ -192,6 +234,8 @@ func (b *Batch) watch(interval time.Duration, ch chan BatchUpdateMsg) {
 
 		}
 		close(ch)
+		span.SetAttributes(AttrState.String(b.State))
+		endSpan(span, errE)
 	}()
 	var oldbb []byte
 	var newbb []byte
@@ -202,11 +246,13 @@ func (b *Batch) watch(interval time.Duration, ch chan BatchUpdateMsg) {
 	oldbb = bb
 OuterLoop:
 	for {
+		attempt++
 		oldb := b.Copy()
-		gb, err := b.Update()
+		gb, err := b.update(ctx)
 		if err != nil {
 			panic(err)
 		}
+		logger.Debug("batch watch poll", "batch_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt)
 		if newbb != nil {
 			oldbb = newbb
 			newbb = gb
@@ -252,7 +298,11 @@ OuterLoop:
 				if MD5(oldbb) != MD5(newbb) {
 					ch <- msg
 				}
-				time.Sleep(interval)
+				select {
+				case <-ctx.Done():
+					panic(ctx.Err())
+				case <-b.Client.clock().After(interval):
+				}
 			}
 		}
 	}
@@ -262,17 +312,22 @@ OuterLoop:
 //@interval time.Duration 轮询间隔时间
 //@chanBuffer int 队列长度
 func (b *Batch) Watch(interval time.Duration, chanBuffer int) (chan BatchUpdateMsg, error) {
+	return b.WatchWithContext(context.Background(), interval, chanBuffer)
+}
+
+//WatchWithContext 与Watch相同,ctx取消后停止轮询,发送一条State为watch_err的消息并关闭channel
+func (b *Batch) WatchWithContext(ctx context.Context, interval time.Duration, chanBuffer int) (chan BatchUpdateMsg, error) {
 	switch {
 	case chanBuffer > 0:
 		{
 			ch := make(chan BatchUpdateMsg, chanBuffer)
-			go b.watch(interval, ch)
+			go b.watch(ctx, interval, ch)
 			return ch, nil
 		}
 	case chanBuffer == 0:
 		{
 			ch := make(chan BatchUpdateMsg)
-			go b.watch(interval, ch)
+			go b.watch(ctx, interval, ch)
 			return ch, nil
 		}
 	default:
@@ -281,3 +336,27 @@ func (b *Batch) Watch(interval time.Duration, chanBuffer int) (chan BatchUpdateM
 		}
 	}
 }
+
+//Wait 轮询等待batch运行结束,结束后可以通过State判断是否成功
+func (b *Batch) Wait(ctx context.Context, interval time.Duration) (err error) {
+	ctx, span := b.Client.tracer().Start(ctx, "livy.batch.wait", trace.WithAttributes(AttrBatchID.Int(b.ID)))
+	defer func() {
+		span.SetAttributes(AttrAppID.String(b.AppID), AttrState.String(b.State))
+		endSpan(span, err)
+	}()
+	for {
+		_, err = b.update(ctx)
+		if err != nil {
+			return err
+		}
+		switch b.State {
+		case "shutting_down", "error", "dead", "killed", "success":
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.Client.clock().After(interval):
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package golivyclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBatchWait(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.BatchStates = []string{"starting", "running", "running", "success"}
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clock.Now()
+	ticks, err := runWithClock(clock, 5*time.Second, func() error {
+		return b.Wait(context.Background(), 5*time.Second)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.State != "success" {
+		t.Errorf("State为%s,应为success", b.State)
+	}
+	if ticks != 2 || clock.Now().Sub(start) != 10*time.Second {
+		t.Errorf("等待了%d次,共%s", ticks, clock.Now().Sub(start))
+	}
+	if n := countRequests(s, http.MethodGet, "/batches/0"); n != 3 {
+		t.Errorf("轮询了%d次,应为3次", n)
+	}
+}
+
+func TestBatchWaitContextCancel(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.BatchStates = []string{"running"}
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- b.Wait(ctx, time.Second)
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("err为%v,应为context.Canceled", err)
+	}
+}
+
+func TestBatchWatch(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.BatchStates = []string{"starting", "running", "running", "dead"}
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := b.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, ticks := drainWithClock(clock, time.Second, ch)
+	states := []string{}
+	for _, msg := range msgs {
+		states = append(states, msg.State)
+	}
+	//状态没有变化的轮询不发送消息
+	if len(states) != 2 || states[0] != "running" || states[1] != "dead" {
+		t.Errorf("收到的状态为%v,应为[running dead]", states)
+	}
+	if ticks != 2 {
+		t.Errorf("等待了%d次,应为2次", ticks)
+	}
+	if last := msgs[len(msgs)-1]; last.Old.State != "running" || last.New.State != "dead" {
+		t.Errorf("最后一条消息的Old为%s,New为%s", last.Old.State, last.New.State)
+	}
+}
+
+func TestBatchWatchNotFound(t *testing.T) {
+	_, c, clock := newTestClient(t)
+	b := NewBatch(c)
+	b.ID = 42
+	ch, err := b.Watch(time.Second, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := drainWithClock(clock, time.Second, ch)
+	if len(msgs) != 1 || msgs[0].State != "cancelled" {
+		t.Errorf("收到的消息为%+v,应为一条cancelled", msgs)
+	}
+}
+
+func TestBatchWatchContextCancel(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.BatchStates = []string{"running"}
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := b.WatchWithContext(ctx, time.Second, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(1)
+	cancel()
+	states := []string{}
+	for msg := range ch {
+		states = append(states, msg.State)
+	}
+	if len(states) == 0 || states[len(states)-1] != "watch_err" {
+		t.Errorf("收到的状态为%v,最后应为watch_err", states)
+	}
+}
+
+func TestBatchWatchNegativeBuffer(t *testing.T) {
+	_, c, _ := newTestClient(t)
+	_, err := NewBatch(c).Watch(time.Second, -1)
+	if err == nil {
+		t.Error("chanBuffer为负数时应返回错误")
+	}
+}
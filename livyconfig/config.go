@@ -0,0 +1,237 @@
+//Package livyconfig 从YAML或TOML文件加载LivyClient的配置和batch,session的提交请求
+//
+//客户端配置文件包含多个命名的profile:
+//
+//	default: prod
+//	profiles:
+//	  prod:
+//	    url: https://livy.prod:8998
+//	    auth: {username: etl, password: "${LIVY_PASSWORD}"}
+//	    tls: {caFile: /etc/pki/internal-ca.pem}
+//	    timeouts: {request: 60s, connect: 5s}
+//	    retry: {maxAttempts: 3, backoff: 500ms}
+//	    conf: {spark.yarn.tags: etl}
+//	    presets:
+//	      large: {driverMemory: 8g, executorMemory: 16g, numExecutors: 64}
+//
+//字段名与json标签相同,字符串值中的环境变量在解析后替换,见Expand
+package livyconfig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	lc "golivyclient"
+)
+
+//ProfileEnv 未指定profile名称时读取的环境变量
+const ProfileEnv = "LIVY_PROFILE"
+
+//Config 客户端配置文件
+type Config struct {
+	//Default 默认使用的profile
+	Default  string              `json:"default,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+//Profile 一个livy服务的客户端配置
+type Profile struct {
+	URL      string    `json:"url"`
+	Auth     *Auth     `json:"auth,omitempty"`
+	TLS      *TLS      `json:"tls,omitempty"`
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+	Retry    *Retry    `json:"retry,omitempty"`
+	//Conf 对应LivyClient.DefaultConf
+	Conf map[string]interface{} `json:"conf,omitempty"`
+	//Presets 对应LivyClient.Presets
+	Presets        map[string]lc.Resources `json:"presets,omitempty"`
+	SkipValidation bool                    `json:"skipValidation,omitempty"`
+}
+
+//Auth 认证方式,设置了Username时使用basic认证,设置了Token时使用Bearer token,Headers会添加到每个请求中
+type Auth struct {
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Token    string            `json:"token,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+//TLS https连接的配置,对应lc.TLSOptions,证书文件变化后会重新加载
+type TLS struct {
+	//CAFile 额外信任的CA证书,PEM格式,会加入系统的证书池
+	CAFile string `json:"caFile,omitempty"`
+	//CertFile和KeyFile 客户端证书和私钥,PEM格式
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	//ServerName 校验证书时使用的服务名,为空时使用url中的主机名
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	//ReloadInterval 检查证书文件是否变化的间隔,见lc.TLSOptions
+	ReloadInterval Duration `json:"reloadInterval,omitempty"`
+}
+
+//Timeouts 超时设置,为0时不限制
+type Timeouts struct {
+	//Request 整个请求的超时,包括读取响应体
+	Request Duration `json:"request,omitempty"`
+	//Connect 建立tcp连接的超时
+	Connect        Duration `json:"connect,omitempty"`
+	TLSHandshake   Duration `json:"tlsHandshake,omitempty"`
+	ResponseHeader Duration `json:"responseHeader,omitempty"`
+}
+
+//Retry 对应lc.RetryPolicy
+type Retry struct {
+	MaxAttempts int      `json:"maxAttempts"`
+	Backoff     Duration `json:"backoff,omitempty"`
+	MaxBackoff  Duration `json:"maxBackoff,omitempty"`
+}
+
+//Load 加载客户端配置文件,格式见FormatOf
+func Load(path string) (*Config, error) {
+	data, format, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return cfg, nil
+}
+
+//Parse 解析客户端配置
+func Parse(data []byte, format Format) (*Config, error) {
+	cfg := new(Config)
+	err := decode(data, format, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for name, p := range cfg.Profiles {
+		if p == nil || p.URL == "" {
+			return nil, fmt.Errorf("profile %s没有设置url", name)
+		}
+	}
+	if cfg.Default != "" && cfg.Profiles[cfg.Default] == nil {
+		return nil, fmt.Errorf("默认的profile %s不存在", cfg.Default)
+	}
+	return cfg, nil
+}
+
+//LoadClient 加载配置文件并创建指定profile的客户端,name的含义见Config.Profile
+func LoadClient(path string, name string) (*lc.LivyClient, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Client(name)
+}
+
+//Profile 查找profile,name为空时依次使用环境变量LIVY_PROFILE,Default和唯一的profile
+func (cfg *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name = cfg.Default
+	}
+	if name == "" {
+		if len(cfg.Profiles) != 1 {
+			return nil, errors.New("有多个profile时需要指定名称或设置default")
+		}
+		for _, p := range cfg.Profiles {
+			return p, nil
+		}
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Profiles))
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %s不存在,可用的profile为%s", name, strings.Join(names, ","))
+	}
+	return p, nil
+}
+
+//Client 使用指定profile创建客户端,name的含义见Profile
+func (cfg *Config) Client(name string) (*lc.LivyClient, error) {
+	p, err := cfg.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Client()
+}
+
+//Client 使用profile创建客户端
+//
+//TLS和超时设置在新的HTTPClient上;认证和重试以中间件的形式添加,重试在认证之外,重试的等待按客户端的Clock计时
+func (p *Profile) Client() (*lc.LivyClient, error) {
+	c := lc.NewClient(strings.TrimSuffix(p.URL, "/"))
+	c.DefaultConf = p.Conf
+	c.Presets = p.Presets
+	c.SkipValidation = p.SkipValidation
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.TLS != nil {
+		c.TLS = p.TLS.options()
+		_, err := c.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.HTTPClient = &http.Client{Transport: transport}
+	if t := p.Timeouts; t != nil {
+		c.HTTPClient.Timeout = time.Duration(t.Request)
+		if t.Connect > 0 {
+			transport.DialContext = (&net.Dialer{Timeout: time.Duration(t.Connect), KeepAlive: 30 * time.Second}).DialContext
+		}
+		transport.TLSHandshakeTimeout = time.Duration(t.TLSHandshake)
+		transport.ResponseHeaderTimeout = time.Duration(t.ResponseHeader)
+	}
+	if r := p.Retry; r != nil && r.MaxAttempts > 1 {
+		c.Use(lc.Retry(lc.RetryPolicy{
+			MaxAttempts: r.MaxAttempts,
+			Backoff:     time.Duration(r.Backoff),
+			MaxBackoff:  time.Duration(r.MaxBackoff),
+		}))
+	}
+	if a := p.Auth; a != nil {
+		if len(a.Headers) > 0 {
+			h := http.Header{}
+			for key, value := range a.Headers {
+				h.Set(key, value)
+			}
+			c.Use(lc.StaticHeaders(h))
+		}
+		switch {
+		case a.Username != "" && a.Token != "":
+			return nil, errors.New("auth不能同时设置username和token")
+		case a.Username != "":
+			c.Use(lc.BasicAuth(a.Username, a.Password))
+		case a.Token != "":
+			c.Use(lc.BearerToken(a.Token))
+		}
+	}
+	return c, nil
+}
+
+func (t *TLS) options() *lc.TLSOptions {
+	o := &lc.TLSOptions{
+		CAFile:             t.CAFile,
+		SystemRoots:        true,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		ReloadInterval:     time.Duration(t.ReloadInterval),
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		o.Certificates = []lc.CertKeyPair{{CertFile: t.CertFile, KeyFile: t.KeyFile}}
+	}
+	return o
+}
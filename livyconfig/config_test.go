@@ -0,0 +1,249 @@
+package livyconfig
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	lc "golivyclient"
+	"golivyclient/livytest"
+)
+
+//headerServer 记录每个请求的请求头,前fail个请求返回503
+func headerServer(t *testing.T, fail int) (*httptest.Server, func() []http.Header) {
+	t.Helper()
+	var mu sync.Mutex
+	headers := []http.Header{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		n := len(headers)
+		mu.Unlock()
+		if n <= fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"from":0,"total":0,"sessions":[]}`))
+	}))
+	t.Cleanup(s.Close)
+	return s, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]http.Header{}, headers...)
+	}
+}
+
+func writeFile(t *testing.T, name string, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(data), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadClientYAML(t *testing.T) {
+	s, headers := headerServer(t, 2)
+	t.Setenv("LIVY_TEST_URL", s.URL)
+	t.Setenv("LIVY_TEST_PASSWORD", "secret")
+	path := writeFile(t, "livy.yaml", `
+default: prod
+profiles:
+  prod:
+    url: ${LIVY_TEST_URL}/
+    auth:
+      username: etl
+      password: ${LIVY_TEST_PASSWORD}
+      headers: {X-Team: data}
+    timeouts: {request: 60s, connect: 5s, tlsHandshake: 3, responseHeader: 1m}
+    retry: {maxAttempts: 3, backoff: 500ms, maxBackoff: 2s}
+    conf: {spark.yarn.tags: etl}
+    presets:
+      large: {driverMemory: 8g, executorMemory: 16g, numExecutors: 64}
+    skipValidation: true
+  dev:
+    url: http://localhost:8998
+`)
+	c, err := LoadClient(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.BASEURL != s.URL {
+		t.Errorf("BASEURL为%s", c.BASEURL)
+	}
+	if c.DefaultConf["spark.yarn.tags"] != "etl" || !c.SkipValidation {
+		t.Errorf("DefaultConf为%v,SkipValidation为%v", c.DefaultConf, c.SkipValidation)
+	}
+	if p := c.Presets["large"]; p.DriverMemory != 8*lc.GB || p.ExecutorMemory != 16*lc.GB || p.NumExecutors != 64 {
+		t.Errorf("large预设为%+v", p)
+	}
+	if c.HTTPClient.Timeout != time.Minute {
+		t.Errorf("请求超时为%s", c.HTTPClient.Timeout)
+	}
+	transport := c.HTTPClient.Transport.(*http.Transport)
+	if transport.TLSHandshakeTimeout != 3*time.Second || transport.ResponseHeaderTimeout != time.Minute {
+		t.Errorf("TLSHandshakeTimeout为%s,ResponseHeaderTimeout为%s", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+
+	//重试按客户端的Clock等待
+	clock := livytest.NewFakeClock(time.Unix(0, 0))
+	c.Clock = clock
+	done := make(chan error)
+	go func() {
+		_, err := c.HTTPJSONQuery(c.BASEURL+"/batches", http.MethodGet)
+		done <- err
+	}()
+	for _, d := range []time.Duration{500 * time.Millisecond, time.Second} {
+		clock.BlockUntil(1)
+		clock.Advance(d)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	got := headers()
+	if len(got) != 3 {
+		t.Fatalf("请求了%d次,应为3次", len(got))
+	}
+	for _, h := range got {
+		user, password, ok := (&http.Request{Header: h}).BasicAuth()
+		if !ok || user != "etl" || password != "secret" || h.Get("X-Team") != "data" {
+			t.Errorf("请求头为%v", h)
+		}
+	}
+}
+
+func TestParseTOMLToken(t *testing.T) {
+	s, headers := headerServer(t, 0)
+	cfg, err := Parse([]byte(`
+[profiles.prod]
+url = "`+s.URL+`"
+
+[profiles.prod.auth]
+token = "abc"
+
+[profiles.prod.timeouts]
+request = "30s"
+`), TOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cfg.Client("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.HTTPClient.Timeout != 30*time.Second {
+		t.Errorf("请求超时为%s", c.HTTPClient.Timeout)
+	}
+	_, err = c.HTTPJSONQuery(c.BASEURL+"/batches", http.MethodGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := headers(); len(got) != 1 || got[0].Get("Authorization") != "Bearer abc" {
+		t.Errorf("请求头为%v", got)
+	}
+}
+
+func TestProfileTLS(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+	ca := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})))
+	cfg, err := Parse([]byte(`
+profiles:
+  prod:
+    url: `+s.URL+`
+    tls: {caFile: `+ca+`, reloadInterval: -1s}
+`), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cfg.Client("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TLS == nil || c.TLS.CAFile != ca || !c.TLS.SystemRoots || c.TLS.ReloadInterval != -time.Second {
+		t.Errorf("TLS为%+v", c.TLS)
+	}
+	_, err = c.HTTPJSONQuery(s.URL+"/batches", http.MethodGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Profiles["prod"].TLS.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := cfg.Client("prod"); err == nil {
+		t.Error("CA证书不存在时应返回错误")
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	cases := map[string]string{
+		"没有url":        "profiles:\n  prod: {auth: {token: x}}\n",
+		"默认profile不存在": "default: dev\nprofiles:\n  prod: {url: http://a}\n",
+		"未知的字段":        "profiles:\n  prod: {url: http://a, timeout: 3s}\n",
+		"时间格式错误":       "profiles:\n  prod: {url: http://a, timeouts: {request: soon}}\n",
+	}
+	for name, data := range cases {
+		if _, err := Parse([]byte(data), YAML); err == nil {
+			t.Errorf("%s时应返回错误", name)
+		}
+	}
+
+	cfg, err := Parse([]byte(`
+profiles:
+  a: {url: "http://a", auth: {username: u, token: t}}
+  b: {url: "http://b"}
+`), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Client("a"); err == nil {
+		t.Error("同时设置username和token时应返回错误")
+	}
+	if _, err := cfg.Profile(""); err == nil {
+		t.Error("有多个profile且没有default时应返回错误")
+	}
+	if _, err := cfg.Profile("c"); err == nil {
+		t.Error("profile不存在时应返回错误")
+	}
+	t.Setenv(ProfileEnv, "b")
+	if p, err := cfg.Profile(""); err != nil || p.URL != "http://b" {
+		t.Errorf("应使用%s指定的profile,得到%+v,%v", ProfileEnv, p, err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "livy.json")); err == nil {
+		t.Error("未知的扩展名应返回错误")
+	}
+}
+
+func TestLoadBatchTOML(t *testing.T) {
+	path := writeFile(t, "job.toml", `
+file = "hdfs:///app.jar"
+className = "Main"
+args = ["a", "b"]
+numExecutors = 4
+
+[conf]
+"spark.sql.shuffle.partitions" = 200
+`)
+	q, err := LoadBatch(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.File != "hdfs:///app.jar" || q.ClassName != "Main" || len(q.Args) != 2 || q.NumExecutors != 4 {
+		t.Errorf("解析结果为%+v", q)
+	}
+	if v, ok := q.Conf["spark.sql.shuffle.partitions"]; !ok || v == nil {
+		t.Errorf("Conf为%v", q.Conf)
+	}
+	s, err := ParseSession([]byte("kind: pyspark\nheartbeatTimeoutInSecond: 60\n"), YAML)
+	if err != nil || s.Kind != lc.KindPySpark || s.HeartbeatTimeoutInSecond != 60 {
+		t.Errorf("解析结果为%+v,%v", s, err)
+	}
+}
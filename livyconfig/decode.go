@@ -0,0 +1,240 @@
+package livyconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+//Format 配置文件的格式
+type Format string
+
+//支持的格式
+const (
+	YAML Format = "yaml"
+	TOML Format = "toml"
+)
+
+//FormatOf 根据扩展名判断文件格式,.yaml和.yml为YAML,.toml为TOML
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".toml":
+		return TOML, nil
+	}
+	return "", fmt.Errorf("无法根据扩展名判断配置文件格式:%s", path)
+}
+
+//readFile 读取文件并根据扩展名判断格式
+func readFile(path string) ([]byte, Format, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, format, nil
+}
+
+//decode 解析并替换环境变量后解码到v中
+//
+//yaml和toml先解析为通用的值再转为json,字段名与json标签一致,如proxyUser,driverMemory;未知的字段会返回错误。
+//环境变量只在字符串值中替换,见Expand;yaml中没有引号的值在替换后按yaml的规则重新推断类型,
+//因此maxAttempts: ${RETRIES}可以得到数字,加了引号的值总是字符串
+func decode(data []byte, format Format, v interface{}) error {
+	var raw interface{}
+	var err error
+	switch format {
+	case YAML:
+		var node yaml.Node
+		err = yaml.Unmarshal(data, &node)
+		if err == nil {
+			err = expandNode(&node)
+			if err != nil {
+				return err
+			}
+			err = node.Decode(&raw)
+		}
+	case TOML:
+		var m map[string]interface{}
+		_, err = toml.Decode(string(data), &m)
+		if err == nil {
+			err = expandValues(m)
+			if err != nil {
+				return err
+			}
+		}
+		raw = m
+	default:
+		return fmt.Errorf("未知的配置文件格式:%s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("解析%s失败:%w", format, err)
+	}
+	raw, err = normalize(raw)
+	if err != nil {
+		return err
+	}
+	bs, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("配置格式错误:%w", err)
+	}
+	return nil
+}
+
+//expandNode 替换yaml中字符串值的环境变量,mapping的key不替换
+func expandNode(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range n.Content {
+			if err := expandNode(child); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandNode(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if n.ShortTag() != "!!str" || !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		value, err := Expand(n.Value)
+		if err != nil {
+			return fmt.Errorf("第%d行:%w", n.Line, err)
+		}
+		n.Value = value
+		if n.Style == 0 {
+			//没有引号的值重新推断类型
+			n.Tag = ""
+		}
+	}
+	return nil
+}
+
+//expandValues 替换toml解析结果中字符串值的环境变量,toml中引用环境变量的值都是字符串
+func expandValues(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if str, ok := value.(string); ok {
+				nv, err := Expand(str)
+				if err != nil {
+					return fmt.Errorf("%s:%w", key, err)
+				}
+				v[key] = nv
+				continue
+			}
+			if err := expandValues(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, ele := range v {
+			if str, ok := ele.(string); ok {
+				nv, err := Expand(str)
+				if err != nil {
+					return err
+				}
+				v[i] = nv
+				continue
+			}
+			if err := expandValues(ele); err != nil {
+				return err
+			}
+		}
+	case []map[string]interface{}:
+		for _, ele := range v {
+			if err := expandValues(ele); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//normalize yaml中的非字符串key转为字符串,以便转为json
+func normalize(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			nv, err := normalize(value)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = nv
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			nv, err := normalize(value)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key)] = nv
+		}
+		return m, nil
+	case []interface{}:
+		for i, ele := range v {
+			nv, err := normalize(ele)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = nv
+		}
+		return v, nil
+	case []map[string]interface{}:
+		res := make([]interface{}, len(v))
+		for i, ele := range v {
+			res[i] = ele
+		}
+		return normalize(res)
+	}
+	return v, nil
+}
+
+//Duration 配置中的时间长度,可以写为"30s","1m30s"这样的字符串或表示秒数的数字
+type Duration time.Duration
+
+//UnmarshalJSON 实现json.Unmarshaler
+func (d *Duration) UnmarshalJSON(bs []byte) error {
+	var s string
+	if json.Unmarshal(bs, &s) == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("时间格式错误:%q", s)
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var seconds float64
+	if err := json.Unmarshal(bs, &seconds); err != nil {
+		return fmt.Errorf("时间格式错误:%s", bs)
+	}
+	*d = Duration(seconds * float64(time.Second))
+	return nil
+}
+
+//MarshalJSON 实现json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
@@ -0,0 +1,58 @@
+package livyconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+//Expand 替换字符串中的环境变量,配置文件在解析之后对每个字符串值调用它,注释和key不受影响
+//
+//${NAME}替换为环境变量NAME的值,${NAME:-default}在NAME未设置或为空时使用default,
+//$${写出字面的${;引用了未设置且没有默认值的环境变量时返回错误
+func Expand(text string) (string, error) {
+	return expand(text, os.LookupEnv)
+}
+
+func expand(text string, lookup func(string) (string, bool)) (string, error) {
+	var sb strings.Builder
+	missing := []string{}
+	for {
+		i := strings.Index(text, "${")
+		if i < 0 {
+			sb.WriteString(text)
+			break
+		}
+		if i > 0 && text[i-1] == '$' {
+			sb.WriteString(text[:i-1])
+			sb.WriteString("${")
+			text = text[i+2:]
+			continue
+		}
+		sb.WriteString(text[:i])
+		end := strings.IndexByte(text[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("环境变量引用没有结束的}:%q", text[i:])
+		}
+		expr := text[i+2 : i+end]
+		text = text[i+end+1:]
+		name, def, hasDefault := strings.Cut(expr, ":-")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return "", fmt.Errorf("环境变量名不能为空:${%s}", expr)
+		}
+		value, ok := lookup(name)
+		switch {
+		case ok && (value != "" || !hasDefault):
+			sb.WriteString(value)
+		case hasDefault:
+			sb.WriteString(def)
+		default:
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("环境变量未设置:%s", strings.Join(missing, ","))
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,66 @@
+package livyconfig
+
+import (
+	"testing"
+)
+
+func TestParseBatchExpandsEnv(t *testing.T) {
+	t.Setenv("LIVY_TEST_FILE", "hdfs:///app.jar")
+	t.Setenv("LIVY_TEST_EXECUTORS", "4")
+	data := []byte(`# 注释中的${LIVY_TEST_UNSET}不会被替换
+file: ${LIVY_TEST_FILE}
+numExecutors: ${LIVY_TEST_EXECUTORS}
+name: "$${literal}"
+queue: ${LIVY_TEST_UNSET:-default}
+`)
+	q, err := ParseBatch(data, YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.File != "hdfs:///app.jar" || q.NumExecutors != 4 || q.Name != "${literal}" || q.Queue != "default" {
+		t.Errorf("解析结果为%+v", q)
+	}
+
+	q, err = ParseBatch([]byte(`file = "${LIVY_TEST_FILE}"
+name = "$${literal}"
+`), TOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.File != "hdfs:///app.jar" || q.Name != "${literal}" {
+		t.Errorf("解析结果为%+v", q)
+	}
+
+	_, err = ParseBatch([]byte("file: ${LIVY_TEST_UNSET}\n"), YAML)
+	if err == nil {
+		t.Error("引用未设置的环境变量时应返回错误")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{"A": "1", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	cases := map[string]string{
+		"x${A}y":          "x1y",
+		"${EMPTY}":        "",
+		"${EMPTY:-d}":     "d",
+		"${UNSET:-d}":     "d",
+		"$${A}":           "${A}",
+		"$$${A}":          "$${A}",
+		"no placeholders": "no placeholders",
+	}
+	for text, want := range cases {
+		got, err := expand(text, lookup)
+		if err != nil || got != want {
+			t.Errorf("expand(%q)为%q,%v,应为%q", text, got, err, want)
+		}
+	}
+	for _, text := range []string{"${UNSET}", "${A", "${}"} {
+		if _, err := expand(text, lookup); err == nil {
+			t.Errorf("expand(%q)应返回错误", text)
+		}
+	}
+}
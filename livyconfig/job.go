@@ -0,0 +1,62 @@
+package livyconfig
+
+import (
+	"fmt"
+
+	lc "golivyclient"
+)
+
+//LoadBatch 加载batch的提交请求,字段名与NewBatchQuery的json标签相同,如
+//
+//	file: hdfs:///jobs/etl-${ETL_VERSION}.jar
+//	className: com.example.ETL
+//	args: ["--date", "${RUN_DATE}"]
+//	queue: ${QUEUE:-default}
+//	conf:
+//	  spark.sql.shuffle.partitions: 200
+//
+//加载时不调用Validate,提交时由Batch.New校验
+func LoadBatch(path string) (*lc.NewBatchQuery, error) {
+	data, format, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	q, err := ParseBatch(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return q, nil
+}
+
+//ParseBatch 解析batch的提交请求,见LoadBatch
+func ParseBatch(data []byte, format Format) (*lc.NewBatchQuery, error) {
+	q := new(lc.NewBatchQuery)
+	err := decode(data, format, q)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+//LoadSession 加载session的创建请求,字段名与NewSessionQuery的json标签相同,见LoadBatch
+func LoadSession(path string) (*lc.NewSessionQuery, error) {
+	data, format, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	q, err := ParseSession(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return q, nil
+}
+
+//ParseSession 解析session的创建请求,见LoadSession
+func ParseSession(data []byte, format Format) (*lc.NewSessionQuery, error) {
+	q := new(lc.NewSessionQuery)
+	err := decode(data, format, q)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
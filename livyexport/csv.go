@@ -0,0 +1,122 @@
+package livyexport
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	lc "golivyclient"
+)
+
+//CSVWriter 写出带表头的CSV
+//
+//整数和decimal保持原样,浮点数使用最短表示,NaN和无穷为NaN,Infinity和-Infinity,
+//timestamp为RFC3339格式的UTC时间,date为2006-01-02格式,复杂类型为json
+type CSVWriter struct {
+	//Comma 分隔符,为0时使用逗号
+	Comma rune
+	//NullString null写出的内容,默认为空字符串
+	NullString string
+	//NoHeader 为true时不写出表头
+	NoHeader bool
+
+	w       *csv.Writer
+	output  io.Writer
+	columns []lc.TableColumn
+	record  []string
+}
+
+//NewCSVWriter 创建写出到w的CSVWriter
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	c := new(CSVWriter)
+	c.output = w
+	return c
+}
+
+//WriteCSV 将表格结果写出为CSV
+func WriteCSV(w io.Writer, t *lc.TableResult) error {
+	return WriteTable(NewCSVWriter(w), t)
+}
+
+//Begin 实现Writer
+func (c *CSVWriter) Begin(columns []lc.TableColumn) error {
+	if c.w != nil {
+		return errors.New("Begin只能调用一次")
+	}
+	c.w = csv.NewWriter(c.output)
+	if c.Comma != 0 {
+		c.w.Comma = c.Comma
+	}
+	c.columns = columns
+	c.record = make([]string, len(columns))
+	if c.NoHeader {
+		return nil
+	}
+	for i, col := range columns {
+		c.record[i] = col.Name
+	}
+	return c.w.Write(c.record)
+}
+
+//WriteRow 实现Writer
+func (c *CSVWriter) WriteRow(row []interface{}) error {
+	if c.w == nil {
+		return errors.New("需要先调用Begin")
+	}
+	if err := checkRow(c.columns, row); err != nil {
+		return err
+	}
+	for i, col := range c.columns {
+		s, err := c.format(col, row[i])
+		if err != nil {
+			return err
+		}
+		c.record[i] = s
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *CSVWriter) format(col lc.TableColumn, raw interface{}) (string, error) {
+	v, err := value(col, raw)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case nil:
+		return c.NullString, nil
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN", nil
+		case math.IsInf(v, 1):
+			return "Infinity", nil
+		case math.IsInf(v, -1):
+			return "-Infinity", nil
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		if col.BaseType() == "date" {
+			return v.Format("2006-01-02"), nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	}
+	return marshalComplex(v)
+}
+
+//Close 实现Writer
+func (c *CSVWriter) Close() error {
+	if c.w == nil {
+		return nil
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
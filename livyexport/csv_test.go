@@ -0,0 +1,37 @@
+package livyexport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteCSV(buf, newTable(t, exportColumns, exportRows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `id,score,amount,ok,ts,day,name,tags
+9007199254740993,0.1,12.30,true,2024-01-02T03:04:05.5Z,2024-01-02,"a,""b""","[1,2.50]"
+-1,NaN,-0.05,false,2024-01-02T03:04:05Z,1969-12-31,,[]
+,-Infinity,,,2024-01-02T03:04:05Z,,,
+`
+	if buf.String() != want {
+		t.Errorf("输出为\n%s\n应为\n%s", buf.String(), want)
+	}
+}
+
+func TestCSVWriterOptions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewCSVWriter(buf)
+	w.Comma = ';'
+	w.NullString = `\N`
+	w.NoHeader = true
+	err := WriteTable(w, newTable(t, `[{"name":"a","type":"string"},{"name":"b","type":"float"}]`, `[["x;y",null],[null,"Infinity"]]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\"x;y\";\\N\n\\N;Infinity\n"; buf.String() != want {
+		t.Errorf("输出为%q,应为%q", buf.String(), want)
+	}
+}
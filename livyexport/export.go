@@ -0,0 +1,89 @@
+//Package livyexport 将statement的表格结果导出为CSV,NDJSON和Parquet
+//
+//一次性的结果使用WriteTable,Session.Collect返回的分页结果使用WriteRows流式写出:
+//
+//	it, err := session.Collect(ctx, "spark.table(\"events\")", 10000)
+//	defer it.Close()
+//	err = livyexport.WriteRows(livyexport.NewParquetWriter(f), it)
+package livyexport
+
+import (
+	jsonl "encoding/json"
+	"fmt"
+	"time"
+
+	lc "golivyclient"
+)
+
+//Writer 表格结果的写出格式
+type Writer interface {
+	//Begin 写出数据前调用一次,columns为结果的列
+	Begin(columns []lc.TableColumn) error
+	//WriteRow 写出一行,row中的数字为json.Number
+	WriteRow(row []interface{}) error
+	//Close 写出缓冲的数据和文件尾,不会关闭底层的io.Writer
+	Close() error
+}
+
+//WriteTable 将表格结果写出到w并关闭w
+func WriteTable(w Writer, t *lc.TableResult) error {
+	err := w.Begin(t.Columns)
+	if err != nil {
+		return err
+	}
+	for i, row := range t.Rows {
+		err = w.WriteRow(row)
+		if err != nil {
+			return fmt.Errorf("第%d行:%w", i, err)
+		}
+	}
+	return w.Close()
+}
+
+//WriteRows 将分页结果逐行写出到w并关闭w,不会关闭it
+func WriteRows(w Writer, it *lc.RowIterator) error {
+	err := w.Begin(it.Columns())
+	if err != nil {
+		return err
+	}
+	n := 0
+	for it.Next() {
+		err = w.WriteRow(it.Row())
+		if err != nil {
+			return fmt.Errorf("第%d行:%w", n, err)
+		}
+		n++
+	}
+	if err = it.Err(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+//value 将表格中的值转为Go的值,日期和时间转为time.Time,复杂类型保持json解码后的值
+func value(col lc.TableColumn, raw interface{}) (interface{}, error) {
+	v, err := col.Value(raw)
+	if err != nil {
+		return nil, err
+	}
+	if tm, ok := v.(time.Time); ok {
+		return tm.UTC(), nil
+	}
+	return v, nil
+}
+
+//marshalComplex 将数组,map和struct类型的值编码为json
+func marshalComplex(v interface{}) (string, error) {
+	bs, err := jsonl.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func checkRow(columns []lc.TableColumn, row []interface{}) error {
+	if len(row) != len(columns) {
+		return fmt.Errorf("结果有%d列,但该行有%d个值", len(columns), len(row))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package livyexport
+
+import (
+	"bytes"
+	jsonl "encoding/json"
+	"strings"
+	"testing"
+
+	lc "golivyclient"
+)
+
+//newTable 解析列和行,行中的数字为json.Number
+func newTable(t *testing.T, columns string, rows string) *lc.TableResult {
+	t.Helper()
+	res := new(lc.TableResult)
+	if err := jsonl.Unmarshal([]byte(columns), &res.Columns); err != nil {
+		t.Fatal(err)
+	}
+	dec := jsonl.NewDecoder(strings.NewReader(rows))
+	dec.UseNumber()
+	if err := dec.Decode(&res.Rows); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+const exportColumns = `[{"name":"id","type":"long"},{"name":"score","type":"double"},{"name":"amount","type":"decimal(10,2)"},
+	{"name":"ok","type":"boolean"},{"name":"ts","type":"timestamp"},{"name":"day","type":"date"},
+	{"name":"name","type":"string"},{"name":"tags","type":"array"}]`
+
+const exportRows = `[
+	[9007199254740993,0.1,12.30,true,"2024-01-02 03:04:05.5","2024-01-02","a,\"b\"",[1,2.50]],
+	[-1,"NaN",-0.05,false,"2024-01-02T11:04:05+08:00","1969-12-31","",[]],
+	[null,"-Infinity",null,null,1704164645000,null,null,null]]`
+
+func TestWriteTableErrors(t *testing.T) {
+	table := newTable(t, `[{"name":"a","type":"long"},{"name":"b","type":"long"}]`, `[[1,2],[3]]`)
+	writers := map[string]Writer{
+		"csv":     NewCSVWriter(&bytes.Buffer{}),
+		"ndjson":  NewNDJSONWriter(&bytes.Buffer{}),
+		"parquet": NewParquetWriter(&bytes.Buffer{}),
+	}
+	for name, w := range writers {
+		if err := w.WriteRow([]interface{}{1, 2}); err == nil {
+			t.Errorf("%s:Begin之前WriteRow应返回错误", name)
+		}
+		err := WriteTable(w, table)
+		if err == nil || !strings.HasPrefix(err.Error(), "第1行:") {
+			t.Errorf("%s:列数不一致时应返回行号,err为%v", name, err)
+		}
+		if err := w.Begin(table.Columns); err == nil {
+			t.Errorf("%s:重复调用Begin应返回错误", name)
+		}
+	}
+	bad := newTable(t, `[{"name":"a","type":"long"}]`, `[["x"]]`)
+	for name, w := range map[string]Writer{"csv": NewCSVWriter(&bytes.Buffer{}), "parquet": NewParquetWriter(&bytes.Buffer{})} {
+		if err := WriteTable(w, bad); err == nil {
+			t.Errorf("%s:long列的值不是数字时应返回错误", name)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package livyexport
+
+import (
+	"bufio"
+	jsonl "encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	lc "golivyclient"
+)
+
+//NDJSONWriter 每行写出一个json对象,对象的key按列的顺序排列
+//
+//数字保持原始精度,timestamp为RFC3339格式的UTC时间,date为2006-01-02格式
+type NDJSONWriter struct {
+	w       *bufio.Writer
+	columns []lc.TableColumn
+	keys    [][]byte
+}
+
+//NewNDJSONWriter 创建写出到w的NDJSONWriter
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	n := new(NDJSONWriter)
+	n.w = bufio.NewWriter(w)
+	return n
+}
+
+//WriteNDJSON 将表格结果写出为NDJSON
+func WriteNDJSON(w io.Writer, t *lc.TableResult) error {
+	return WriteTable(NewNDJSONWriter(w), t)
+}
+
+//Begin 实现Writer
+func (n *NDJSONWriter) Begin(columns []lc.TableColumn) error {
+	if n.keys != nil {
+		return errors.New("Begin只能调用一次")
+	}
+	n.columns = columns
+	n.keys = make([][]byte, len(columns))
+	for i, col := range columns {
+		key, err := jsonl.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		n.keys[i] = key
+	}
+	return nil
+}
+
+//WriteRow 实现Writer
+func (n *NDJSONWriter) WriteRow(row []interface{}) error {
+	if n.keys == nil {
+		return errors.New("需要先调用Begin")
+	}
+	if err := checkRow(n.columns, row); err != nil {
+		return err
+	}
+	n.w.WriteByte('{')
+	for i, col := range n.columns {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		n.w.Write(n.keys[i])
+		n.w.WriteByte(':')
+		v := row[i]
+		switch col.BaseType() {
+		case "timestamp", "date":
+			tv, err := value(col, v)
+			if err != nil {
+				return err
+			}
+			if tm, ok := tv.(time.Time); ok {
+				if col.BaseType() == "date" {
+					v = tm.Format("2006-01-02")
+				} else {
+					v = tm.Format(time.RFC3339Nano)
+				}
+			}
+		}
+		bs, err := jsonl.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n.w.Write(bs)
+	}
+	n.w.WriteByte('}')
+	return n.w.WriteByte('\n')
+}
+
+//Close 实现Writer
+func (n *NDJSONWriter) Close() error {
+	return n.w.Flush()
+}
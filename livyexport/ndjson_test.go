@@ -0,0 +1,29 @@
+package livyexport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteNDJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteNDJSON(buf, newTable(t, exportColumns, exportRows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//数字保持原始精度,key按列的顺序
+	want := `{"id":9007199254740993,"score":0.1,"amount":12.30,"ok":true,"ts":"2024-01-02T03:04:05.5Z","day":"2024-01-02","name":"a,\"b\"","tags":[1,2.50]}
+{"id":-1,"score":"NaN","amount":-0.05,"ok":false,"ts":"2024-01-02T03:04:05Z","day":"1969-12-31","name":"","tags":[]}
+{"id":null,"score":"-Infinity","amount":null,"ok":null,"ts":"2024-01-02T03:04:05Z","day":null,"name":null,"tags":null}
+`
+	if buf.String() != want {
+		t.Errorf("输出为\n%s\n应为\n%s", buf.String(), want)
+	}
+}
+
+func TestNDJSONInvalidTime(t *testing.T) {
+	err := WriteNDJSON(&bytes.Buffer{}, newTable(t, `[{"name":"ts","type":"timestamp"}]`, `[["yesterday"]]`))
+	if err == nil {
+		t.Error("时间格式错误时应返回错误")
+	}
+}
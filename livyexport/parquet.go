@@ -0,0 +1,234 @@
+package livyexport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	lc "golivyclient"
+)
+
+//ParquetWriter 写出Parquet文件,所有列都是optional
+//
+//long,integer,short,byte,double,float,boolean,string,date和timestamp(微秒,UTC)写出为对应的Parquet类型,
+//带精度的decimal写出为DECIMAL,没有精度的decimal和复杂类型写出为字符串(复杂类型为json)
+type ParquetWriter struct {
+	output  io.Writer
+	w       *parquet.Writer
+	columns []parquetColumn
+	row     parquet.Row
+}
+
+type parquetColumn struct {
+	col lc.TableColumn
+	//index 列在Parquet schema中的位置,schema中的列按名称排序
+	index     int
+	precision int
+	scale     int
+}
+
+//NewParquetWriter 创建写出到w的ParquetWriter
+func NewParquetWriter(w io.Writer) *ParquetWriter {
+	p := new(ParquetWriter)
+	p.output = w
+	return p
+}
+
+//WriteParquet 将表格结果写出为Parquet
+func WriteParquet(w io.Writer, t *lc.TableResult) error {
+	return WriteTable(NewParquetWriter(w), t)
+}
+
+var decimalType = regexp.MustCompile(`^\s*(?i:decimal)\s*\(\s*(\d+)\s*,\s*(\d+)\s*\)\s*$`)
+
+//Begin 实现Writer
+func (p *ParquetWriter) Begin(columns []lc.TableColumn) error {
+	if p.w != nil {
+		return errors.New("Begin只能调用一次")
+	}
+	group := parquet.Group{}
+	p.columns = make([]parquetColumn, len(columns))
+	for i, col := range columns {
+		if _, ok := group[col.Name]; ok {
+			return fmt.Errorf("结果中有重复的列%s", col.Name)
+		}
+		pc := parquetColumn{col: col}
+		var node parquet.Node
+		switch col.BaseType() {
+		case "long":
+			node = parquet.Int(64)
+		case "integer":
+			node = parquet.Int(32)
+		case "short":
+			node = parquet.Int(16)
+		case "byte":
+			node = parquet.Int(8)
+		case "double":
+			node = parquet.Leaf(parquet.DoubleType)
+		case "float":
+			node = parquet.Leaf(parquet.FloatType)
+		case "boolean":
+			node = parquet.Leaf(parquet.BooleanType)
+		case "date":
+			node = parquet.Date()
+		case "timestamp":
+			node = parquet.Timestamp(parquet.Microsecond)
+		case "decimal":
+			m := decimalType.FindStringSubmatch(col.Type)
+			if m == nil {
+				node = parquet.String()
+				break
+			}
+			pc.precision, _ = strconv.Atoi(m[1])
+			pc.scale, _ = strconv.Atoi(m[2])
+			if pc.precision <= 18 {
+				node = parquet.Decimal(pc.scale, pc.precision, parquet.Int64Type)
+			} else {
+				node = parquet.Decimal(pc.scale, pc.precision, parquet.FixedLenByteArrayType(decimalBytes(pc.precision)))
+			}
+		default:
+			node = parquet.String()
+		}
+		group[col.Name] = parquet.Optional(node)
+		p.columns[i] = pc
+	}
+	schema := parquet.NewSchema("livy", group)
+	index := map[string]int{}
+	for i, path := range schema.Columns() {
+		index[path[0]] = i
+	}
+	for i := range p.columns {
+		p.columns[i].index = index[p.columns[i].col.Name]
+	}
+	config, err := parquet.NewWriterConfig(schema)
+	if err != nil {
+		return err
+	}
+	p.w = parquet.NewWriter(p.output, config)
+	p.row = make(parquet.Row, len(columns))
+	return nil
+}
+
+//decimalBytes 保存precision位十进制数需要的字节数
+func decimalBytes(precision int) int {
+	return int(math.Ceil((float64(precision)*math.Log2(10) + 1) / 8))
+}
+
+//WriteRow 实现Writer
+func (p *ParquetWriter) WriteRow(row []interface{}) error {
+	if p.w == nil {
+		return errors.New("需要先调用Begin")
+	}
+	if len(row) != len(p.columns) {
+		return fmt.Errorf("结果有%d列,但该行有%d个值", len(p.columns), len(row))
+	}
+	for i, pc := range p.columns {
+		v, err := p.value(pc, row[i])
+		if err != nil {
+			return err
+		}
+		def := 1
+		if v.IsNull() {
+			def = 0
+		}
+		p.row[pc.index] = v.Level(0, def, pc.index)
+	}
+	_, err := p.w.WriteRows([]parquet.Row{p.row})
+	return err
+}
+
+func (p *ParquetWriter) value(pc parquetColumn, raw interface{}) (parquet.Value, error) {
+	v, err := value(pc.col, raw)
+	if err != nil || v == nil {
+		return parquet.NullValue(), err
+	}
+	switch pc.col.BaseType() {
+	case "long":
+		return parquet.Int64Value(v.(int64)), nil
+	case "integer", "short", "byte":
+		n := v.(int64)
+		limit := intLimits[pc.col.BaseType()]
+		if n < -limit-1 || n > limit {
+			return parquet.NullValue(), fmt.Errorf("列%s的值%d超出%s的范围", pc.col.Name, n, pc.col.BaseType())
+		}
+		return parquet.Int32Value(int32(n)), nil
+	case "double":
+		return parquet.DoubleValue(v.(float64)), nil
+	case "float":
+		return parquet.FloatValue(float32(v.(float64))), nil
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return parquet.NullValue(), fmt.Errorf("列%s的值%v不是布尔值", pc.col.Name, v)
+		}
+		return parquet.BooleanValue(b), nil
+	case "date":
+		tm := v.(time.Time)
+		days := tm.Unix() / 86400
+		if tm.Unix() < 0 && tm.Unix()%86400 != 0 {
+			days--
+		}
+		return parquet.Int32Value(int32(days)), nil
+	case "timestamp":
+		return parquet.Int64Value(v.(time.Time).UnixMicro()), nil
+	case "decimal":
+		if pc.precision == 0 {
+			return parquet.ByteArrayValue([]byte(v.(string))), nil
+		}
+		return decimalValue(pc, v.(string))
+	}
+	if s, ok := v.(string); ok {
+		return parquet.ByteArrayValue([]byte(s)), nil
+	}
+	s, err := marshalComplex(v)
+	if err != nil {
+		return parquet.NullValue(), err
+	}
+	return parquet.ByteArrayValue([]byte(s)), nil
+}
+
+//intLimits 写出为INT32的整数类型的最大值
+var intLimits = map[string]int64{"integer": math.MaxInt32, "short": math.MaxInt16, "byte": math.MaxInt8}
+
+//decimalValue 将decimal转为放大10^scale倍后的整数,precision不超过18时为INT64,否则为大端补码
+func decimalValue(pc parquetColumn, text string) (parquet.Value, error) {
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return parquet.NullValue(), fmt.Errorf("列%s的值%s不是合法的decimal", pc.col.Name, text)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(pc.scale)), nil)))
+	if !r.IsInt() {
+		return parquet.NullValue(), fmt.Errorf("列%s的值%s的小数位数超过%d", pc.col.Name, text, pc.scale)
+	}
+	unscaled := r.Num()
+	if new(big.Int).Abs(unscaled).Cmp(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(pc.precision)), nil)) >= 0 {
+		return parquet.NullValue(), fmt.Errorf("列%s的值%s超出精度%d", pc.col.Name, text, pc.precision)
+	}
+	if pc.precision <= 18 {
+		return parquet.Int64Value(unscaled.Int64()), nil
+	}
+	size := decimalBytes(pc.precision)
+	bs := make([]byte, size)
+	if unscaled.Sign() >= 0 {
+		unscaled.FillBytes(bs)
+	} else {
+		//负数的补码为2^(8*size)加上该数
+		mod := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+		mod.Add(mod, unscaled).FillBytes(bs)
+	}
+	return parquet.FixedLenByteArrayValue(bs), nil
+}
+
+//Close 实现Writer
+func (p *ParquetWriter) Close() error {
+	if p.w == nil {
+		return nil
+	}
+	return p.w.Close()
+}
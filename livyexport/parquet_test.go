@@ -0,0 +1,164 @@
+package livyexport
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+//readParquet 读出Parquet文件的schema和每一行,行中的值按列名索引
+func readParquet(t *testing.T, data []byte) (*parquet.Schema, []map[string]parquet.Value) {
+	t.Helper()
+	r := parquet.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	schema := r.Schema()
+	names := map[int]string{}
+	for i, path := range schema.Columns() {
+		names[i] = path[0]
+	}
+	res := []map[string]parquet.Value{}
+	rows := make([]parquet.Row, 1)
+	for {
+		n, err := r.ReadRows(rows)
+		if n == 1 {
+			row := map[string]parquet.Value{}
+			for _, v := range rows[0] {
+				row[names[v.Column()]] = v.Clone()
+			}
+			res = append(res, row)
+		}
+		if err == io.EOF {
+			return schema, res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+//unscaled 将大端补码的decimal还原为整数
+func unscaled(bs []byte) *big.Int {
+	n := new(big.Int).SetBytes(bs)
+	if len(bs) > 0 && bs[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(bs)*8)))
+	}
+	return n
+}
+
+func TestWriteParquet(t *testing.T) {
+	table := newTable(t, `[{"name":"id","type":"long"},{"name":"n","type":"integer"},{"name":"s","type":"short"},{"name":"b","type":"byte"},
+		{"name":"d","type":"double"},{"name":"f","type":"float"},{"name":"ok","type":"boolean"},{"name":"day","type":"date"},
+		{"name":"ts","type":"timestamp"},{"name":"amt","type":"decimal(10,2)"},{"name":"big","type":"decimal(38,6)"},
+		{"name":"plain","type":"decimal"},{"name":"name","type":"string"},{"name":"tags","type":"array"}]`, `[
+		[9007199254740993,-2147483648,32767,-128,1.5,0.25,true,"2024-01-02","2024-01-02 03:04:05.000006","-12.3","-1.5","3.14","x",[1,2]],
+		[null,null,null,null,null,null,null,null,null,null,null,null,null,null],
+		[1,2147483647,-32768,127,"NaN",-0.5,false,"1969-12-31","1969-12-31T23:59:59Z",99999999.99,"12345678901234567890123456789012.000001","-0","",[]]]`)
+	buf := &bytes.Buffer{}
+	err := WriteParquet(buf, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, rows := readParquet(t, buf.Bytes())
+	if len(rows) != 3 {
+		t.Fatalf("读出了%d行,应为3行", len(rows))
+	}
+
+	for name, want := range map[string][2]int32{"amt": {10, 2}, "big": {38, 6}} {
+		leaf, ok := schema.Lookup(name)
+		if !ok || !leaf.Node.Optional() {
+			t.Fatalf("没有可选的列%s", name)
+		}
+		lt := leaf.Node.Type().LogicalType()
+		if lt == nil || lt.Decimal == nil || lt.Decimal.Precision != want[0] || lt.Decimal.Scale != want[1] {
+			t.Errorf("%s的类型为%v,应为decimal(%d,%d)", name, lt, want[0], want[1])
+		}
+	}
+	for _, name := range []string{"day", "ts", "plain", "name", "tags"} {
+		leaf, _ := schema.Lookup(name)
+		if lt := leaf.Node.Type().LogicalType(); lt == nil {
+			t.Errorf("%s没有逻辑类型", name)
+		}
+	}
+
+	r := rows[0]
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC).UnixMicro()
+	if r["id"].Int64() != 9007199254740993 || r["n"].Int32() != -2147483648 || r["s"].Int32() != 32767 || r["b"].Int32() != -128 {
+		t.Errorf("整数为%v,%v,%v,%v", r["id"], r["n"], r["s"], r["b"])
+	}
+	if r["d"].Double() != 1.5 || r["f"].Float() != 0.25 || !r["ok"].Boolean() {
+		t.Errorf("浮点数和布尔值为%v,%v,%v", r["d"], r["f"], r["ok"])
+	}
+	if int64(r["day"].Int32()) != day || r["ts"].Int64() != ts {
+		t.Errorf("day为%v,应为%d;ts为%v,应为%d", r["day"], day, r["ts"], ts)
+	}
+	if r["amt"].Int64() != -1230 || unscaled(r["big"].ByteArray()).Int64() != -1500000 || string(r["plain"].ByteArray()) != "3.14" {
+		t.Errorf("decimal为%v,%v,%v", r["amt"], unscaled(r["big"].ByteArray()), r["plain"])
+	}
+	if string(r["name"].ByteArray()) != "x" || string(r["tags"].ByteArray()) != "[1,2]" {
+		t.Errorf("name为%v,tags为%v", r["name"], r["tags"])
+	}
+
+	for name, v := range rows[1] {
+		if !v.IsNull() {
+			t.Errorf("第1行的%s为%v,应为null", name, v)
+		}
+	}
+
+	r = rows[2]
+	if r["n"].Int32() != 2147483647 || r["s"].Int32() != -32768 || r["b"].Int32() != 127 || r["d"].Double() == r["d"].Double() {
+		t.Errorf("第2行为%v", r)
+	}
+	//1970年之前的日期和时间
+	if r["day"].Int32() != -1 || r["ts"].Int64() != -1000000 {
+		t.Errorf("day为%v,ts为%v,应为-1和-1000000", r["day"], r["ts"])
+	}
+	want, _ := new(big.Int).SetString("12345678901234567890123456789012000001", 10)
+	if r["amt"].Int64() != 9999999999 || unscaled(r["big"].ByteArray()).Cmp(want) != 0 || string(r["plain"].ByteArray()) != "-0" {
+		t.Errorf("decimal为%v,%v,%v", r["amt"], unscaled(r["big"].ByteArray()), r["plain"])
+	}
+}
+
+func TestParquetValueErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		typ  string
+		raw  string
+	}{
+		{"超出integer的范围", "integer", "2147483648"},
+		{"超出short的范围", "short", "32768"},
+		{"小于short的范围", "short", "-32769"},
+		{"超出byte的范围", "byte", "128"},
+		{"小数位数超过scale", "decimal(10,2)", "1.234"},
+		{"超出decimal的精度", "decimal(10,2)", "100000000.00"},
+		{"超出大decimal的精度", "decimal(20,0)", "-100000000000000000000"},
+		{"不是decimal", "decimal(10,2)", `"abc"`},
+		{"不是布尔值", "boolean", `"yes"`},
+		{"不是日期", "date", `"soon"`},
+	}
+	for _, c := range cases {
+		table := newTable(t, `[{"name":"v","type":"`+c.typ+`"}]`, `[[`+c.raw+`]]`)
+		if err := WriteParquet(&bytes.Buffer{}, table); err == nil {
+			t.Errorf("%s时应返回错误", c.name)
+		}
+	}
+	dup := newTable(t, `[{"name":"a","type":"long"},{"name":"a","type":"string"}]`, `[]`)
+	if err := WriteParquet(&bytes.Buffer{}, dup); err == nil || !strings.Contains(err.Error(), "重复的列") {
+		t.Errorf("有重复的列时应返回错误,err为%v", err)
+	}
+}
+
+func TestDecimalBytes(t *testing.T) {
+	//precision位的十进制数加上符号位需要的最少字节数
+	cases := map[int]int{9: 4, 18: 8, 19: 9, 38: 16}
+	for precision, want := range cases {
+		if got := decimalBytes(precision); got != want {
+			t.Errorf("decimalBytes(%d)为%d,应为%d", precision, got, want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+//Job的状态
+const (
+	JobSent      = "SENT"
+	JobQueued    = "QUEUED"
+	JobStarted   = "STARTED"
+	JobCancelled = "CANCELLED"
+	JobFailed    = "FAILED"
+	JobSucceeded = "SUCCEEDED"
+)
+
+//Job livy的序列化任务,通过session的job接口提交,用于和java客户端提交的任务互通
+type Job struct {
+	Session *Session `json:"-"`
+	URI     string   `json:"-"`
+	ID      int64    `json:"id"`
+	State   string   `json:"state"`
+	//Result 任务序列化后的结果,由提交任务的一方自行解码
+	Result []byte `json:"result"`
+	//Error 任务失败时的错误信息
+	Error string `json:"error"`
+}
+
+//SerializedJob 序列化后的任务,Job为任务序列化后的内容,传输时编码为base64
+type SerializedJob struct {
+	Job     []byte `json:"job"`
+	JobType string `json:"jobType,omitempty"`
+}
+
+//NewJob 创建Session中新的Job
+func NewJob(s *Session) *Job {
+	b := new(Job)
+	uri := "jobs"
+	b.Session = s
+	b.URI = uri
+	return b
+}
+
+//Submit 通过submit-job提交任务,结果更新到自身
+func (b *Job) Submit(q *SerializedJob) error {
+	return b.SubmitWithContext(context.Background(), q)
+}
+
+//SubmitWithContext 与Submit相同,ctx用于取消请求和传递追踪信息
+func (b *Job) SubmitWithContext(ctx context.Context, q *SerializedJob) (err error) {
+	ctx, span := b.Session.Client.tracer().Start(ctx, "livy.job.submit", trace.WithAttributes(AttrSessionID.Int(b.Session.ID)))
+	defer func() {
+		endSpan(span, err)
+	}()
+	resBytes, err := b.Session.Client.api().SubmitJob(ctx, b.Session.ID, q)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(resBytes, b)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(AttrJobID.Int64(b.ID), AttrState.String(b.State))
+	return nil
+}
+
+//Run 通过run-job提交任务,结果更新到自身
+func (b *Job) Run(q *SerializedJob) error {
+	return b.RunWithContext(context.Background(), q)
+}
+
+//RunWithContext 与Run相同,ctx用于取消请求和传递追踪信息
+func (b *Job) RunWithContext(ctx context.Context, q *SerializedJob) (err error) {
+	ctx, span := b.Session.Client.tracer().Start(ctx, "livy.job.run", trace.WithAttributes(AttrSessionID.Int(b.Session.ID)))
+	defer func() {
+		endSpan(span, err)
+	}()
+	resBytes, err := b.Session.Client.api().RunJob(ctx, b.Session.ID, q)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(resBytes, b)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(AttrJobID.Int64(b.ID), AttrState.String(b.State))
+	return nil
+}
+
+//Copy 克隆一份当前的状态
+func (b *Job) Copy() *Job {
+	newone := Job{
+		Session: b.Session,
+		URI:     b.URI,
+		ID:      b.ID,
+		State:   b.State,
+		Result:  append([]byte{}, b.Result...),
+		Error:   b.Error,
+	}
+	return &newone
+}
+
+//ToJSONString 将消息转未json字符串
+func (b *Job) ToJSONString() (string, error) {
+	return json.MarshalToString(b)
+}
+
+//ToJSON 将消息转未json
+func (b *Job) ToJSON() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+//Status 获取任务的最新状态并更新自身
+func (b *Job) Status() (string, error) {
+	_, err := b.update(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return b.State, nil
+}
+
+func (b *Job) update(ctx context.Context) ([]byte, error) {
+	resb, err := b.Session.Client.api().GetJob(ctx, b.Session.ID, b.ID)
+	if err != nil {
+		return nil, err
+	}
+	nb := Job{}
+	err = json.Unmarshal(resb, &nb)
+	if err != nil {
+		return nil, err
+	}
+	b.ID = nb.ID
+	b.State = nb.State
+	b.Result = nb.Result
+	b.Error = nb.Error
+	return resb, nil
+}
+
+//Err 任务失败或被取消时返回错误,失败时包含任务的错误信息
+func (b *Job) Err() error {
+	switch b.State {
+	case JobFailed:
+		return fmt.Errorf("job %d执行失败:%s", b.ID, b.Error)
+	case JobCancelled:
+		return fmt.Errorf("job %d已取消", b.ID)
+	}
+	return nil
+}
+
+//Cancel 取消任务
+func (b *Job) Cancel() error {
+	err := b.Session.Client.api().CancelJob(context.Background(), b.Session.ID, b.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//JobUpdateMsg Job更新消息
+type JobUpdateMsg struct {
+	State string
+	New   *Job
+	Old   *Job
+}
+
+func (b *Job) url() string {
+	return fmt.Sprintf("%s/%s/%d/%s/%d", b.Session.Client.BASEURL, b.Session.URI, b.Session.ID, b.URI, b.ID)
+}
+
+func (b *Job) watch(ctx context.Context, interval time.Duration, ch chan JobUpdateMsg) {
+	logger := b.Session.Client.logger()
+	attempt := 0
+	ctx, span := b.Session.Client.tracer().Start(ctx, "livy.job.watch", trace.WithAttributes(AttrSessionID.Int(b.Session.ID), AttrJobID.Int64(b.ID)))
+	b.Session.Client.metrics().WatcherStarted("job")
+	defer b.Session.Client.metrics().WatcherStopped("job")
+	defer func() {
+		var errE error
+		err := recover()
+		if err != nil {
+			errE = fmt.Errorf("%v", err)
+			logger.Error("job watch error", "session_id", b.Session.ID, "job_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt, "err", err)
+			ch <- JobUpdateMsg{
+				State: "watch_err",
+			}
+		}
+		close(ch)
+		span.SetAttributes(AttrState.String(b.State))
+		endSpan(span, errE)
+	}()
+	var oldbb []byte
+	var newbb []byte
+	bb, err := b.ToJSON()
+	if err != nil {
+		panic(err)
+	}
+	oldbb = bb
+OuterLoop:
+	for {
+		attempt++
+		oldb := b.Copy()
+		gb, err := b.update(ctx)
+		if err != nil {
+			panic(err)
+		}
+		logger.Debug("job watch poll", "session_id", b.Session.ID, "job_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt)
+		if newbb != nil {
+			oldbb = newbb
+			newbb = gb
+		} else {
+			newbb = gb
+		}
+		msg := JobUpdateMsg{
+			State: b.State,
+			New:   b,
+			Old:   oldb,
+		}
+		switch b.State {
+		case JobCancelled, JobFailed, JobSucceeded:
+			{
+				ch <- msg
+				break OuterLoop
+			}
+		default:
+			{
+				if MD5(oldbb) != MD5(newbb) {
+					ch <- msg
+				}
+				select {
+				case <-ctx.Done():
+					panic(ctx.Err())
+				case <-b.Session.Client.clock().After(interval):
+				}
+			}
+		}
+	}
+}
+
+//Watch 轮询监听状态变化
+func (b *Job) Watch(interval time.Duration, chanBuffer int) (chan JobUpdateMsg, error) {
+	return b.WatchWithContext(context.Background(), interval, chanBuffer)
+}
+
+//WatchWithContext 与Watch相同,ctx取消后停止轮询,发送一条State为watch_err的消息并关闭channel
+func (b *Job) WatchWithContext(ctx context.Context, interval time.Duration, chanBuffer int) (chan JobUpdateMsg, error) {
+	switch {
+	case chanBuffer > 0:
+		{
+			ch := make(chan JobUpdateMsg, chanBuffer)
+			go b.watch(ctx, interval, ch)
+			return ch, nil
+		}
+	case chanBuffer == 0:
+		{
+			ch := make(chan JobUpdateMsg)
+			go b.watch(ctx, interval, ch)
+			return ch, nil
+		}
+	default:
+		{
+			return nil, errors.New("chanBuffer必须为非负数")
+		}
+	}
+}
+
+//Wait 轮询等待任务结束,任务失败或被取消时返回Err的错误,成功后可以从Result获取结果
+func (b *Job) Wait(ctx context.Context, interval time.Duration) (err error) {
+	ctx, span := b.Session.Client.tracer().Start(ctx, "livy.job.wait", trace.WithAttributes(AttrSessionID.Int(b.Session.ID), AttrJobID.Int64(b.ID)))
+	defer func() {
+		span.SetAttributes(AttrState.String(b.State))
+		endSpan(span, err)
+	}()
+	for {
+		_, err = b.update(ctx)
+		if err != nil {
+			return err
+		}
+		switch b.State {
+		case JobCancelled, JobFailed, JobSucceeded:
+			return b.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.Session.Client.clock().After(interval):
+		}
+	}
+}
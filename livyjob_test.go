@@ -0,0 +1,172 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//newTestJob 在idle的session上创建job,提交的内容为fail时任务失败
+func newTestJob(t *testing.T, states ...string) (*Session, *Job, *livytest.FakeClock) {
+	t.Helper()
+	s, b, clock := newTestSession(t, KindSpark)
+	s.JobStates = states
+	s.JobResult = func(job []byte) ([]byte, error) {
+		if string(job) == "fail" {
+			return nil, errors.New("ClassNotFoundException")
+		}
+		return append([]byte("result of "), job...), nil
+	}
+	return b, b.NewJob(), clock
+}
+
+func TestJobSubmitAndWait(t *testing.T) {
+	b, j, clock := newTestJob(t, JobSent, JobQueued, JobStarted, JobSucceeded)
+	err := j.Submit(&SerializedJob{Job: []byte("job")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.ID != 0 || j.State != JobSent || j.Session != b {
+		t.Errorf("提交后ID为%d,State为%s", j.ID, j.State)
+	}
+	ticks, err := runWithClock(clock, time.Second, func() error {
+		return j.Wait(context.Background(), time.Second)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticks != 2 || j.State != JobSucceeded || string(j.Result) != "result of job" {
+		t.Errorf("等待了%d次,State为%s,Result为%q", ticks, j.State, j.Result)
+	}
+}
+
+func TestJobRun(t *testing.T) {
+	_, j, _ := newTestJob(t, JobSucceeded)
+	err := j.Run(&SerializedJob{Job: []byte("job"), JobType: "scala"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.State != JobSucceeded || string(j.Result) != "result of job" {
+		t.Errorf("State为%s,Result为%q", j.State, j.Result)
+	}
+	if err := j.Err(); err != nil {
+		t.Errorf("成功的job的Err应为nil,err为%v", err)
+	}
+}
+
+func TestJobFailed(t *testing.T) {
+	_, j, clock := newTestJob(t, JobSent, JobSucceeded)
+	err := j.Submit(&SerializedJob{Job: []byte("fail")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runWithClock(clock, time.Second, func() error {
+		return j.Wait(context.Background(), time.Second)
+	})
+	if j.State != JobFailed || j.Error != "ClassNotFoundException" {
+		t.Errorf("State为%s,Error为%s", j.State, j.Error)
+	}
+	if err == nil || !strings.Contains(err.Error(), "ClassNotFoundException") {
+		t.Errorf("失败时Wait应返回任务的错误信息,err为%v", err)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	_, j, _ := newTestJob(t, JobSent, JobStarted)
+	err := j.Submit(&SerializedJob{Job: []byte("job")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = j.Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := j.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != JobCancelled || j.Err() == nil {
+		t.Errorf("取消后状态为%s,Err为%v", state, j.Err())
+	}
+	j.ID = 42
+	if _, err := j.Status(); err == nil {
+		t.Error("job不存在时Status应返回错误")
+	}
+}
+
+func TestJobWaitContextCancel(t *testing.T) {
+	_, j, clock := newTestJob(t, JobStarted)
+	err := j.Submit(&SerializedJob{Job: []byte("job")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- j.Wait(ctx, time.Second)
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("err为%v,应为context.Canceled", err)
+	}
+}
+
+func TestJobWatch(t *testing.T) {
+	_, j, clock := newTestJob(t, JobSent, JobQueued, JobQueued, JobStarted, JobSucceeded)
+	err := j.Submit(&SerializedJob{Job: []byte("job")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := j.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, ticks := drainWithClock(clock, time.Second, ch)
+	states := []string{}
+	for _, msg := range msgs {
+		states = append(states, msg.State)
+	}
+	//状态没有变化的轮询不发送消息
+	if strings.Join(states, ",") != "QUEUED,STARTED,SUCCEEDED" || ticks != 3 {
+		t.Errorf("收到的状态为%v,等待了%d次", states, ticks)
+	}
+	if last := msgs[len(msgs)-1]; last.Old.State != JobStarted || last.New.State != JobSucceeded {
+		t.Errorf("最后一条消息的Old为%s,New为%s", last.Old.State, last.New.State)
+	}
+	if _, err := j.Watch(time.Second, -1); err == nil {
+		t.Error("chanBuffer为负数时应返回错误")
+	}
+}
+
+func TestJobBadResponse(t *testing.T) {
+	_, j, _ := newTestJob(t, JobSent)
+	j.Session.Client.Use(func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			res, err := next(req)
+			if err == nil && req.Method == http.MethodPost {
+				res.Body = []byte(`{"id":"x"}`)
+			}
+			return res, err
+		}
+	})
+	for name, f := range map[string]func(*SerializedJob) error{"Submit": j.Submit, "Run": j.Run} {
+		if err := f(&SerializedJob{Job: []byte("job")}); err == nil {
+			t.Errorf("%s的响应无法解析时应返回错误", name)
+		}
+	}
+}
+
+func TestJobCopy(t *testing.T) {
+	j := &Job{ID: 1, State: JobSucceeded, Result: []byte("abc")}
+	c := j.Copy()
+	c.Result[0] = 'x'
+	if string(j.Result) != "abc" || c.ID != 1 || c.State != JobSucceeded {
+		t.Errorf("Copy应复制Result,原Result为%q", j.Result)
+	}
+}
@@ -0,0 +1,140 @@
+//Package livyprom golivyclient指标的prometheus实现
+package livyprom
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//Collector 实现了golivyclient.Metrics和prometheus.Collector
+type Collector struct {
+	requests          *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	watchers          *prometheus.GaugeVec
+	states            *prometheus.GaugeVec
+	statementDuration *prometheus.HistogramVec
+
+	mu      sync.Mutex
+	objects map[objectKey]string
+}
+
+type objectKey struct {
+	kind string
+	id   int
+}
+
+//terminalStates batch和session结束后的状态,进入这些状态的对象不再计入objects
+var terminalStates = map[string]bool{
+	"shutting_down": true,
+	"error":         true,
+	"dead":          true,
+	"killed":        true,
+	"success":       true,
+}
+
+//NewCollector 创建指标收集器,namespace为指标名的前缀,可以为空
+func NewCollector(namespace string) *Collector {
+	c := new(Collector)
+	c.objects = map[objectKey]string{}
+	c.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "livy",
+		Name:      "requests_total",
+		Help:      "Number of requests sent to livy by endpoint and status code.",
+	}, []string{"method", "endpoint", "code"})
+	c.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "livy",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests sent to livy by endpoint and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint", "code"})
+	c.watchers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "livy",
+		Name:      "active_watchers",
+		Help:      "Number of running batch, session and statement watchers.",
+	}, []string{"kind"})
+	c.states = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "livy",
+		Name:      "objects",
+		Help:      "Number of unfinished batches and sessions known to the client by state.",
+	}, []string{"kind", "state"})
+	c.statementDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "livy",
+		Name:      "statement_duration_seconds",
+		Help:      "Execution time of finished statements by final state.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"state"})
+	return c
+}
+
+//Describe 实现prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.requestDuration.Describe(ch)
+	c.watchers.Describe(ch)
+	c.states.Describe(ch)
+	c.statementDuration.Describe(ch)
+}
+
+//Collect 实现prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.requestDuration.Collect(ch)
+	c.watchers.Collect(ch)
+	c.states.Collect(ch)
+	c.statementDuration.Collect(ch)
+}
+
+//ObserveRequest 记录一次请求
+func (c *Collector) ObserveRequest(method string, endpoint string, status int, duration time.Duration) {
+	code := "error"
+	if status > 0 {
+		code = strconv.Itoa(status)
+	}
+	c.requests.WithLabelValues(method, endpoint, code).Inc()
+	c.requestDuration.WithLabelValues(method, endpoint, code).Observe(duration.Seconds())
+}
+
+//WatcherStarted 一个watcher开始轮询
+func (c *Collector) WatcherStarted(kind string) {
+	c.watchers.WithLabelValues(kind).Inc()
+}
+
+//WatcherStopped 一个watcher停止轮询
+func (c *Collector) WatcherStopped(kind string) {
+	c.watchers.WithLabelValues(kind).Dec()
+}
+
+//StateChanged batch或session的状态发生变化
+//
+//按kind和id记录每个对象最后的状态,同一ID的多个对象只计一次;对象结束或被删除时不再计入
+func (c *Collector) StateChanged(kind string, id int, from string, to string) {
+	key := objectKey{kind: kind, id: id}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev, ok := c.objects[key]
+	if ok && prev == to {
+		return
+	}
+	if ok {
+		c.states.WithLabelValues(kind, prev).Dec()
+		delete(c.objects, key)
+	}
+	if to == "" || terminalStates[to] {
+		return
+	}
+	c.states.WithLabelValues(kind, to).Inc()
+	c.objects[key] = to
+}
+
+//ObserveStatement 记录一个执行结束的statement的执行时长
+func (c *Collector) ObserveStatement(state string, duration time.Duration) {
+	c.statementDuration.WithLabelValues(state).Observe(duration.Seconds())
+}
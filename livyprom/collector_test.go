@@ -0,0 +1,212 @@
+package livyprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	lc "golivyclient"
+	"golivyclient/livytest"
+)
+
+var _ lc.Metrics = (*Collector)(nil)
+
+func TestCollectorRegister(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	c := NewCollector("app")
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	c.ObserveRequest("GET", "batches/{id}", 200, time.Millisecond)
+	c.WatcherStarted("batch")
+	c.StateChanged("batch", 1, "", "running")
+	c.ObserveStatement("available", time.Second)
+	problems, err := testutil.GatherAndLint(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("%s:%s", p.Metric, p.Text)
+	}
+	names := []string{"app_livy_requests_total", "app_livy_request_duration_seconds", "app_livy_active_watchers", "app_livy_objects", "app_livy_statement_duration_seconds"}
+	if n, err := testutil.GatherAndCount(reg, names...); err != nil || n != 5 {
+		t.Errorf("收集到%d个指标,err为%v,应为5个", n, err)
+	}
+	//namespace为空时没有前缀
+	if err := reg.Register(NewCollector("")); err != nil {
+		t.Errorf("不同namespace的收集器应能同时注册,err为%v", err)
+	}
+	if err := reg.Register(NewCollector("app")); err == nil {
+		t.Error("同名的收集器不能重复注册")
+	}
+}
+
+func TestCollectorRequests(t *testing.T) {
+	c := NewCollector("")
+	c.ObserveRequest("GET", "batches/{id}", 200, 10*time.Millisecond)
+	c.ObserveRequest("GET", "batches/{id}", 200, 30*time.Millisecond)
+	c.ObserveRequest("GET", "batches/{id}", 404, time.Millisecond)
+	c.ObserveRequest("POST", "sessions", 0, time.Second)
+	cases := []struct {
+		labels []string
+		want   float64
+	}{
+		{[]string{"GET", "batches/{id}", "200"}, 2},
+		{[]string{"GET", "batches/{id}", "404"}, 1},
+		//没有响应时code为error
+		{[]string{"POST", "sessions", "error"}, 1},
+	}
+	for _, cs := range cases {
+		if got := testutil.ToFloat64(c.requests.WithLabelValues(cs.labels...)); got != cs.want {
+			t.Errorf("%v的请求数为%v,应为%v", cs.labels, got, cs.want)
+		}
+	}
+	want := `
+# HELP livy_request_duration_seconds Latency of requests sent to livy by endpoint and status code.
+# TYPE livy_request_duration_seconds histogram
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="0.005"} 0
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="0.01"} 1
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="0.025"} 1
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="0.05"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="0.1"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="0.25"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="0.5"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="1"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="2.5"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="5"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="10"} 2
+livy_request_duration_seconds_bucket{code="200",endpoint="batches/{id}",method="GET",le="+Inf"} 2
+livy_request_duration_seconds_sum{code="200",endpoint="batches/{id}",method="GET"} 0.04
+livy_request_duration_seconds_count{code="200",endpoint="batches/{id}",method="GET"} 2
+`
+	c.requestDuration.DeleteLabelValues("GET", "batches/{id}", "404")
+	c.requestDuration.DeleteLabelValues("POST", "sessions", "error")
+	if err := testutil.CollectAndCompare(c.requestDuration, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorWatchersAndStatements(t *testing.T) {
+	c := NewCollector("")
+	c.WatcherStarted("batch")
+	c.WatcherStarted("batch")
+	c.WatcherStarted("session")
+	c.WatcherStopped("batch")
+	if b, s := testutil.ToFloat64(c.watchers.WithLabelValues("batch")), testutil.ToFloat64(c.watchers.WithLabelValues("session")); b != 1 || s != 1 {
+		t.Errorf("batch和session的watcher为%v和%v,应为1和1", b, s)
+	}
+	c.ObserveStatement("available", 2*time.Second)
+	c.ObserveStatement("available", 4*time.Second)
+	c.ObserveStatement("error", time.Second)
+	if n := testutil.CollectAndCount(c.statementDuration); n != 2 {
+		t.Errorf("statement时长有%d组,应为2组", n)
+	}
+	want := `
+# HELP livy_statement_duration_seconds Execution time of finished statements by final state.
+# TYPE livy_statement_duration_seconds histogram
+livy_statement_duration_seconds_bucket{state="error",le="0.1"} 0
+livy_statement_duration_seconds_bucket{state="error",le="0.2"} 0
+livy_statement_duration_seconds_bucket{state="error",le="0.4"} 0
+livy_statement_duration_seconds_bucket{state="error",le="0.8"} 0
+livy_statement_duration_seconds_bucket{state="error",le="1.6"} 1
+livy_statement_duration_seconds_bucket{state="error",le="3.2"} 1
+livy_statement_duration_seconds_bucket{state="error",le="6.4"} 1
+livy_statement_duration_seconds_bucket{state="error",le="12.8"} 1
+livy_statement_duration_seconds_bucket{state="error",le="25.6"} 1
+livy_statement_duration_seconds_bucket{state="error",le="51.2"} 1
+livy_statement_duration_seconds_bucket{state="error",le="102.4"} 1
+livy_statement_duration_seconds_bucket{state="error",le="204.8"} 1
+livy_statement_duration_seconds_bucket{state="error",le="409.6"} 1
+livy_statement_duration_seconds_bucket{state="error",le="819.2"} 1
+livy_statement_duration_seconds_bucket{state="error",le="+Inf"} 1
+livy_statement_duration_seconds_sum{state="error"} 1
+livy_statement_duration_seconds_count{state="error"} 1
+`
+	c.statementDuration.DeleteLabelValues("available")
+	if err := testutil.CollectAndCompare(c.statementDuration, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+//objects 各状态下的对象数,为0的状态不返回
+func objects(c *Collector, kind string, states ...string) map[string]float64 {
+	res := map[string]float64{}
+	for _, state := range states {
+		if n := testutil.ToFloat64(c.states.WithLabelValues(kind, state)); n != 0 {
+			res[state] = n
+		}
+	}
+	return res
+}
+
+func TestCollectorStateChanged(t *testing.T) {
+	c := NewCollector("")
+	states := []string{"starting", "idle", "busy", "running", "dead"}
+	c.StateChanged("session", 1, "", "starting")
+	c.StateChanged("session", 2, "", "starting")
+	c.StateChanged("batch", 1, "", "running")
+	c.StateChanged("session", 1, "starting", "idle")
+	//同一ID的另一个对象报告相同的变化时不重复计数
+	c.StateChanged("session", 1, "starting", "idle")
+	c.StateChanged("session", 2, "starting", "busy")
+	if got := objects(c, "session", states...); len(got) != 2 || got["idle"] != 1 || got["busy"] != 1 {
+		t.Errorf("session的对象数为%v,应为idle:1,busy:1", got)
+	}
+	//另一个对象看到的旧状态以最后记录的状态为准
+	c.StateChanged("session", 2, "starting", "idle")
+	if got := objects(c, "session", states...); len(got) != 1 || got["idle"] != 2 {
+		t.Errorf("session的对象数为%v,应为idle:2", got)
+	}
+	//结束或删除后不再计入
+	c.StateChanged("session", 1, "idle", "dead")
+	c.StateChanged("session", 2, "idle", "")
+	c.StateChanged("session", 2, "idle", "")
+	if got := objects(c, "session", states...); len(got) != 0 {
+		t.Errorf("session的对象数为%v,应为0", got)
+	}
+	if got := objects(c, "batch", states...); got["running"] != 1 {
+		t.Errorf("batch的对象数为%v,应为running:1", got)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.objects) != 1 {
+		t.Errorf("还记录了%d个对象,应只有batch 1", len(c.objects))
+	}
+}
+
+func TestCollectorWithClient(t *testing.T) {
+	s := livytest.NewServer()
+	defer s.Close()
+	s.BatchStates = []string{"starting", "running"}
+	m := NewCollector("")
+	c := lc.NewClient(s.URL)
+	c.Metrics = m
+	b := lc.NewBatch(c)
+	err := b.New(&lc.NewBatchQuery{File: "app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.ToFloat64(m.states.WithLabelValues("batch", "starting")); n != 1 {
+		t.Errorf("starting的batch数为%v,应为1", n)
+	}
+	if _, err := b.Info(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Info(); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.ToFloat64(m.requests.WithLabelValues("GET", "batches/{id}", "200")); n != 2 {
+		t.Errorf("查询batch的请求数为%v,应为2", n)
+	}
+	if n := testutil.ToFloat64(m.requests.WithLabelValues("POST", "batches", "201")); n != 1 {
+		t.Errorf("创建batch的请求数为%v,应为1", n)
+	}
+	if err := b.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	if got := objects(m, "batch", "starting", "running"); len(got) != 0 {
+		t.Errorf("batch删除后对象数为%v,应为0", got)
+	}
+}
@@ -1,12 +1,14 @@
 package golivyclient
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
-	log "github.com/Basic-Components/loggerhelper"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //Session livy的会话,用于管理交互模式提交的代码
@@ -22,6 +24,10 @@ type Session struct {
 	AppInfo    map[string]interface{} `json:"appInfo"`
 	Log        []string               `json:"log"`
 	State      string                 `json:"state"`
+	//HeartbeatTimeout session的心跳超时时间,New时从HeartbeatTimeoutInSecond获得,KeepAlive据此决定心跳间隔
+	HeartbeatTimeout time.Duration `json:"-"`
+	//Cluster 所在集群的名称,通过ClusterRegistry提交或查找时设置
+	Cluster string `json:"-"`
 }
 
 //NewSessionQuery livy批的创建请求,用于提交固定任务
@@ -68,15 +74,34 @@ func NewSession(c *LivyClient) *Session {
 	return b
 }
 
-//New 创建新的Session请求,并将结果更新到对象自身
+//New 创建新的Session请求,并将结果更新到对象自身,提交前会合并LivyClient.DefaultConf并调用q.Validate,见LivyClient.SkipValidation
 func (b *Session) New(q *NewSessionQuery) error {
+	return b.NewWithContext(context.Background(), q)
+}
 
-	url := fmt.Sprintf("%s/%s", b.Client.BASEURL, b.URI)
-	resBytes, err := HTTPJSONQuery(url, "POST", q)
+//NewWithContext 与New相同,ctx用于取消请求和传递追踪信息
+func (b *Session) NewWithContext(ctx context.Context, q *NewSessionQuery) (err error) {
+	ctx, span := b.Client.tracer().Start(ctx, "livy.session.new", trace.WithAttributes(AttrKind.String(q.Kind), AttrQueue.String(q.Queue)))
+	defer func() {
+		endSpan(span, err)
+	}()
+	q = q.withDefaultConf(b.Client.DefaultConf)
+	if !b.Client.SkipValidation {
+		err = q.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	ctx, pinned := b.Client.pinRoute(ctx)
+	resBytes, err := b.Client.api().CreateSession(ctx, q)
 	if err != nil {
 		return err
 	}
 	json.Unmarshal(resBytes, b)
+	b.Client = pinned()
+	b.HeartbeatTimeout = time.Duration(q.HeartbeatTimeoutInSecond) * time.Second
+	span.SetAttributes(AttrSessionID.Int(b.ID), AttrAppID.String(b.AppID), AttrState.String(b.State))
+	b.Client.metrics().StateChanged("session", b.ID, "", b.State)
 	return nil
 }
 
@@ -101,6 +126,7 @@ func (b *Session) Copy() *Session {
 	newone := Session{
 		Client:     b.Client,
 		URI:        b.URI,
+		Cluster:    b.Cluster,
 		Statements: newstates,
 		ID:         b.ID,
 		AppID:      b.AppID,
@@ -110,6 +136,8 @@ func (b *Session) Copy() *Session {
 		AppInfo:    newAppInfo,
 		Log:        newlog,
 		State:      b.State,
+
+		HeartbeatTimeout: b.HeartbeatTimeout,
 	}
 	return &newone
 }
@@ -126,8 +154,11 @@ func (b *Session) ToJSON() ([]byte, error) {
 
 //BytesInfo 获取Session对象的信息
 func (b *Session) BytesInfo() ([]byte, error) {
-	url := fmt.Sprintf("%s/%s/%d", b.Client.BASEURL, b.URI, b.ID)
-	resBytes, err := HTTPJSONQuery(url, "GET")
+	return b.bytesInfo(context.Background())
+}
+
+func (b *Session) bytesInfo(ctx context.Context) ([]byte, error) {
+	resBytes, err := b.Client.api().GetSession(ctx, b.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -147,13 +178,18 @@ func (b *Session) Info() (*Session, error) {
 	}
 	nb.Client = b.Client
 	nb.URI = b.URI
+	nb.Cluster = b.Cluster
 	b.Statements = []*Statement{}
 	return &nb, nil
 }
 
 //Update 更新自身
 func (b *Session) Update() ([]byte, error) {
-	resb, err := b.BytesInfo()
+	return b.update(context.Background())
+}
+
+func (b *Session) update(ctx context.Context) ([]byte, error) {
+	resb, err := b.bytesInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -169,25 +205,96 @@ func (b *Session) Update() ([]byte, error) {
 	b.ProxyUser = nb.ProxyUser
 	b.AppInfo = nb.AppInfo
 	b.Log = nb.Log
+	if b.State != nb.State {
+		b.Client.metrics().StateChanged("session", b.ID, b.State, nb.State)
+	}
 	b.State = nb.State
 	return resb, nil
 }
 
 //Close 关闭batch所指向的任务
 func (b *Session) Close() error {
-	url := fmt.Sprintf("%s/%s/%d", b.Client.BASEURL, b.URI, b.ID)
-	_, err := HTTPJSONQuery(url, "DELETE")
+	err := b.Client.api().DeleteSession(context.Background(), b.ID)
 	if err != nil {
 		return err
 	}
+	b.Client.metrics().StateChanged("session", b.ID, b.State, "")
 	return nil
 }
 
+//UploadJar 上传jar到session,上传后可以在session中使用
+func (b *Session) UploadJar(r io.Reader, name string) error {
+	return b.Client.api().UploadJar(context.Background(), b.ID, name, r)
+}
+
+//UploadPyFile 上传python文件到session
+func (b *Session) UploadPyFile(r io.Reader, name string) error {
+	return b.Client.api().UploadPyFile(context.Background(), b.ID, name, r)
+}
+
+//UploadFile 上传文件到session
+func (b *Session) UploadFile(r io.Reader, name string) error {
+	return b.Client.api().UploadFile(context.Background(), b.ID, name, r)
+}
+
+//AddJar 为session添加uri指向的jar,uri需要能被livy服务访问
+func (b *Session) AddJar(uri string) error {
+	return b.Client.api().AddJar(context.Background(), b.ID, uri)
+}
+
+//AddPyFile 为session添加uri指向的python文件
+func (b *Session) AddPyFile(uri string) error {
+	return b.Client.api().AddPyFile(context.Background(), b.ID, uri)
+}
+
+//AddFile 为session添加uri指向的文件
+func (b *Session) AddFile(uri string) error {
+	return b.Client.api().AddFile(context.Background(), b.ID, uri)
+}
+
 //NewStatement 在当前Session下创建新的NewStatement
 func (b *Session) NewStatement() *Statement {
 	return NewStatement(b)
 }
 
+//NewJob 在当前Session下创建新的Job
+func (b *Session) NewJob() *Job {
+	return NewJob(b)
+}
+
+//DefaultPollInterval Run等待statement执行结束时的轮询间隔
+var DefaultPollInterval = time.Second
+
+//Run 提交代码并等待执行结束,执行出错或被取消时返回statement的错误信息
+//
+//Run创建的statement不会加入Statements,避免频繁执行时积累statement的输出
+func (b *Session) Run(ctx context.Context, q *NewStatementQuery) (*Statement, error) {
+	st := &Statement{Session: b, URI: "statements"}
+	err := st.NewWithContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	err = st.Wait(ctx, DefaultPollInterval)
+	if err != nil {
+		return st, err
+	}
+	return st, st.Err()
+}
+
+//RunTemplate 按session的Kind渲染代码模板并执行,params中的值会转为对应语言的字面量,见Template
+func (b *Session) RunTemplate(code string, params map[string]interface{}) (*Statement, error) {
+	return b.RunTemplateWithContext(context.Background(), code, params)
+}
+
+//RunTemplateWithContext 与RunTemplate相同,ctx用于取消等待和传递追踪信息
+func (b *Session) RunTemplateWithContext(ctx context.Context, code string, params map[string]interface{}) (*Statement, error) {
+	rendered, err := Template(b.Kind, code, params)
+	if err != nil {
+		return nil, err
+	}
+	return b.Run(ctx, &NewStatementQuery{Code: rendered, Kind: b.Kind})
+}
+
 //SessionUpdateMsg Batch更新消息
 type SessionUpdateMsg struct {
 	State string   `json:"State"`
@@ -195,14 +302,22 @@ type SessionUpdateMsg struct {
 	Old   *Session `json:"Old"`
 }
 
-func (b *Session) watch(interval time.Duration, ch chan SessionUpdateMsg) {
+func (b *Session) url() string {
+	return fmt.Sprintf("%s/%s/%d", b.Client.BASEURL, b.URI, b.ID)
+}
+
+func (b *Session) watch(ctx context.Context, interval time.Duration, ch chan SessionUpdateMsg) {
+	logger := b.Client.logger()
+	attempt := 0
+	ctx, span := b.Client.tracer().Start(ctx, "livy.session.watch", trace.WithAttributes(AttrSessionID.Int(b.ID), AttrAppID.String(b.AppID)))
+	b.Client.metrics().WatcherStarted("session")
+	defer b.Client.metrics().WatcherStopped("session")
 	defer func() {
+		var errE error
 		err := recover()
 		if err != nil {
-			errE := err.(error)
-			log.Error(map[string]interface{}{
-				"err": errE,
-			}, "session watch error")
+			errE = err.(error)
+			logger.Error("session watch error", "session_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt, "err", errE)
 			if strings.HasPrefix(errE.Error(), "未找到资源") {
 				ch <- SessionUpdateMsg{
 					State: "cancelled",
@@ -214,6 +329,8 @@ func (b *Session) watch(interval time.Duration, ch chan SessionUpdateMsg) {
 			}
 		}
 		close(ch)
+		span.SetAttributes(AttrState.String(b.State))
+		endSpan(span, errE)
 	}()
 	var oldbb []byte
 	var newbb []byte
@@ -224,11 +341,13 @@ func (b *Session) watch(interval time.Duration, ch chan SessionUpdateMsg) {
 	oldbb = bb
 OuterLoop:
 	for {
+		attempt++
 		oldb := b.Copy()
-		gb, err := b.Update()
+		gb, err := b.update(ctx)
 		if err != nil {
 			panic(err)
 		}
+		logger.Debug("session watch poll", "session_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt)
 		if newbb != nil {
 			oldbb = newbb
 			newbb = gb
@@ -247,7 +366,7 @@ OuterLoop:
 				ch <- msg
 				break OuterLoop
 			}
-		case "Error":
+		case "error":
 			{
 				ch <- msg
 				break OuterLoop
@@ -274,7 +393,11 @@ OuterLoop:
 				if MD5(oldbb) != MD5(newbb) {
 					ch <- msg
 				}
-				time.Sleep(interval)
+				select {
+				case <-ctx.Done():
+					panic(ctx.Err())
+				case <-b.Client.clock().After(interval):
+				}
 			}
 		}
 	}
@@ -283,17 +406,22 @@ OuterLoop:
 
 //Watch 轮询监听状态变化
 func (b *Session) Watch(interval time.Duration, chanBuffer int) (chan SessionUpdateMsg, error) {
+	return b.WatchWithContext(context.Background(), interval, chanBuffer)
+}
+
+//WatchWithContext 与Watch相同,ctx取消后停止轮询,发送一条State为watch_err的消息并关闭channel
+func (b *Session) WatchWithContext(ctx context.Context, interval time.Duration, chanBuffer int) (chan SessionUpdateMsg, error) {
 	switch {
 	case chanBuffer > 0:
 		{
 			ch := make(chan SessionUpdateMsg, chanBuffer)
-			go b.watch(interval, ch)
+			go b.watch(ctx, interval, ch)
 			return ch, nil
 		}
 	case chanBuffer == 0:
 		{
 			ch := make(chan SessionUpdateMsg)
-			go b.watch(interval, ch)
+			go b.watch(ctx, interval, ch)
 			return ch, nil
 		}
 	default:
@@ -302,3 +430,79 @@ func (b *Session) Watch(interval time.Duration, chanBuffer int) (chan SessionUpd
 		}
 	}
 }
+
+//Wait 轮询等待session启动完成进入idle状态,session在此之前结束时返回错误
+func (b *Session) Wait(ctx context.Context, interval time.Duration) (err error) {
+	ctx, span := b.Client.tracer().Start(ctx, "livy.session.wait", trace.WithAttributes(AttrSessionID.Int(b.ID), AttrKind.String(b.Kind)))
+	defer func() {
+		span.SetAttributes(AttrAppID.String(b.AppID), AttrState.String(b.State))
+		endSpan(span, err)
+	}()
+	for {
+		_, err = b.update(ctx)
+		if err != nil {
+			return err
+		}
+		switch b.State {
+		case "idle":
+			return nil
+		case "shutting_down", "error", "dead", "killed", "success":
+			return fmt.Errorf("session %d已结束,state:%s", b.ID, b.State)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.Client.clock().After(interval):
+		}
+	}
+}
+
+//DefaultHeartbeatInterval session没有设置心跳超时时KeepAlive的心跳间隔
+var DefaultHeartbeatInterval = 30 * time.Second
+
+//KeepAlive 按HeartbeatTimeout的三分之一定时向livy发送心跳,避免session因心跳超时被回收
+//
+//ctx取消或session结束后停止并关闭返回的channel;心跳失败时错误会发送到返回的channel中,channel已满时错误会被丢弃
+func (b *Session) KeepAlive(ctx context.Context) <-chan error {
+	errs := make(chan error, 8)
+	interval := b.HeartbeatTimeout / 3
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	go func() {
+		defer close(errs)
+		logger := b.Client.logger()
+		attempt := 0
+		for {
+			attempt++
+			resb, err := b.Client.api().ConnectSession(ctx, b.ID)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.Warn("session heartbeat missed", "session_id", b.ID, "url", b.url(), "attempt", attempt, "err", err)
+				select {
+				case errs <- fmt.Errorf("session %d心跳失败:%w", b.ID, err):
+				default:
+				}
+				if strings.HasPrefix(err.Error(), "未找到资源") {
+					return
+				}
+			} else {
+				nb := Session{}
+				json.Unmarshal(resb, &nb)
+				logger.Debug("session heartbeat", "session_id", b.ID, "state", nb.State, "url", b.url(), "attempt", attempt)
+				switch nb.State {
+				case "shutting_down", "error", "dead", "killed", "success":
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.Client.clock().After(interval):
+			}
+		}
+	}()
+	return errs
+}
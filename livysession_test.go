@@ -0,0 +1,233 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+func TestSessionWait(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.SessionStates = []string{"not_started", "starting", "starting", "idle"}
+	b := NewSession(c)
+	err := b.New(&NewSessionQuery{Kind: KindPySpark})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticks, err := runWithClock(clock, time.Second, func() error {
+		return b.Wait(context.Background(), time.Second)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.State != "idle" || ticks != 2 {
+		t.Errorf("State为%s,等待了%d次,应为idle和2次", b.State, ticks)
+	}
+}
+
+func TestSessionWaitDead(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.SessionStates = []string{"starting", "dead"}
+	b := NewSession(c)
+	err := b.New(&NewSessionQuery{Kind: KindSQL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runWithClock(clock, time.Second, func() error {
+		return b.Wait(context.Background(), time.Second)
+	})
+	if err == nil || !strings.Contains(err.Error(), "dead") {
+		t.Errorf("err为%v,应为session已结束的错误", err)
+	}
+}
+
+func TestSessionWatch(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.SessionStates = []string{"starting", "idle", "busy", "idle"}
+	b := NewSession(c)
+	err := b.New(&NewSessionQuery{Kind: KindSpark})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := b.WatchWithContext(ctx, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := []string{}
+	for msg := range ch {
+		states = append(states, msg.State)
+		switch {
+		case len(states) == 3:
+			//session停留在idle,取消后watch结束
+			cancel()
+		case len(states) < 3:
+			clock.BlockUntil(1)
+			clock.Advance(time.Second)
+		}
+	}
+	want := []string{"idle", "busy", "idle", "watch_err"}
+	if strings.Join(states, ",") != strings.Join(want, ",") {
+		t.Errorf("收到的状态为%v,应为%v", states, want)
+	}
+}
+
+func TestSessionRun(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.SessionStates = []string{"idle"}
+	s.StatementStates = []string{"waiting", "running", "available"}
+	s.StatementResult = func(code string) (map[string]interface{}, error) {
+		if code == "1/0" {
+			return nil, errors.New("division by zero")
+		}
+		return map[string]interface{}{TextMimeType: "2"}, nil
+	}
+	b := NewSession(c)
+	err := b.New(&NewSessionQuery{Kind: KindPySpark})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st *Statement
+	ticks, err := runWithClock(clock, DefaultPollInterval, func() error {
+		var err error
+		st, err = b.Run(context.Background(), &NewStatementQuery{Code: "1+1"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "available" || ticks != 1 {
+		t.Errorf("State为%s,等待了%d次", st.State, ticks)
+	}
+	if st.Output == nil || st.Output.Data == nil || string(*st.Output.Data) != `{"text/plain":"2"}` {
+		t.Errorf("输出为%+v", st.Output)
+	}
+	if len(b.Statements) != 0 {
+		t.Errorf("Run创建的statement不应加入Statements")
+	}
+
+	_, err = runWithClock(clock, DefaultPollInterval, func() error {
+		_, err := b.Run(context.Background(), &NewStatementQuery{Code: "1/0"})
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("err为%v,应包含执行的错误信息", err)
+	}
+}
+
+func TestSessionWatchStopsOnError(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	s.SessionStates = []string{"starting", "idle", "error"}
+	b := NewSession(c)
+	err := b.New(&NewSessionQuery{Kind: KindSpark})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := b.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := drainWithClock(clock, time.Second, ch)
+	states := []string{}
+	for _, msg := range msgs {
+		states = append(states, msg.State)
+	}
+	if strings.Join(states, ",") != "idle,error" {
+		t.Errorf("收到的状态为%v,应为[idle error]", states)
+	}
+}
+
+//waitHeartbeats 等待session 0收到的心跳达到n次
+func waitHeartbeats(t *testing.T, s *livytest.Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Heartbeats(0) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时,收到了%d次心跳,应为%d次", s.Heartbeats(0), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSessionKeepAlive(t *testing.T) {
+	cases := []struct {
+		timeout  time.Duration
+		interval time.Duration
+	}{
+		{90 * time.Second, 30 * time.Second},
+		{0, DefaultHeartbeatInterval},
+	}
+	for _, c := range cases {
+		s, b, clock := newTestSession(t, KindSpark)
+		b.HeartbeatTimeout = c.timeout
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := b.KeepAlive(ctx)
+		waitHeartbeats(t, s, 1)
+		clock.BlockUntil(1)
+		clock.Advance(c.interval - time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		if n := s.Heartbeats(0); n != 1 {
+			t.Errorf("HeartbeatTimeout为%s时,间隔不到%s就发送了%d次心跳", c.timeout, c.interval, n)
+		}
+		clock.Advance(time.Millisecond)
+		waitHeartbeats(t, s, 2)
+		cancel()
+		for err := range errs {
+			t.Errorf("心跳不应出错,err为%v", err)
+		}
+	}
+}
+
+func TestSessionKeepAliveStopsWhenDead(t *testing.T) {
+	s, b, clock := newTestSession(t, KindSpark)
+	errs := b.KeepAlive(context.Background())
+	waitHeartbeats(t, s, 1)
+	if err := s.ScriptSession(0, "dead"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errs {
+			t.Errorf("session结束时不应返回错误,err为%v", err)
+		}
+	}()
+	advanceUntil(clock, DefaultHeartbeatInterval, done)
+	if n := s.Heartbeats(0); n != 2 {
+		t.Errorf("收到了%d次心跳,应为2次", n)
+	}
+}
+
+func TestSessionKeepAliveErrors(t *testing.T) {
+	s, b, clock := newTestSession(t, KindSpark)
+	s.InjectFailure(livytest.Failure{Method: http.MethodPost, Path: "/sessions/0/connect", Status: http.StatusInternalServerError, Times: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := b.KeepAlive(ctx)
+	//心跳失败后继续发送
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "心跳失败") {
+		t.Errorf("err为%v,应为心跳失败", err)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(DefaultHeartbeatInterval)
+	waitHeartbeats(t, s, 1)
+	cancel()
+	for err := range errs {
+		t.Errorf("取消后不应返回错误,err为%v", err)
+	}
+
+	//session不存在时停止
+	b.ID = 42
+	errs = b.KeepAlive(context.Background())
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "未找到资源") {
+		t.Errorf("err为%v,应为未找到资源", err)
+	}
+	if _, ok := <-errs; ok {
+		t.Error("session不存在时应关闭channel")
+	}
+}
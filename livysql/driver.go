@@ -0,0 +1,347 @@
+//Package livysql 基于livy的sql类型statement实现的database/sql驱动,驱动名为livy
+//
+//每个连接对应一个livy的session,sql以sql类型的statement执行,结果从表格输出中读取:
+//
+//	db, err := sql.Open("livy", "http://livy:8998?kind=spark&proxyUser=bob")
+//	rows, err := db.QueryContext(ctx, "SELECT id, name FROM users WHERE age > ?", 18)
+//
+//参数使用?占位,执行前会被替换为spark sql的字面量;livy不支持事务。
+//livy最多返回livy.rsc.sql.num-rows(默认1000)行,结果的行数达到lc.SQLRowLimit时查询返回lc.ErrRowLimit,
+//需要更多的行时使用Session.Collect
+package livysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	lc "golivyclient"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+func init() {
+	sql.Register("livy", &Driver{})
+}
+
+//ErrNoTransaction livy不支持事务
+var ErrNoTransaction = errors.New("livy不支持事务")
+
+//Driver livy的database/sql驱动
+type Driver struct{}
+
+//Open 实现driver.Driver
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+//OpenConnector 实现driver.DriverContext
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnector(&lc.LivyClient{BASEURL: cfg.URL}, cfg), nil
+}
+
+//Connector 使用指定的客户端创建连接,可以配合sql.OpenDB使用自定义的LivyClient
+type Connector struct {
+	client *lc.LivyClient
+	config Config
+}
+
+//NewConnector 创建Connector,cfg.URL会被忽略,使用client的BASEURL
+func NewConnector(client *lc.LivyClient, cfg *Config) *Connector {
+	c := new(Connector)
+	c.client = client
+	c.config = *cfg
+	if c.config.PollInterval <= 0 {
+		c.config.PollInterval = time.Second
+	}
+	return c
+}
+
+//Driver 实现driver.Connector
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+//Connect 实现driver.Connector,创建新的session并等待其启动完成,配置了SessionID时使用已经存在的session
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	s := c.client.NewSession()
+	if c.config.SessionID != nil {
+		s.ID = *c.config.SessionID
+		err := s.Wait(ctx, c.config.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+		return &conn{session: s, pollInterval: c.config.PollInterval}, nil
+	}
+	q := c.config.Session
+	err := s.NewWithContext(ctx, &q)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Wait(ctx, c.config.PollInterval)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &conn{session: s, owned: true, pollInterval: c.config.PollInterval}, nil
+}
+
+//conn 一个livy的session
+type conn struct {
+	session      *lc.Session
+	owned        bool
+	pollInterval time.Duration
+	bad          bool
+}
+
+//Prepare 实现driver.Conn
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+//Close 实现driver.Conn,删除连接创建的session
+func (c *conn) Close() error {
+	if !c.owned {
+		return nil
+	}
+	return c.session.Close()
+}
+
+//Begin 实现driver.Conn
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, ErrNoTransaction
+}
+
+//Ping 实现driver.Pinger,检查session是否可用
+func (c *conn) Ping(ctx context.Context) error {
+	api := c.session.Client.API
+	if api == nil {
+		api = c.session.Client
+	}
+	st, err := api.GetSessionState(ctx, c.session.ID)
+	if err != nil {
+		c.bad = true
+		return driver.ErrBadConn
+	}
+	state := struct {
+		State string `json:"state"`
+	}{}
+	json.Unmarshal(st, &state)
+	switch state.State {
+	case "shutting_down", "error", "dead", "killed", "success":
+		c.bad = true
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+//IsValid 实现driver.Validator
+func (c *conn) IsValid() bool {
+	return !c.bad
+}
+
+//CheckNamedValue 实现driver.NamedValueChecker,允许Literal支持的所有类型作为参数
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if valuer, ok := nv.Value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		nv.Value = v
+		return nil
+	}
+	_, err := lc.Literal(lc.KindSQL, nv.Value)
+	return err
+}
+
+//QueryContext 实现driver.QueryerContext
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	st, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	table, err := st.Table()
+	if err != nil {
+		return nil, err
+	}
+	if table.Truncated() {
+		return nil, lc.ErrRowLimit
+	}
+	return &rows{table: table}, nil
+}
+
+//ExecContext 实现driver.ExecerContext,livy不返回影响的行数
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.ResultNoRows, nil
+}
+
+//run 执行sql并等待结束,ctx取消时取消livy中的statement
+func (c *conn) run(ctx context.Context, query string, args []driver.NamedValue) (*lc.Statement, error) {
+	code, err := interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	//不通过Session.NewStatement创建,避免长期使用的连接在Session.Statements中积累statement
+	st := &lc.Statement{Session: c.session, URI: "statements"}
+	err = st.NewWithContext(ctx, &lc.NewStatementQuery{Code: code, Kind: lc.KindSQL})
+	if err != nil {
+		return nil, c.checkErr(err)
+	}
+	err = st.Wait(ctx, c.pollInterval)
+	if err != nil {
+		if ctx.Err() != nil {
+			st.Cancel()
+			return nil, ctx.Err()
+		}
+		return nil, c.checkErr(err)
+	}
+	return st, st.Err()
+}
+
+//checkErr session已经不存在时将连接标记为不可用
+func (c *conn) checkErr(err error) error {
+	if strings.HasPrefix(err.Error(), "未找到资源") {
+		c.bad = true
+		return fmt.Errorf("session %d已不存在:%w", c.session.ID, driver.ErrBadConn)
+	}
+	return err
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+//Close 实现driver.Stmt
+func (s *stmt) Close() error {
+	return nil
+}
+
+//NumInput 实现driver.Stmt
+func (s *stmt) NumInput() int {
+	return countPlaceholders(s.query)
+}
+
+//Exec 实现driver.Stmt
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, named(args))
+}
+
+//Query 实现driver.Stmt
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, named(args))
+}
+
+//ExecContext 实现driver.StmtExecContext
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+//QueryContext 实现driver.StmtQueryContext
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	res := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		res[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return res
+}
+
+//rows 表格结果的行
+type rows struct {
+	table *lc.TableResult
+	next  int
+}
+
+//Columns 实现driver.Rows
+func (r *rows) Columns() []string {
+	res := make([]string, len(r.table.Columns))
+	for i, col := range r.table.Columns {
+		res[i] = col.Name
+	}
+	return res
+}
+
+//Close 实现driver.Rows
+func (r *rows) Close() error {
+	return nil
+}
+
+//Next 实现driver.Rows,复杂类型的值转为json字符串
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.table.Rows) {
+		return io.EOF
+	}
+	row := r.table.Rows[r.next]
+	r.next++
+	for i, col := range r.table.Columns {
+		if i >= len(row) {
+			dest[i] = nil
+			continue
+		}
+		v, err := col.Value(row[i])
+		if err != nil {
+			return err
+		}
+		switch v.(type) {
+		case nil, int64, float64, bool, string, time.Time:
+		default:
+			v, err = json.MarshalToString(v)
+			if err != nil {
+				return err
+			}
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+//ColumnTypeDatabaseTypeName 实现driver.RowsColumnTypeDatabaseTypeName
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.table.Columns[index].BaseType())
+}
+
+var (
+	int64Type   = reflect.TypeOf(int64(0))
+	float64Type = reflect.TypeOf(float64(0))
+	boolType    = reflect.TypeOf(false)
+	stringType  = reflect.TypeOf("")
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+//ColumnTypeScanType 实现driver.RowsColumnTypeScanType
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	switch r.table.Columns[index].BaseType() {
+	case "long", "integer", "short", "byte":
+		return int64Type
+	case "double", "float":
+		return float64Type
+	case "boolean":
+		return boolType
+	case "timestamp", "date":
+		return timeType
+	}
+	return stringType
+}
@@ -0,0 +1,417 @@
+package livysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lc "golivyclient"
+	"golivyclient/livytest"
+)
+
+//tableResult 生成表格输出,headers为列名和类型交替的列表
+func tableResult(rows [][]interface{}, headers ...string) map[string]interface{} {
+	cols := []interface{}{}
+	for i := 0; i+1 < len(headers); i += 2 {
+		cols = append(cols, map[string]string{"name": headers[i], "type": headers[i+1]})
+	}
+	return map[string]interface{}{lc.TableMimeType: map[string]interface{}{"headers": cols, "data": rows}}
+}
+
+//newTestDB 在假服务上打开数据库,session和statement都直接进入最终状态
+func newTestDB(t *testing.T, result func(code string) (map[string]interface{}, error)) (*livytest.Server, *sql.DB, *livytest.FakeClock) {
+	t.Helper()
+	s := livytest.NewServer()
+	t.Cleanup(s.Close)
+	s.SessionStates = []string{"idle"}
+	s.StatementStates = []string{"available"}
+	s.StatementResult = result
+	clock := livytest.NewFakeClock(time.Unix(0, 0))
+	c := lc.NewClient(s.URL)
+	c.Clock = clock
+	db := sql.OpenDB(NewConnector(c, &Config{Session: lc.NewSessionQuery{Kind: lc.KindSpark}}))
+	t.Cleanup(func() { db.Close() })
+	return s, db, clock
+}
+
+//submittedCode 最后一个提交的statement的代码和类型
+func submittedCode(t *testing.T, s *livytest.Server) (string, string) {
+	t.Helper()
+	reqs := s.Requests()
+	for i := len(reqs) - 1; i >= 0; i-- {
+		if reqs[i].Method == http.MethodPost && strings.HasSuffix(reqs[i].Path, "/statements") {
+			q := lc.NewStatementQuery{}
+			if err := json.Unmarshal(reqs[i].Body, &q); err != nil {
+				t.Fatal(err)
+			}
+			return q.Code, q.Kind
+		}
+	}
+	t.Fatal("没有提交statement")
+	return "", ""
+}
+
+func TestQueryRows(t *testing.T) {
+	s, db, _ := newTestDB(t, func(code string) (map[string]interface{}, error) {
+		return tableResult([][]interface{}{
+			{1, 1.5, "12.30", true, "2024-01-02 03:04:05", "2024-01-02", "a", []interface{}{1, 2}, map[string]interface{}{"k": "v"}},
+			{nil, nil, nil, nil, nil, nil, nil, nil, nil},
+		}, "id", "BIGINT_TYPE", "score", "DOUBLE_TYPE", "amount", "DECIMAL_TYPE", "ok", "BOOLEAN_TYPE",
+			"ts", "TIMESTAMP_TYPE", "day", "DATE_TYPE", "name", "STRING_TYPE", "arr", "ARRAY_TYPE", "m", "MAP_TYPE"), nil
+	})
+	rows, err := db.QueryContext(context.Background(), "SELECT * FROM t WHERE name = ? AND age > ?", "o'neil", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if code, kind := submittedCode(t, s); code != `SELECT * FROM t WHERE name = 'o\'neil' AND age > 18` || kind != lc.KindSQL {
+		t.Errorf("提交的代码为%s,类型为%s", code, kind)
+	}
+	cols, err := rows.Columns()
+	if err != nil || strings.Join(cols, ",") != "id,score,amount,ok,ts,day,name,arr,m" {
+		t.Errorf("Columns为%v,%v", cols, err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTypes := []struct {
+		name string
+		scan reflect.Type
+	}{
+		{"LONG", reflect.TypeOf(int64(0))},
+		{"DOUBLE", reflect.TypeOf(float64(0))},
+		{"DECIMAL", reflect.TypeOf("")},
+		{"BOOLEAN", reflect.TypeOf(false)},
+		{"TIMESTAMP", reflect.TypeOf(time.Time{})},
+		{"DATE", reflect.TypeOf(time.Time{})},
+		{"STRING", reflect.TypeOf("")},
+		{"ARRAY", reflect.TypeOf("")},
+		{"MAP", reflect.TypeOf("")},
+	}
+	for i, want := range wantTypes {
+		if types[i].DatabaseTypeName() != want.name || types[i].ScanType() != want.scan {
+			t.Errorf("第%d列的类型为%s,%s,应为%s,%s", i, types[i].DatabaseTypeName(), types[i].ScanType(), want.name, want.scan)
+		}
+	}
+
+	var (
+		id      int64
+		score   float64
+		amount  string
+		ok      bool
+		ts, day time.Time
+		name    string
+		arr, m  string
+	)
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	err = rows.Scan(&id, &score, &amount, &ok, &ts, &day, &name, &arr, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || score != 1.5 || amount != "12.30" || !ok || name != "a" {
+		t.Errorf("第0行为%v,%v,%v,%v,%v", id, score, amount, ok, name)
+	}
+	if !ts.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) || !day.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ts为%s,day为%s", ts, day)
+	}
+	//复杂类型转为json字符串
+	if arr != "[1,2]" || m != `{"k":"v"}` {
+		t.Errorf("arr为%s,m为%s", arr, m)
+	}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	var (
+		nid    sql.NullInt64
+		nscore sql.NullFloat64
+		nstr   [3]sql.NullString
+		nbool  sql.NullBool
+		nts    [2]sql.NullTime
+		narr   *string
+	)
+	err = rows.Scan(&nid, &nscore, &nstr[0], &nbool, &nts[0], &nts[1], &nstr[1], &narr, &nstr[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nid.Valid || nscore.Valid || nstr[0].Valid || nbool.Valid || nts[0].Valid || nts[1].Valid || nstr[1].Valid || narr != nil || nstr[2].Valid {
+		t.Error("null应扫描为无效值")
+	}
+	if rows.Next() {
+		t.Error("只有两行")
+	}
+	if err := rows.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryRowScanErrors(t *testing.T) {
+	_, db, _ := newTestDB(t, func(code string) (map[string]interface{}, error) {
+		switch code {
+		case "SELECT bad":
+			return tableResult([][]interface{}{{"x"}}, "n", "BIGINT_TYPE"), nil
+		case "SELECT fail":
+			return nil, errors.New("AnalysisException: cannot resolve 'x'")
+		}
+		return map[string]interface{}{lc.TextMimeType: "done"}, nil
+	})
+	ctx := context.Background()
+	var n int64
+	if err := db.QueryRowContext(ctx, "SELECT bad").Scan(&n); err == nil {
+		t.Error("long列的值不是数字时应返回错误")
+	}
+	if err := db.QueryRowContext(ctx, "SELECT fail").Scan(&n); err == nil || !strings.Contains(err.Error(), "cannot resolve") {
+		t.Errorf("执行失败时应返回livy的错误,err为%v", err)
+	}
+	if err := db.QueryRowContext(ctx, "CREATE TABLE t (a INT)").Scan(&n); err == nil {
+		t.Error("输出不是表格时查询应返回错误")
+	}
+	if _, err := db.ExecContext(ctx, "CREATE TABLE t (a INT)"); err != nil {
+		t.Errorf("Exec不需要表格输出,err为%v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT ?", struct{}{}).Scan(&n); err == nil {
+		t.Error("不支持的参数类型应返回错误")
+	}
+}
+
+func TestQueryRowLimit(t *testing.T) {
+	limit := lc.SQLRowLimit
+	t.Cleanup(func() { lc.SQLRowLimit = limit })
+	lc.SQLRowLimit = 2
+	n := 0
+	_, db, _ := newTestDB(t, func(code string) (map[string]interface{}, error) {
+		data := [][]interface{}{}
+		for i := 0; i < n; i++ {
+			data = append(data, []interface{}{i})
+		}
+		return tableResult(data, "id", "INT_TYPE"), nil
+	})
+	ctx := context.Background()
+	for _, c := range []struct {
+		rows int
+		err  error
+	}{{1, nil}, {2, lc.ErrRowLimit}, {3, lc.ErrRowLimit}} {
+		n = c.rows
+		rows, err := db.QueryContext(ctx, "SELECT id FROM t")
+		if !errors.Is(err, c.err) {
+			t.Errorf("%d行时err为%v,应为%v", c.rows, err, c.err)
+		}
+		if err == nil {
+			rows.Close()
+		}
+	}
+}
+
+func TestStmt(t *testing.T) {
+	s, db, _ := newTestDB(t, func(code string) (map[string]interface{}, error) {
+		return tableResult([][]interface{}{{code}}, "code", "STRING_TYPE"), nil
+	})
+	st, err := db.Prepare("SELECT ? AS a, '?' AS b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	var code string
+	err = st.QueryRow(int64(7)).Scan(&code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "SELECT 7 AS a, '?' AS b" {
+		t.Errorf("执行的代码为%s", code)
+	}
+	//NumInput按占位符检查参数个数
+	if err := st.QueryRow().Scan(&code); err == nil {
+		t.Error("参数个数不对时应返回错误")
+	}
+	res, err := st.Exec(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.RowsAffected(); err == nil {
+		t.Error("livy不返回影响的行数")
+	}
+	if code, _ := submittedCode(t, s); code != "SELECT TIMESTAMP '2024-01-02 00:00:00Z' AS a, '?' AS b" {
+		t.Errorf("执行的代码为%s", code)
+	}
+	//driver.Valuer的参数先转换
+	if err := st.QueryRow(sql.NullString{String: "x", Valid: true}).Scan(&code); err != nil || code != "SELECT 'x' AS a, '?' AS b" {
+		t.Errorf("执行的代码为%s,err为%v", code, err)
+	}
+}
+
+func TestDriverStmtDirect(t *testing.T) {
+	s := livytest.NewServer()
+	defer s.Close()
+	s.SessionStates = []string{"idle"}
+	s.StatementStates = []string{"available"}
+	s.StatementResult = func(code string) (map[string]interface{}, error) {
+		return tableResult([][]interface{}{{1, "x", nil}}, "a", "INT_TYPE", "b", "STRING_TYPE", "c", "DOUBLE_TYPE"), nil
+	}
+	d := &Driver{}
+	c, err := d.Open(s.URL + "?kind=spark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	st, err := c.Prepare("SELECT ?, ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.NumInput() != 2 {
+		t.Errorf("NumInput为%d", st.NumInput())
+	}
+	r, err := st.Query([]driver.Value{int64(1), "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]driver.Value, 3)
+	if err := r.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dest, []driver.Value{int64(1), "x", nil}) {
+		t.Errorf("第0行为%#v", dest)
+	}
+	if err := r.Next(dest); err == nil {
+		t.Error("没有更多行时应返回io.EOF")
+	}
+	if _, err := c.Begin(); err != ErrNoTransaction {
+		t.Errorf("Begin应返回ErrNoTransaction,err为%v", err)
+	}
+}
+
+func TestBadConnReconnects(t *testing.T) {
+	s, db, _ := newTestDB(t, func(code string) (map[string]interface{}, error) {
+		return tableResult([][]interface{}{{1}}, "a", "INT_TYPE"), nil
+	})
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	//session被其他客户端删除后,连接不可用,database/sql重新建立连接
+	c := lc.NewClient(s.URL)
+	if err := c.DeleteSession(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(sessionPosts(s)); got != 2 {
+		t.Errorf("创建了%d个session,应为2个", got)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		t.Errorf("新的session可用,Ping返回了%v", err)
+	}
+	if err := s.ScriptSession(1, "dead"); err != nil {
+		t.Fatal(err)
+	}
+	//Ping发现session已结束时返回ErrBadConn并丢弃连接,之后使用新的连接
+	if err := db.PingContext(ctx); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("session已结束时Ping应返回driver.ErrBadConn,err为%v", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		t.Errorf("Ping时应重新建立连接,err为%v", err)
+	}
+	if got := len(sessionPosts(s)); got != 3 {
+		t.Errorf("创建了%d个session,应为3个", got)
+	}
+}
+
+func sessionPosts(s *livytest.Server) []livytest.RecordedRequest {
+	res := []livytest.RecordedRequest{}
+	for _, r := range s.Requests() {
+		if r.Method == http.MethodPost && r.Path == "/sessions" {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+func TestQueryCancel(t *testing.T) {
+	s, db, clock := newTestDB(t, nil)
+	s.StatementStates = []string{"running"}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := db.ExecContext(ctx, "SELECT count(*) FROM big")
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("err为%v,应为context.Canceled", err)
+	}
+	n := 0
+	for _, r := range s.Requests() {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.Path, "/cancel") {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("取消了%d次,应为1次", n)
+	}
+}
+
+func TestConnCloseDeletesOwnedSession(t *testing.T) {
+	s := livytest.NewServer()
+	defer s.Close()
+	s.SessionStates = []string{"idle"}
+	db, err := sql.Open("livy", s.URL+"?kind=sql&name=bi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if posts := sessionPosts(s); len(posts) != 1 || !strings.Contains(string(posts[0].Body), `"name":"bi"`) {
+		t.Errorf("创建session的请求为%v", posts)
+	}
+	deleted := func() int {
+		n := 0
+		for _, r := range s.Requests() {
+			if r.Method == http.MethodDelete {
+				n++
+			}
+		}
+		return n
+	}
+	if deleted() != 1 {
+		t.Errorf("关闭连接时应删除创建的session")
+	}
+	//使用已经存在的session时不删除
+	db, err = sql.Open("livy", s.URL+"?sessionId=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err == nil {
+		t.Error("session不存在时应返回错误")
+	}
+	db.Close()
+	c := lc.NewClient(s.URL)
+	ss := c.NewSession()
+	if err := ss.New(&lc.NewSessionQuery{Kind: lc.KindSQL}); err != nil {
+		t.Fatal(err)
+	}
+	db, err = sql.Open("livy", s.URL+"?sessionId=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if deleted() != 1 {
+		t.Errorf("关闭使用已有session的连接时不应删除session")
+	}
+}
@@ -0,0 +1,123 @@
+package livysql
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	lc "golivyclient"
+)
+
+//Config 连接livy的配置
+type Config struct {
+	//URL livy的地址
+	URL string
+	//Session 每个连接创建session时使用的请求,Kind为空时使用spark
+	Session lc.NewSessionQuery
+	//SessionID 不为nil时连接使用已经存在的session,关闭连接时不删除该session
+	SessionID *int
+	//PollInterval 等待session启动和statement执行结束的轮询间隔,为0时使用1秒
+	PollInterval time.Duration
+}
+
+//ParseDSN 解析DSN,DSN为livy的地址,查询参数为session的设置,如
+//
+//	http://livy:8998?kind=spark&proxyUser=bob&queue=bi&numExecutors=4&conf.spark.sql.shuffle.partitions=64
+//
+//支持的参数为name,kind,proxyUser,queue,driverMemory,driverCores,executorMemory,executorCores,
+//numExecutors,heartbeatTimeoutInSecond,jars,pyFiles,files,archives(逗号分隔),
+//以conf.开头的spark配置,sessionId(使用已经存在的session)和pollInterval(如500ms)
+func ParseDSN(dsn string) (*Config, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("DSN格式错误:%w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("DSN必须为http或https地址:%s", dsn)
+	}
+	params := u.Query()
+	u.RawQuery = ""
+	u.Fragment = ""
+	cfg := new(Config)
+	cfg.URL = strings.TrimSuffix(u.String(), "/")
+	q := &cfg.Session
+	for key, values := range params {
+		value := values[len(values)-1]
+		if strings.HasPrefix(key, "conf.") {
+			if q.Conf == nil {
+				q.Conf = map[string]interface{}{}
+			}
+			q.Conf[strings.TrimPrefix(key, "conf.")] = value
+			continue
+		}
+		switch key {
+		case "name":
+			q.Name = value
+		case "kind":
+			q.Kind = value
+		case "proxyUser":
+			q.ProxyUser = value
+		case "queue":
+			q.Queue = value
+		case "driverMemory":
+			q.DriverMemory = value
+		case "executorMemory":
+			q.ExecutorMemory = value
+		case "driverCores":
+			err = parseInt(key, value, &q.DriverCores)
+		case "executorCores":
+			err = parseInt(key, value, &q.ExecutorCores)
+		case "numExecutors":
+			err = parseInt(key, value, &q.NumExecutors)
+		case "heartbeatTimeoutInSecond":
+			err = parseInt(key, value, &q.HeartbeatTimeoutInSecond)
+		case "jars":
+			q.Jars = splitList(value)
+		case "pyFiles":
+			q.PyFiles = splitList(value)
+		case "files":
+			q.Files = splitList(value)
+		case "archives":
+			q.Archives = splitList(value)
+		case "sessionId":
+			id := 0
+			err = parseInt(key, value, &id)
+			cfg.SessionID = &id
+		case "pollInterval":
+			cfg.PollInterval, err = time.ParseDuration(value)
+			if err != nil {
+				err = fmt.Errorf("DSN参数pollInterval格式错误:%s", value)
+			}
+		default:
+			err = fmt.Errorf("不支持的DSN参数:%s", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if q.Kind == "" {
+		q.Kind = "spark"
+	}
+	return cfg, nil
+}
+
+func parseInt(key string, value string, dst *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("DSN参数%s必须为整数:%s", key, value)
+	}
+	*dst = n
+	return nil
+}
+
+func splitList(value string) []string {
+	res := []string{}
+	for _, ele := range strings.Split(value, ",") {
+		if ele = strings.TrimSpace(ele); ele != "" {
+			res = append(res, ele)
+		}
+	}
+	return res
+}
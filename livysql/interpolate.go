@@ -0,0 +1,92 @@
+package livysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	lc "golivyclient"
+)
+
+//countPlaceholders 统计sql中字符串,标识符和注释以外的?数量
+func countPlaceholders(query string) int {
+	n := 0
+	scanSQL(query, func(i int) {
+		n++
+	})
+	return n
+}
+
+//interpolate 将sql中的?依次替换为参数的spark sql字面量
+func interpolate(query string, args []driver.NamedValue) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	for _, arg := range args {
+		if arg.Name != "" {
+			return "", errors.New("不支持命名参数")
+		}
+	}
+	var sb strings.Builder
+	var err error
+	n := 0
+	last := 0
+	scanSQL(query, func(i int) {
+		if err != nil {
+			return
+		}
+		if n >= len(args) {
+			err = fmt.Errorf("sql中的参数多于传入的%d个参数", len(args))
+			return
+		}
+		literal, lerr := lc.Literal(lc.KindSQL, args[n].Value)
+		if lerr != nil {
+			err = fmt.Errorf("参数%d:%w", n+1, lerr)
+			return
+		}
+		sb.WriteString(query[last:i])
+		sb.WriteString(literal)
+		last = i + 1
+		n++
+	})
+	if err != nil {
+		return "", err
+	}
+	if n != len(args) {
+		return "", fmt.Errorf("sql中有%d个参数,传入了%d个参数", n, len(args))
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), nil
+}
+
+//scanSQL 扫描sql,对字符串,标识符和注释以外的每个?调用placeholder
+func scanSQL(query string, placeholder func(i int)) {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '?':
+			placeholder(i)
+		case '\'', '"', '`':
+			//spark sql的字符串支持反斜杠转义,反引号中的标识符使用两个反引号转义
+			for i++; i < len(query) && query[i] != c; i++ {
+				if c != '`' && query[i] == '\\' {
+					i++
+				}
+			}
+		case '-':
+			if i+1 < len(query) && query[i+1] == '-' {
+				for i < len(query) && query[i] != '\n' {
+					i++
+				}
+			}
+		case '/':
+			if i+1 < len(query) && query[i+1] == '*' {
+				end := strings.Index(query[i+2:], "*/")
+				if end < 0 {
+					return
+				}
+				i += end + 3
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package livysql
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func positional(values ...interface{}) []driver.NamedValue {
+	args := make([]driver.NamedValue, len(values))
+	for i, v := range values {
+		args[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return args
+}
+
+func TestInterpolate(t *testing.T) {
+	cases := []struct {
+		query string
+		args  []driver.NamedValue
+		want  string
+	}{
+		{"SELECT 1", nil, "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", positional(int64(1), "x"), "SELECT * FROM t WHERE a = 1 AND b = 'x'"},
+		{"SELECT ?", positional("it's \\ ${x}"), `SELECT 'it\'s \\ ${x}'`},
+		{"SELECT ?, ?, ?", positional(nil, true, 1.5), "SELECT NULL, TRUE, 1.5D"},
+		{"SELECT ?", positional(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), "SELECT TIMESTAMP '2024-01-02 03:04:05Z'"},
+		{"SELECT '?', \"?\", `a?b`, ? FROM t", positional(int64(1)), "SELECT '?', \"?\", `a?b`, 1 FROM t"},
+		{`SELECT 'a\'?', ?`, positional(int64(1)), `SELECT 'a\'?', 1`},
+		{"SELECT ? -- ?\n, ?", positional(int64(1), int64(2)), "SELECT 1 -- ?\n, 2"},
+		{"SELECT /* ? */ ?", positional(int64(1)), "SELECT /* ? */ 1"},
+	}
+	for _, c := range cases {
+		got, err := interpolate(c.query, c.args)
+		if err != nil {
+			t.Errorf("interpolate(%q)返回错误%v", c.query, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("interpolate(%q)为%s,应为%s", c.query, got, c.want)
+		}
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	cases := []struct {
+		query string
+		args  []driver.NamedValue
+	}{
+		{"SELECT ?, ?", positional(int64(1))},
+		{"SELECT ?", positional(int64(1), int64(2))},
+		{"SELECT '?'", positional(int64(1))},
+		{"SELECT ?", []driver.NamedValue{{Name: "a", Ordinal: 1, Value: int64(1)}}},
+		{"SELECT ?", positional(struct{}{})},
+	}
+	for _, c := range cases {
+		got, err := interpolate(c.query, c.args)
+		if err == nil {
+			t.Errorf("interpolate(%q)为%s,应返回错误", c.query, got)
+		}
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	cases := map[string]int{
+		"SELECT 1":                  0,
+		"SELECT ?, ?":               2,
+		"SELECT '?', `?`, \"?\", ?": 1,
+		"SELECT ? -- ?\n":           1,
+		"SELECT ? /* ? */ ?":        2,
+		"SELECT ? /* 没有结束的注释 ?":     1,
+		`SELECT 'a\'?' = ?`:         1,
+		"SELECT `a``?` = ?":         1,
+	}
+	for query, want := range cases {
+		if got := countPlaceholders(query); got != want {
+			t.Errorf("countPlaceholders(%q)为%d,应为%d", query, got, want)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package golivyclient
 
 import (
+	"context"
 	jsonl "encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
-	log "github.com/Basic-Components/loggerhelper"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //StatementOutput  会话请求的输出结果
@@ -14,6 +15,12 @@ type StatementOutput struct {
 	Status         string            `json:"status"`
 	ExecutionCount int               `json:"execution_count"`
 	Data           *jsonl.RawMessage `json:"data"`
+	//Ename Status为error时的错误类型
+	Ename string `json:"ename,omitempty"`
+	//Evalue Status为error时的错误信息
+	Evalue string `json:"evalue,omitempty"`
+	//Traceback Status为error时的调用栈
+	Traceback []string `json:"traceback,omitempty"`
 }
 
 //Statement livy的会话的请求,用于管理交互模式提交的代码
@@ -48,13 +55,25 @@ func NewStatement(s *Session) *Statement {
 
 //New 创建Statement种新的Statement的请求,结果更新到自身
 func (b *Statement) New(q *NewStatementQuery) error {
+	return b.NewWithContext(context.Background(), q)
+}
 
-	url := fmt.Sprintf("%s/%s/%d/%s", b.Session.Client.BASEURL, b.Session.URI, b.Session.ID, b.URI)
-	resBytes, err := HTTPJSONQuery(url, "POST", q)
+//NewWithContext 与New相同,ctx用于取消请求和传递追踪信息
+func (b *Statement) NewWithContext(ctx context.Context, q *NewStatementQuery) (err error) {
+	kind := q.Kind
+	if kind == "" {
+		kind = b.Session.Kind
+	}
+	ctx, span := b.Session.Client.tracer().Start(ctx, "livy.statement.new", trace.WithAttributes(AttrSessionID.Int(b.Session.ID), AttrKind.String(kind)))
+	defer func() {
+		endSpan(span, err)
+	}()
+	resBytes, err := b.Session.Client.api().CreateStatement(ctx, b.Session.ID, q)
 	if err != nil {
 		return err
 	}
 	json.Unmarshal(resBytes, b)
+	span.SetAttributes(AttrStatementID.Int(b.ID), AttrState.String(b.State))
 	return nil
 }
 
@@ -87,8 +106,11 @@ func (b *Statement) ToJSON() ([]byte, error) {
 
 //BytesInfo 获取Statement对象的信息
 func (b *Statement) BytesInfo() ([]byte, error) {
-	url := fmt.Sprintf("%s/%s/%d/%s/%d", b.Session.Client.BASEURL, b.Session.URI, b.Session.ID, b.URI, b.ID)
-	resBytes, err := HTTPJSONQuery(url, "GET")
+	return b.bytesInfo(context.Background())
+}
+
+func (b *Statement) bytesInfo(ctx context.Context) ([]byte, error) {
+	resBytes, err := b.Session.Client.api().GetStatement(ctx, b.Session.ID, b.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +135,11 @@ func (b *Statement) Info() (*Statement, error) {
 
 //Update 更新自身
 func (b *Statement) Update() ([]byte, error) {
-	resb, err := b.BytesInfo()
+	return b.update(context.Background())
+}
+
+func (b *Statement) update(ctx context.Context) ([]byte, error) {
+	resb, err := b.bytesInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -128,20 +154,40 @@ func (b *Statement) Update() ([]byte, error) {
 	b.Progress = nb.Progress
 	b.Started = nb.Started
 	b.Completed = nb.Completed
+	if b.State != nb.State {
+		switch nb.State {
+		case "available", "error", "cancelled":
+			if nb.Started > 0 && nb.Completed >= nb.Started {
+				b.Session.Client.metrics().ObserveStatement(nb.State, time.Duration(nb.Completed-nb.Started)*time.Millisecond)
+			}
+		}
+	}
 	b.State = nb.State
 	return resb, nil
 }
 
 //Cancel 取消代码执行
 func (b *Statement) Cancel() error {
-	url := fmt.Sprintf("%s/%s/%d/%s/%d/cancel", b.Session.Client.BASEURL, b.Session.URI, b.Session.ID, b.URI, b.ID)
-	_, err := HTTPJSONQuery(url, "POST")
+	err := b.Session.Client.api().CancelStatement(context.Background(), b.Session.ID, b.ID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+//Err 代码执行出错或被取消时返回错误信息
+func (b *Statement) Err() error {
+	switch {
+	case b.State == "cancelled":
+		return fmt.Errorf("statement %d已取消", b.ID)
+	case b.State == "error":
+		return fmt.Errorf("statement %d执行失败", b.ID)
+	case b.Output != nil && b.Output.Status == "error":
+		return fmt.Errorf("statement %d执行失败:%s:%s", b.ID, b.Output.Ename, b.Output.Evalue)
+	}
+	return nil
+}
+
 //StatementUpdateMsg Batch更新消息
 type StatementUpdateMsg struct {
 	State string
@@ -149,18 +195,29 @@ type StatementUpdateMsg struct {
 	Old   *Statement
 }
 
-func (b *Statement) watch(interval time.Duration, ch chan StatementUpdateMsg) {
+func (b *Statement) url() string {
+	return fmt.Sprintf("%s/%s/%d/%s/%d", b.Session.Client.BASEURL, b.Session.URI, b.Session.ID, b.URI, b.ID)
+}
+
+func (b *Statement) watch(ctx context.Context, interval time.Duration, ch chan StatementUpdateMsg) {
+	logger := b.Session.Client.logger()
+	attempt := 0
+	ctx, span := b.Session.Client.tracer().Start(ctx, "livy.statement.watch", trace.WithAttributes(AttrSessionID.Int(b.Session.ID), AttrStatementID.Int(b.ID)))
+	b.Session.Client.metrics().WatcherStarted("statement")
+	defer b.Session.Client.metrics().WatcherStopped("statement")
 	defer func() {
+		var errE error
 		err := recover()
 		if err != nil {
-			log.Error(map[string]interface{}{
-				"err": err,
-			}, "batch watch error")
+			errE = fmt.Errorf("%v", err)
+			logger.Error("statement watch error", "session_id", b.Session.ID, "statement_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt, "err", err)
 			ch <- StatementUpdateMsg{
 				State: "watch_err",
 			}
 		}
 		close(ch)
+		span.SetAttributes(AttrState.String(b.State))
+		endSpan(span, errE)
 	}()
 	var oldbb []byte
 	var newbb []byte
@@ -171,11 +228,13 @@ func (b *Statement) watch(interval time.Duration, ch chan StatementUpdateMsg) {
 	oldbb = bb
 OuterLoop:
 	for {
+		attempt++
 		oldb := b.Copy()
-		gb, err := b.Update()
+		gb, err := b.update(ctx)
 		if err != nil {
 			panic(err)
 		}
+		logger.Debug("statement watch poll", "session_id", b.Session.ID, "statement_id", b.ID, "state", b.State, "url", b.url(), "attempt", attempt)
 		if newbb != nil {
 			oldbb = newbb
 			newbb = gb
@@ -193,7 +252,7 @@ OuterLoop:
 				ch <- msg
 				break OuterLoop
 			}
-		case "Error":
+		case "error":
 			{
 				ch <- msg
 				break OuterLoop
@@ -208,7 +267,11 @@ OuterLoop:
 				if MD5(oldbb) != MD5(newbb) {
 					ch <- msg
 				}
-				time.Sleep(interval)
+				select {
+				case <-ctx.Done():
+					panic(ctx.Err())
+				case <-b.Session.Client.clock().After(interval):
+				}
 			}
 		}
 	}
@@ -217,17 +280,22 @@ OuterLoop:
 
 //Watch 轮询监听状态变化
 func (b *Statement) Watch(interval time.Duration, chanBuffer int) (chan StatementUpdateMsg, error) {
+	return b.WatchWithContext(context.Background(), interval, chanBuffer)
+}
+
+//WatchWithContext 与Watch相同,ctx取消后停止轮询,发送一条State为watch_err的消息并关闭channel
+func (b *Statement) WatchWithContext(ctx context.Context, interval time.Duration, chanBuffer int) (chan StatementUpdateMsg, error) {
 	switch {
 	case chanBuffer > 0:
 		{
 			ch := make(chan StatementUpdateMsg, chanBuffer)
-			go b.watch(interval, ch)
+			go b.watch(ctx, interval, ch)
 			return ch, nil
 		}
 	case chanBuffer == 0:
 		{
 			ch := make(chan StatementUpdateMsg)
-			go b.watch(interval, ch)
+			go b.watch(ctx, interval, ch)
 			return ch, nil
 		}
 	default:
@@ -236,3 +304,27 @@ func (b *Statement) Watch(interval time.Duration, chanBuffer int) (chan Statemen
 		}
 	}
 }
+
+//Wait 轮询等待statement执行结束,结束后可以通过State和Output获取结果
+func (b *Statement) Wait(ctx context.Context, interval time.Duration) (err error) {
+	ctx, span := b.Session.Client.tracer().Start(ctx, "livy.statement.wait", trace.WithAttributes(AttrSessionID.Int(b.Session.ID), AttrStatementID.Int(b.ID)))
+	defer func() {
+		span.SetAttributes(AttrState.String(b.State))
+		endSpan(span, err)
+	}()
+	for {
+		_, err = b.update(ctx)
+		if err != nil {
+			return err
+		}
+		switch b.State {
+		case "available", "error", "cancelled":
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.Session.Client.clock().After(interval):
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package golivyclient
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//newTestSession 在假服务上创建一个处于idle状态的session
+func newTestSession(t *testing.T, kind string) (*livytest.Server, *Session, *livytest.FakeClock) {
+	t.Helper()
+	s, c, clock := newTestClient(t)
+	s.SessionStates = []string{"idle"}
+	b := NewSession(c)
+	err := b.New(&NewSessionQuery{Kind: kind})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, b, clock
+}
+
+func TestStatementWait(t *testing.T) {
+	s, b, clock := newTestSession(t, KindSpark)
+	s.StatementStates = []string{"waiting", "waiting", "running", "available"}
+	st := b.NewStatement()
+	err := st.New(&NewStatementQuery{Code: "1 + 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Statements) != 1 || b.Statements[0] != st {
+		t.Errorf("NewStatement创建的statement应加入Statements")
+	}
+	ticks, err := runWithClock(clock, 500*time.Millisecond, func() error {
+		return st.Wait(context.Background(), 500*time.Millisecond)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "available" || ticks != 2 {
+		t.Errorf("State为%s,等待了%d次,应为available和2次", st.State, ticks)
+	}
+	if err := st.Err(); err != nil {
+		t.Errorf("Err为%v", err)
+	}
+}
+
+func TestStatementWatch(t *testing.T) {
+	s, b, clock := newTestSession(t, KindSpark)
+	s.StatementStates = []string{"waiting", "running", "running", "available"}
+	st := b.NewStatement()
+	err := st.New(&NewStatementQuery{Code: "spark.range(10).count()"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := st.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, ticks := drainWithClock(clock, time.Second, ch)
+	states := []string{}
+	for _, msg := range msgs {
+		states = append(states, msg.State)
+	}
+	if strings.Join(states, ",") != "running,available" {
+		t.Errorf("收到的状态为%v,应为[running available]", states)
+	}
+	if ticks != 2 {
+		t.Errorf("等待了%d次,应为2次", ticks)
+	}
+}
+
+func TestStatementCancelled(t *testing.T) {
+	s, b, clock := newTestSession(t, KindSQL)
+	s.StatementStates = []string{"running"}
+	st := b.NewStatement()
+	err := st.New(&NewStatementQuery{Code: "SELECT 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- st.Wait(context.Background(), time.Second)
+	}()
+	clock.BlockUntil(1)
+	err = st.Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "cancelled" || st.Err() == nil {
+		t.Errorf("State为%s,Err为%v", st.State, st.Err())
+	}
+}
+
+func TestStatementWatchStopsOnError(t *testing.T) {
+	s, b, clock := newTestSession(t, KindPySpark)
+	s.StatementStates = []string{"waiting", "running", "error"}
+	st := b.NewStatement()
+	err := st.New(&NewStatementQuery{Code: "1/0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := st.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := drainWithClock(clock, time.Second, ch)
+	states := []string{}
+	for _, msg := range msgs {
+		states = append(states, msg.State)
+	}
+	if strings.Join(states, ",") != "running,error" {
+		t.Errorf("收到的状态为%v,应为[running error]", states)
+	}
+}
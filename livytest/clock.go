@@ -0,0 +1,86 @@
+//Package livytest golivyclient的测试辅助工具
+package livytest
+
+import (
+	"sync"
+	"time"
+)
+
+type sleeper struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+//FakeClock 手动推进的时钟,实现了golivyclient.Clock接口,用于确定性地测试轮询逻辑
+type FakeClock struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	now      time.Time
+	sleepers []*sleeper
+}
+
+//NewFakeClock 创建一个从now开始的假时钟
+func NewFakeClock(now time.Time) *FakeClock {
+	c := new(FakeClock)
+	c.now = now
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+//Now 当前时间
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+//After 在时钟被推进d之后向返回的channel中发送当时的时间
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.sleepers = append(c.sleepers, &sleeper{until: c.now.Add(d), ch: ch})
+	c.cond.Broadcast()
+	return ch
+}
+
+//Sleep 阻塞直到时钟被推进d
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+//Advance 推进时钟,唤醒所有到期的等待者
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	remain := c.sleepers[:0]
+	for _, s := range c.sleepers {
+		if s.until.After(c.now) {
+			remain = append(remain, s)
+		} else {
+			s.ch <- c.now
+		}
+	}
+	c.sleepers = remain
+}
+
+//Sleepers 当前正在等待的数量
+func (c *FakeClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+//BlockUntil 阻塞直到至少有n个等待者,用于在Advance前确认被测的goroutine已经进入等待
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.sleepers) < n {
+		c.cond.Wait()
+	}
+}
@@ -0,0 +1,281 @@
+package livytest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//Mode 录制器的工作模式
+type Mode int
+
+const (
+	//ModeRecord 将请求转发给真实的livy服务并记录交互
+	ModeRecord Mode = iota
+	//ModeReplay 只从cassette文件中回放交互,没有匹配的交互时返回错误
+	ModeReplay
+)
+
+//Redacted 被脱敏的值
+const Redacted = "[REDACTED]"
+
+//Boundary 录制的multipart请求体中代替随机boundary的字符串
+const Boundary = "livytest-boundary"
+
+//DefaultSensitiveConf 默认的敏感Conf键匹配规则
+var DefaultSensitiveConf = regexp.MustCompile(`(?i)(password|passwd|secret|token|credential|access\.?key)`)
+
+//SensitiveHeaders 录制时会被脱敏的请求头和响应头,不区分大小写
+var SensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+//RecordedHTTPRequest cassette中记录的请求
+type RecordedHTTPRequest struct {
+	Method string              `json:"method"`
+	Path   string              `json:"path"`
+	Query  string              `json:"query,omitempty"`
+	Header map[string][]string `json:"header,omitempty"`
+	Body   string              `json:"body,omitempty"`
+}
+
+//RecordedHTTPResponse cassette中记录的响应
+type RecordedHTTPResponse struct {
+	StatusCode int                 `json:"statusCode"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       string              `json:"body,omitempty"`
+}
+
+//Interaction 一次请求和响应
+type Interaction struct {
+	Request  RecordedHTTPRequest  `json:"request"`
+	Response RecordedHTTPResponse `json:"response"`
+}
+
+//Cassette 录制的交互集合
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+//Recorder 可以录制和回放livy交互的http.RoundTripper
+//
+//请求按方法,路径,查询参数和请求体匹配,回放时相同的请求按录制的顺序依次返回,用完后重复返回最后一次的响应;
+//查询参数按名称排序后比较,multipart请求体中的boundary替换为Boundary后比较,不是utf-8的请求体按sha256比较
+type Recorder struct {
+	//Path cassette文件的路径
+	Path string
+	//Mode 工作模式
+	Mode Mode
+	//Transport 录制模式下实际发送请求使用的RoundTripper,为nil时使用http.DefaultTransport
+	Transport http.RoundTripper
+	//SensitiveConf 请求体中conf内需要脱敏的键,为nil时使用DefaultSensitiveConf
+	SensitiveConf *regexp.Regexp
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     map[*Interaction]bool
+}
+
+//NewRecorder 创建录制器,回放模式下会读取path指定的cassette文件
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := new(Recorder)
+	r.Path = path
+	r.Mode = mode
+	r.cassette = &Cassette{Interactions: []*Interaction{}}
+	r.used = map[*Interaction]bool{}
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, r.cassette)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+//Client 使用录制器作为Transport的http客户端,可直接赋值给LivyClient.HTTPClient
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+//Save 将录制的交互写入cassette文件
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path, data, 0644)
+}
+
+func (r *Recorder) sensitiveConf() *regexp.Regexp {
+	if r.SensitiveConf == nil {
+		return DefaultSensitiveConf
+	}
+	return r.SensitiveConf
+}
+
+//normalizeQuery 按名称排序查询参数,无法解析时保持原样
+func normalizeQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+//scrubBody 脱敏请求体中conf的敏感值,并规范化json和multipart请求体以便匹配
+func (r *Recorder) scrubBody(header http.Header, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		text := strings.ReplaceAll(string(body), params["boundary"], Boundary)
+		if !utf8.ValidString(text) {
+			sum := sha256.Sum256([]byte(text))
+			return "sha256:" + hex.EncodeToString(sum[:])
+		}
+		return text
+	}
+	q := map[string]interface{}{}
+	err = json.Unmarshal(body, &q)
+	if err != nil {
+		return string(body)
+	}
+	if conf, ok := q["conf"].(map[string]interface{}); ok {
+		for key := range conf {
+			if r.sensitiveConf().MatchString(key) {
+				conf[key] = Redacted
+			}
+		}
+	}
+	res, err := json.Marshal(q)
+	if err != nil {
+		return string(body)
+	}
+	return string(res)
+}
+
+func scrubHeader(header http.Header) map[string][]string {
+	res := map[string][]string{}
+	for key, values := range header {
+		res[key] = append([]string{}, values...)
+	}
+	for _, key := range SensitiveHeaders {
+		key = http.CanonicalHeaderKey(key)
+		if _, ok := res[key]; ok {
+			res[key] = []string{Redacted}
+		}
+	}
+	return res
+}
+
+//RoundTrip 实现http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	recorded := RecordedHTTPRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  normalizeQuery(req.URL.RawQuery),
+		Header: scrubHeader(req.Header),
+		Body:   r.scrubBody(req.Header, body),
+	}
+	switch r.Mode {
+	case ModeRecord:
+		return r.record(req, body, recorded)
+	case ModeReplay:
+		return r.replay(req, recorded)
+	default:
+		return nil, fmt.Errorf("未知的录制模式:%d", r.Mode)
+	}
+}
+
+func (r *Recorder) record(req *http.Request, body []byte, recorded RecordedHTTPRequest) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	out := req.Clone(req.Context())
+	out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	resBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	it := &Interaction{
+		Request: recorded,
+		Response: RecordedHTTPResponse{
+			StatusCode: resp.StatusCode,
+			Header:     scrubHeader(resp.Header),
+			Body:       string(resBody),
+		},
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, it)
+	r.mu.Unlock()
+	return it.response(req), nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded RecordedHTTPRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *Interaction
+	for _, it := range r.cassette.Interactions {
+		if it.Request.Method != recorded.Method || it.Request.Path != recorded.Path ||
+			normalizeQuery(it.Request.Query) != recorded.Query || it.Request.Body != recorded.Body {
+			continue
+		}
+		last = it
+		if !r.used[it] {
+			r.used[it] = true
+			return it.response(req), nil
+		}
+	}
+	if last != nil {
+		return last.response(req), nil
+	}
+	return nil, fmt.Errorf("cassette中没有匹配的交互,method:%s;path:%s;query:%s;body:%s", recorded.Method, recorded.Path, recorded.Query, recorded.Body)
+}
+
+func (it *Interaction) response(req *http.Request) *http.Response {
+	header := http.Header{}
+	for key, values := range it.Response.Header {
+		header[key] = append([]string{}, values...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", it.Response.StatusCode, http.StatusText(it.Response.StatusCode)),
+		StatusCode:    it.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(it.Response.Body)),
+		ContentLength: int64(len(it.Response.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,119 @@
+package livytest_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lc "golivyclient"
+	"golivyclient/livytest"
+)
+
+//session 录制和回放时执行的相同操作,返回每一步的结果
+func session(t *testing.T, c *lc.LivyClient, listFirst bool) []string {
+	t.Helper()
+	ctx := context.Background()
+	res := []string{}
+	list := func(from, size int) {
+		bs, err := c.ListBatches(ctx, from, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, string(bs))
+	}
+	if listFirst {
+		//回放时的顺序与录制时不同,查询参数不同的请求不能互相替代
+		list(0, 1)
+		list(0, 10)
+	} else {
+		list(0, 10)
+	}
+	b := lc.NewBatch(c)
+	err := b.New(&lc.NewBatchQuery{File: "hdfs:///app.jar", Conf: map[string]interface{}{"spark.hadoop.fs.s3a.secret.key": "s3cr3t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !listFirst {
+		list(0, 1)
+	}
+	s := lc.NewSession(c)
+	err = s.New(&lc.NewSessionQuery{Kind: lc.KindPySpark})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Wait(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//二进制的jar,multipart的boundary每次不同
+	err = s.UploadJar(bytes.NewReader([]byte{0, 1, 2, 0xff, 0xfe}), "udf.jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := s.Run(ctx, &lc.NewStatementQuery{Code: "1 + 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = append(res, st.State, string(*st.Output.Data))
+	return res
+}
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	server := livytest.NewServer()
+	server.SessionStates = []string{"idle"}
+	server.StatementStates = []string{"available"}
+	server.StatementResult = func(code string) (map[string]interface{}, error) {
+		return map[string]interface{}{lc.TextMimeType: "2"}, nil
+	}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	rec, err := livytest.NewRecorder(path, livytest.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := lc.NewClient(server.URL)
+	c.HTTPClient = rec.Client()
+	c.Use(lc.BasicAuth("etl", "hunter2"))
+	recorded := session(t, c, false)
+	err = rec.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s3cr3t", "ZXRsOmh1bnRlcjI="} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette中包含未脱敏的%s", secret)
+		}
+	}
+
+	rep, err := livytest.NewRecorder(path, livytest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = lc.NewClient(server.URL)
+	c.HTTPClient = rep.Client()
+	c.Use(lc.BasicAuth("etl", "hunter2"))
+	replayed := session(t, c, true)
+	//listFirst时前两个结果的顺序相反
+	recorded[0], recorded[1] = recorded[1], recorded[0]
+	if strings.Join(replayed, "\n") != strings.Join(recorded, "\n") {
+		t.Errorf("回放的结果为\n%s\n录制的结果为\n%s", strings.Join(replayed, "\n"), strings.Join(recorded, "\n"))
+	}
+	if !strings.Contains(recorded[0], `"total":1`) || !strings.Contains(recorded[1], `"total":0`) {
+		t.Errorf("列表的结果为%s和%s", recorded[0], recorded[1])
+	}
+
+	_, err = c.ListBatches(context.Background(), 5, 5)
+	if err == nil || !strings.Contains(err.Error(), "没有匹配的交互") {
+		t.Errorf("cassette中没有的请求应返回错误,err为%v", err)
+	}
+}
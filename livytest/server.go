@@ -0,0 +1,770 @@
+package livytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//DefaultBatchStates batch默认经历的状态
+var DefaultBatchStates = []string{"starting", "running", "success"}
+
+//DefaultSessionStates session默认经历的状态
+var DefaultSessionStates = []string{"starting", "idle"}
+
+//DefaultStatementStates statement默认经历的状态
+var DefaultStatementStates = []string{"waiting", "running", "available"}
+
+//DefaultJobStates job默认经历的状态
+var DefaultJobStates = []string{"SENT", "QUEUED", "STARTED", "SUCCEEDED"}
+
+//Failure 注入的失败
+type Failure struct {
+	//Method 匹配的请求方法,为空时匹配任意方法
+	Method string
+	//Path 匹配的请求路径,如"/batches/0"
+	Path string
+	//Status 返回的状态码,为0时直接断开连接
+	Status int
+	//Body 返回的消息体
+	Body string
+	//Times 生效的次数,小于等于0时一直生效
+	Times int
+}
+
+//RecordedRequest 服务端收到的请求
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Body   []byte
+}
+
+type script struct {
+	states []string
+	step   int
+}
+
+func newScript(states []string) *script {
+	s := new(script)
+	s.states = append([]string{}, states...)
+	return s
+}
+
+func (s *script) state() string {
+	if len(s.states) == 0 {
+		return ""
+	}
+	return s.states[s.step]
+}
+
+func (s *script) advance() {
+	if s.step < len(s.states)-1 {
+		s.step++
+	}
+}
+
+func (s *script) set(state string) {
+	s.states = []string{state}
+	s.step = 0
+}
+
+type fakeBatch struct {
+	id     int
+	query  map[string]interface{}
+	script *script
+	log    []string
+}
+
+type fakeStatement struct {
+	id     int
+	code   string
+	kind   string
+	script *script
+}
+
+type fakeSession struct {
+	id         int
+	kind       string
+	query      map[string]interface{}
+	script     *script
+	log        []string
+	statements []*fakeStatement
+	jobs       []*fakeJob
+	resources  []Resource
+	heartbeats int
+}
+
+type fakeJob struct {
+	id     int
+	job    []byte
+	script *script
+}
+
+//Resource 通过upload或add接口添加到session的资源
+type Resource struct {
+	//Kind 资源类型,为"jar","pyfile"或"file"
+	Kind string
+	//Name 上传的文件名,通过add接口添加时为空
+	Name string
+	//URI 通过add接口添加的uri,上传时为空
+	URI string
+	//Data 上传的文件内容
+	Data []byte
+}
+
+//Server 基于httptest的livy假服务,实现了batches,sessions和statements接口
+//
+//每次查询batch,session或statement时对象的状态都会按脚本前进一步,停留在最后一个状态
+type Server struct {
+	*httptest.Server
+	//BatchStates 新建batch的状态脚本
+	BatchStates []string
+	//SessionStates 新建session的状态脚本
+	SessionStates []string
+	//StatementStates 新建statement的状态脚本
+	StatementStates []string
+	//StatementResult 根据提交的代码生成statement的输出data,返回error时输出为错误,为nil时输出空文本;调用时不持有服务的锁,可以调用Server的方法
+	StatementResult func(code string) (map[string]interface{}, error)
+	//JobStates 新建job的状态脚本
+	JobStates []string
+	//JobResult 根据提交的序列化任务生成任务的结果,返回error时任务失败,为nil时结果为空;调用时不持有服务的锁
+	JobResult func(job []byte) ([]byte, error)
+
+	mu            sync.Mutex
+	batches       map[int]*fakeBatch
+	sessions      map[int]*fakeSession
+	nextBatchID   int
+	nextSessionID int
+	failures      []*Failure
+	requests      []RecordedRequest
+}
+
+//NewServer 创建并启动一个livy假服务,使用完后需要调用Close
+func NewServer() *Server {
+	s := new(Server)
+	s.BatchStates = DefaultBatchStates
+	s.SessionStates = DefaultSessionStates
+	s.StatementStates = DefaultStatementStates
+	s.JobStates = DefaultJobStates
+	s.batches = map[int]*fakeBatch{}
+	s.sessions = map[int]*fakeSession{}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+//InjectFailure 注入一个失败,匹配的请求会直接返回失败
+func (s *Server) InjectFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+//ClearFailures 清除所有注入的失败
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = nil
+}
+
+//Requests 服务端收到的所有请求
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RecordedRequest{}, s.requests...)
+}
+
+//ScriptBatch 为已存在的batch设置新的状态脚本
+func (s *Server) ScriptBatch(id int, states ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.batches[id]
+	if !ok {
+		return fmt.Errorf("batch %d不存在", id)
+	}
+	b.script = newScript(states)
+	return nil
+}
+
+//ScriptSession 为已存在的session设置新的状态脚本
+func (s *Server) ScriptSession(id int, states ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return fmt.Errorf("session %d不存在", id)
+	}
+	ss.script = newScript(states)
+	return nil
+}
+
+//ScriptStatement 为已存在的statement设置新的状态脚本
+func (s *Server) ScriptStatement(sessionID, id int, states ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.statement(sessionID, id)
+	if st == nil {
+		return fmt.Errorf("statement %d/%d不存在", sessionID, id)
+	}
+	st.script = newScript(states)
+	return nil
+}
+
+//ScriptJob 为已存在的job设置新的状态脚本
+func (s *Server) ScriptJob(sessionID, id int, states ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[sessionID]
+	if !ok || id < 0 || id >= len(ss.jobs) {
+		return fmt.Errorf("job %d/%d不存在", sessionID, id)
+	}
+	ss.jobs[id].script = newScript(states)
+	return nil
+}
+
+//AppendBatchLog 为batch追加日志
+func (s *Server) AppendBatchLog(id int, lines ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.batches[id]
+	if !ok {
+		return fmt.Errorf("batch %d不存在", id)
+	}
+	b.log = append(b.log, lines...)
+	return nil
+}
+
+//AppendSessionLog 为session追加日志
+func (s *Server) AppendSessionLog(id int, lines ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return fmt.Errorf("session %d不存在", id)
+	}
+	ss.log = append(ss.log, lines...)
+	return nil
+}
+
+//Heartbeats session收到的心跳次数
+func (s *Server) Heartbeats(id int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return 0
+	}
+	return ss.heartbeats
+}
+
+//SessionResources session中通过upload或add接口添加的资源
+func (s *Server) SessionResources(id int) []Resource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	return append([]Resource{}, ss.resources...)
+}
+
+func (s *Server) statement(sessionID, id int) *fakeStatement {
+	ss, ok := s.sessions[sessionID]
+	if !ok || id < 0 || id >= len(ss.statements) {
+		return nil
+	}
+	return ss.statements[id]
+}
+
+func (s *Server) failure(r *http.Request) *Failure {
+	for i, f := range s.failures {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if f.Path != r.URL.Path {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+//unlocked 释放s.mu后调用f,用于执行StatementResult和JobResult等回调,回调中可以调用Server的方法
+func (s *Server) unlocked(f func()) {
+	s.mu.Unlock()
+	defer s.mu.Lock()
+	f()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter, msg string) {
+	writeJSON(w, http.StatusNotFound, map[string]interface{}{"msg": msg})
+}
+
+//ServeHTTP 处理livy接口请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, RecordedRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+	if f := s.failure(r); f != nil {
+		status := f.Status
+		if status == 0 {
+			if hj, ok := w.(http.Hijacker); ok {
+				conn, _, err := hj.Hijack()
+				if err == nil {
+					conn.Close()
+					return
+				}
+			}
+			//无法断开连接时只对这次请求返回503,不修改注入的失败
+			status = http.StatusServiceUnavailable
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(f.Body))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "batches":
+		s.serveBatches(w, r, parts[1:], body)
+	case "sessions":
+		s.serveSessions(w, r, parts[1:], body)
+	default:
+		notFound(w, fmt.Sprintf("unknown path %s", r.URL.Path))
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"msg": "method not allowed"})
+}
+
+func parseQuery(w http.ResponseWriter, body []byte) (map[string]interface{}, bool) {
+	q := map[string]interface{}{}
+	if len(body) == 0 {
+		return q, true
+	}
+	err := json.Unmarshal(body, &q)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"msg": err.Error()})
+		return nil, false
+	}
+	return q, true
+}
+
+func appID(kind string, id int) string {
+	return fmt.Sprintf("application_0000000000000_%s%04d", kind, id)
+}
+
+func (b *fakeBatch) toJSON() map[string]interface{} {
+	res := map[string]interface{}{
+		"id":    b.id,
+		"appId": appID("b", b.id),
+		"appInfo": map[string]interface{}{
+			"driverLogUrl": nil,
+			"sparkUiUrl":   nil,
+		},
+		"log":   append([]string{}, b.log...),
+		"state": b.script.state(),
+	}
+	if name, ok := b.query["name"]; ok {
+		res["name"] = name
+	}
+	if user, ok := b.query["proxyUser"]; ok {
+		res["proxyUser"] = user
+	}
+	return res
+}
+
+func (s *Server) serveBatches(w http.ResponseWriter, r *http.Request, parts []string, body []byte) {
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			ids := []int{}
+			for id := range s.batches {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			list := []interface{}{}
+			for _, id := range ids {
+				list = append(list, s.batches[id].toJSON())
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"from": 0, "total": len(list), "sessions": list})
+		case "POST":
+			q, ok := parseQuery(w, body)
+			if !ok {
+				return
+			}
+			if _, ok := q["file"]; !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]interface{}{"msg": "file is required"})
+				return
+			}
+			b := &fakeBatch{id: s.nextBatchID, query: q, script: newScript(s.BatchStates)}
+			s.nextBatchID++
+			s.batches[b.id] = b
+			writeJSON(w, http.StatusCreated, b.toJSON())
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	b, ok := s.batches[id]
+	if err != nil || !ok {
+		notFound(w, fmt.Sprintf("Batch %s not found", parts[0]))
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case "GET":
+			b.script.advance()
+			writeJSON(w, http.StatusOK, b.toJSON())
+		case "DELETE":
+			delete(s.batches, id)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"msg": "deleted"})
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	if r.Method != "GET" || len(parts) != 2 {
+		notFound(w, fmt.Sprintf("unknown path %s", r.URL.Path))
+		return
+	}
+	switch parts[1] {
+	case "state":
+		b.script.advance()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": b.id, "state": b.script.state()})
+	case "log":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": b.id, "from": 0, "total": len(b.log), "log": b.log})
+	default:
+		notFound(w, fmt.Sprintf("unknown path %s", r.URL.Path))
+	}
+}
+
+func (ss *fakeSession) toJSON() map[string]interface{} {
+	res := map[string]interface{}{
+		"id":    ss.id,
+		"appId": appID("s", ss.id),
+		"kind":  ss.kind,
+		"appInfo": map[string]interface{}{
+			"driverLogUrl": nil,
+			"sparkUiUrl":   nil,
+		},
+		"log":   append([]string{}, ss.log...),
+		"state": ss.script.state(),
+	}
+	if name, ok := ss.query["name"]; ok {
+		res["name"] = name
+	}
+	if user, ok := ss.query["proxyUser"]; ok {
+		res["proxyUser"] = user
+	}
+	return res
+}
+
+func (s *Server) serveSessions(w http.ResponseWriter, r *http.Request, parts []string, body []byte) {
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			ids := []int{}
+			for id := range s.sessions {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			list := []interface{}{}
+			for _, id := range ids {
+				list = append(list, s.sessions[id].toJSON())
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"from": 0, "total": len(list), "sessions": list})
+		case "POST":
+			q, ok := parseQuery(w, body)
+			if !ok {
+				return
+			}
+			kind, _ := q["kind"].(string)
+			ss := &fakeSession{id: s.nextSessionID, kind: kind, query: q, script: newScript(s.SessionStates)}
+			s.nextSessionID++
+			s.sessions[ss.id] = ss
+			writeJSON(w, http.StatusCreated, ss.toJSON())
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	ss, ok := s.sessions[id]
+	if err != nil || !ok {
+		notFound(w, fmt.Sprintf("Session '%s' not found.", parts[0]))
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case "GET":
+			ss.script.advance()
+			writeJSON(w, http.StatusOK, ss.toJSON())
+		case "DELETE":
+			delete(s.sessions, id)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"msg": "deleted"})
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	switch parts[1] {
+	case "state":
+		if r.Method != "GET" || len(parts) != 2 {
+			methodNotAllowed(w)
+			return
+		}
+		ss.script.advance()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": ss.id, "state": ss.script.state()})
+	case "log":
+		if r.Method != "GET" || len(parts) != 2 {
+			methodNotAllowed(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": ss.id, "from": 0, "total": len(ss.log), "log": ss.log})
+	case "connect":
+		if r.Method != "POST" || len(parts) != 2 {
+			methodNotAllowed(w)
+			return
+		}
+		ss.heartbeats++
+		writeJSON(w, http.StatusOK, ss.toJSON())
+	case "statements":
+		s.serveStatements(w, r, ss, parts[2:], body)
+	case "submit-job", "run-job":
+		if r.Method != "POST" || len(parts) != 2 {
+			methodNotAllowed(w)
+			return
+		}
+		q := struct {
+			Job []byte `json:"job"`
+		}{}
+		err := json.Unmarshal(body, &q)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"msg": err.Error()})
+			return
+		}
+		j := &fakeJob{id: len(ss.jobs), job: q.Job, script: newScript(s.JobStates)}
+		ss.jobs = append(ss.jobs, j)
+		writeJSON(w, http.StatusCreated, s.jobJSON(j))
+	case "jobs":
+		s.serveJobs(w, r, ss, parts[2:])
+	case "upload-jar", "upload-pyfile", "upload-file":
+		if r.Method != "POST" || len(parts) != 2 {
+			methodNotAllowed(w)
+			return
+		}
+		res, err := parseUpload(r, body, strings.TrimPrefix(parts[1], "upload-"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"msg": err.Error()})
+			return
+		}
+		ss.resources = append(ss.resources, res)
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+	case "add-jar", "add-pyfile", "add-file":
+		if r.Method != "POST" || len(parts) != 2 {
+			methodNotAllowed(w)
+			return
+		}
+		q, ok := parseQuery(w, body)
+		if !ok {
+			return
+		}
+		uri, _ := q["uri"].(string)
+		if uri == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"msg": "uri is required"})
+			return
+		}
+		ss.resources = append(ss.resources, Resource{Kind: strings.TrimPrefix(parts[1], "add-"), URI: uri})
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+	default:
+		notFound(w, fmt.Sprintf("unknown path %s", r.URL.Path))
+	}
+}
+
+func parseUpload(r *http.Request, body []byte, kind string) (Resource, error) {
+	res := Resource{Kind: kind}
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return res, err
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	field := "file"
+	if kind == "jar" {
+		field = "jar"
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return res, fmt.Errorf("missing form field %s", field)
+		}
+		if part.FormName() != field {
+			continue
+		}
+		res.Name = part.FileName()
+		res.Data, err = ioutil.ReadAll(part)
+		return res, err
+	}
+}
+
+func (s *Server) statementJSON(st *fakeStatement) map[string]interface{} {
+	res := map[string]interface{}{
+		"id":        st.id,
+		"code":      st.code,
+		"state":     st.script.state(),
+		"output":    nil,
+		"progress":  0.0,
+		"started":   0,
+		"completed": 0,
+	}
+	switch st.script.state() {
+	case "running":
+		res["progress"] = 0.5
+	case "available":
+		res["progress"] = 1.0
+		var data map[string]interface{}
+		var err error
+		if fn := s.StatementResult; fn != nil {
+			code := st.code
+			s.unlocked(func() {
+				data, err = fn(code)
+			})
+		} else {
+			data = map[string]interface{}{"text/plain": ""}
+		}
+		if err != nil {
+			res["output"] = map[string]interface{}{
+				"status":          "error",
+				"execution_count": st.id,
+				"ename":           "Error",
+				"evalue":          err.Error(),
+				"traceback":       []string{},
+			}
+		} else {
+			res["output"] = map[string]interface{}{
+				"status":          "ok",
+				"execution_count": st.id,
+				"data":            data,
+			}
+		}
+	}
+	return res
+}
+
+func (s *Server) serveStatements(w http.ResponseWriter, r *http.Request, ss *fakeSession, parts []string, body []byte) {
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			list := []interface{}{}
+			for _, st := range ss.statements {
+				list = append(list, s.statementJSON(st))
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"total_statements": len(list), "statements": list})
+		case "POST":
+			q, ok := parseQuery(w, body)
+			if !ok {
+				return
+			}
+			code, _ := q["code"].(string)
+			kind, _ := q["kind"].(string)
+			st := &fakeStatement{id: len(ss.statements), code: code, kind: kind, script: newScript(s.StatementStates)}
+			ss.statements = append(ss.statements, st)
+			writeJSON(w, http.StatusCreated, s.statementJSON(st))
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	st := s.statement(ss.id, id)
+	if err != nil || st == nil {
+		notFound(w, fmt.Sprintf("Statement %s not found", parts[0]))
+		return
+	}
+	if len(parts) == 1 {
+		if r.Method != "GET" {
+			methodNotAllowed(w)
+			return
+		}
+		st.script.advance()
+		writeJSON(w, http.StatusOK, s.statementJSON(st))
+		return
+	}
+	if len(parts) == 2 && parts[1] == "cancel" && r.Method == "POST" {
+		st.script.set("cancelled")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"msg": "canceled"})
+		return
+	}
+	notFound(w, fmt.Sprintf("unknown path %s", r.URL.Path))
+}
+
+func (s *Server) jobJSON(j *fakeJob) map[string]interface{} {
+	res := map[string]interface{}{
+		"id":           j.id,
+		"state":        j.script.state(),
+		"result":       nil,
+		"error":        nil,
+		"newSparkJobs": []int{},
+	}
+	if fn := s.JobResult; j.script.state() == "SUCCEEDED" && fn != nil {
+		var result []byte
+		var err error
+		job := j.job
+		s.unlocked(func() {
+			result, err = fn(job)
+		})
+		if err != nil {
+			res["state"] = "FAILED"
+			res["error"] = err.Error()
+		} else {
+			res["result"] = result
+		}
+	}
+	return res
+}
+
+func (s *Server) serveJobs(w http.ResponseWriter, r *http.Request, ss *fakeSession, parts []string) {
+	if len(parts) == 0 {
+		notFound(w, fmt.Sprintf("unknown path %s", r.URL.Path))
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id < 0 || id >= len(ss.jobs) {
+		notFound(w, fmt.Sprintf("Job %s not found", parts[0]))
+		return
+	}
+	j := ss.jobs[id]
+	if len(parts) == 1 && r.Method == "GET" {
+		j.script.advance()
+		writeJSON(w, http.StatusOK, s.jobJSON(j))
+		return
+	}
+	if len(parts) == 2 && parts[1] == "cancel" && r.Method == "POST" {
+		j.script.set("CANCELLED")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"msg": "canceled"})
+		return
+	}
+	notFound(w, fmt.Sprintf("unknown path %s", r.URL.Path))
+}
@@ -0,0 +1,51 @@
+package golivyclient
+
+import "log/slog"
+
+//Logger 结构化日志接口,keyvals为交替出现的键和值
+//
+//*slog.Logger可以直接使用,zap可以用SugaredLogger的Debugw等方法适配
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (nopLogger) Info(msg string, keyvals ...interface{})  {}
+func (nopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+
+//NopLogger 丢弃所有日志,为客户端的默认日志
+var NopLogger Logger = nopLogger{}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+//NewSlogLogger 使用log/slog输出日志,l为nil时使用slog.Default()
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.l.Debug(msg, keyvals...)
+}
+
+func (s *slogLogger) Info(msg string, keyvals ...interface{}) {
+	s.l.Info(msg, keyvals...)
+}
+
+func (s *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.l.Warn(msg, keyvals...)
+}
+
+func (s *slogLogger) Error(msg string, keyvals ...interface{}) {
+	s.l.Error(msg, keyvals...)
+}
@@ -0,0 +1,175 @@
+package golivyclient
+
+import (
+	"bytes"
+	"context"
+	jsonl "encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//logEntry 一条记录下来的日志
+type logEntry struct {
+	level   string
+	msg     string
+	keyvals map[string]interface{}
+}
+
+//recordLogger 记录所有日志的Logger,可以并发使用
+type recordLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordLogger) log(level string, msg string, keyvals []interface{}) {
+	e := logEntry{level: level, msg: msg, keyvals: map[string]interface{}{}}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		e.keyvals[keyvals[i].(string)] = keyvals[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+}
+
+func (l *recordLogger) Debug(msg string, keyvals ...interface{}) { l.log("DEBUG", msg, keyvals) }
+func (l *recordLogger) Info(msg string, keyvals ...interface{})  { l.log("INFO", msg, keyvals) }
+func (l *recordLogger) Warn(msg string, keyvals ...interface{})  { l.log("WARN", msg, keyvals) }
+func (l *recordLogger) Error(msg string, keyvals ...interface{}) { l.log("ERROR", msg, keyvals) }
+
+//find 返回所有消息为msg的日志
+func (l *recordLogger) find(msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := []logEntry{}
+	for _, e := range l.entries {
+		if e.msg == msg {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+//decodeLogs 解析slog的json输出,每行一条
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	res := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		m := map[string]interface{}{}
+		if err := jsonl.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("%s:%v", line, err)
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+func TestSlogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewSlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	l.Debug("d", "session_id", 1)
+	l.Info("i", "state", "idle")
+	l.Warn("w", "attempt", 2, "url", "http://livy/sessions/1")
+	l.Error("e")
+	logs := decodeLogs(t, buf)
+	want := []struct {
+		level string
+		msg   string
+	}{{"DEBUG", "d"}, {"INFO", "i"}, {"WARN", "w"}, {"ERROR", "e"}}
+	if len(logs) != len(want) {
+		t.Fatalf("输出了%d条日志:%s", len(logs), buf)
+	}
+	for i, w := range want {
+		if logs[i]["level"] != w.level || logs[i]["msg"] != w.msg {
+			t.Errorf("第%d条日志为%v,应为%s %s", i, logs[i], w.level, w.msg)
+		}
+	}
+	if logs[0]["session_id"] != 1.0 || logs[1]["state"] != "idle" || logs[2]["attempt"] != 2.0 || logs[2]["url"] != "http://livy/sessions/1" {
+		t.Errorf("日志中的键值为%v", logs)
+	}
+
+	//l为nil时使用slog.Default()
+	old := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(old)
+	})
+	buf.Reset()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, nil)))
+	l = NewSlogLogger(nil)
+	l.Debug("hidden")
+	l.Info("shown", "k", "v")
+	if logs := decodeLogs(t, buf); len(logs) != 1 || logs[0]["msg"] != "shown" || logs[0]["k"] != "v" {
+		t.Errorf("默认logger输出了%s", buf)
+	}
+}
+
+func TestNopLogger(t *testing.T) {
+	NopLogger.Debug("d", "k")
+	NopLogger.Info("i")
+	NopLogger.Warn("w", "k", 1)
+	NopLogger.Error("e", nil, nil)
+	if c := NewClient("http://localhost:8998"); c.logger() != NopLogger {
+		t.Errorf("客户端默认的logger为%v,应为NopLogger", c.logger())
+	}
+}
+
+func TestClientLogs(t *testing.T) {
+	s, c, _ := newTestClient(t)
+	l := &recordLogger{}
+	c.Logger = l
+	ctx := context.Background()
+	if _, err := c.query(ctx, http.MethodGet, "sessions"); err != nil {
+		t.Fatal(err)
+	}
+	s.InjectFailure(livytest.Failure{Path: "/batches"})
+	if _, err := c.query(ctx, http.MethodGet, "batches"); err == nil {
+		t.Fatal("连接断开时应返回错误")
+	}
+	s.ClearFailures()
+	//状态码错误不是请求错误,记录为Debug
+	if _, err := c.query(ctx, http.MethodGet, "batches/9"); err == nil {
+		t.Fatal("batch不存在时应返回错误")
+	}
+	debug := l.find("livy request")
+	if len(debug) != 2 || debug[0].level != "DEBUG" || debug[0].keyvals["url"] != s.URL+"/sessions" || debug[0].keyvals["status"] != 200 {
+		t.Errorf("请求日志为%+v", debug)
+	}
+	if len(debug) == 2 && debug[1].keyvals["status"] != 404 {
+		t.Errorf("第2条请求日志为%+v,状态码应为404", debug[1])
+	}
+	warn := l.find("livy request error")
+	if len(warn) != 1 || warn[0].level != "WARN" || warn[0].keyvals["method"] != http.MethodGet || warn[0].keyvals["err"] == nil {
+		t.Errorf("请求错误的日志为%+v", warn)
+	}
+}
+
+func TestWatchLogs(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	l := &recordLogger{}
+	c.Logger = l
+	s.BatchStates = []string{"running", "running", "success"}
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := b.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainWithClock(clock, time.Second, ch)
+	polls := l.find("batch watch poll")
+	if len(polls) != 2 {
+		t.Fatalf("轮询的日志为%+v,应有2条", polls)
+	}
+	for i, e := range polls {
+		if e.level != "DEBUG" || e.keyvals["batch_id"] != 0 || e.keyvals["attempt"] != i+1 {
+			t.Errorf("第%d条轮询日志为%+v", i, e)
+		}
+	}
+}
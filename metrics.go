@@ -0,0 +1,55 @@
+package golivyclient
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//Metrics 客户端的指标收集接口,livyprom包提供了prometheus的实现
+type Metrics interface {
+	//ObserveRequest 记录一次请求,endpoint为把id替换为"{id}"的路径,如"batches/{id}",请求未得到响应时status为0
+	ObserveRequest(method string, endpoint string, status int, duration time.Duration)
+	//WatcherStarted 一个watcher开始轮询,kind为"batch","session"或"statement"
+	WatcherStarted(kind string)
+	//WatcherStopped 一个watcher停止轮询
+	WatcherStopped(kind string)
+	//StateChanged batch或session的状态发生变化,from为空表示新建,to为空表示已删除
+	//
+	//同一个ID可能有多个Batch或Session对象,每个对象都会报告自己看到的变化,实现需要按kind和id去重
+	StateChanged(kind string, id int, from string, to string)
+	//ObserveStatement 记录一个执行结束的statement的执行时长
+	ObserveStatement(state string, duration time.Duration)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveRequest(method string, endpoint string, status int, duration time.Duration) {
+}
+
+func (nopMetrics) WatcherStarted(kind string) {}
+
+func (nopMetrics) WatcherStopped(kind string) {}
+
+func (nopMetrics) StateChanged(kind string, id int, from string, to string) {}
+
+func (nopMetrics) ObserveStatement(state string, duration time.Duration) {}
+
+//NopMetrics 不收集任何指标,为客户端的默认指标收集器
+var NopMetrics Metrics = nopMetrics{}
+
+var idSegment = regexp.MustCompile(`/\d+(/|$)`)
+
+//endpointOf 将请求url转换为不含id和查询参数的路径
+func endpointOf(baseURL string, URL string) string {
+	path := strings.TrimPrefix(URL, baseURL)
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+	path = "/" + strings.Trim(path, "/")
+	for idSegment.MatchString(path) {
+		path = idSegment.ReplaceAllString(path, "/{id}$1")
+	}
+	return strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,170 @@
+package golivyclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//recordMetrics 记录所有指标的Metrics,可以并发使用
+type recordMetrics struct {
+	mu         sync.Mutex
+	requests   []string
+	durations  []time.Duration
+	watchers   map[string]int
+	started    map[string]int
+	states     []string
+	statements []string
+}
+
+func newRecordMetrics() *recordMetrics {
+	return &recordMetrics{watchers: map[string]int{}, started: map[string]int{}}
+}
+
+func (m *recordMetrics) ObserveRequest(method string, endpoint string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, fmt.Sprintf("%s %s %d", method, endpoint, status))
+	m.durations = append(m.durations, duration)
+}
+
+func (m *recordMetrics) WatcherStarted(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchers[kind]++
+	m.started[kind]++
+}
+
+func (m *recordMetrics) WatcherStopped(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchers[kind]--
+}
+
+func (m *recordMetrics) StateChanged(kind string, id int, from string, to string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states = append(m.states, fmt.Sprintf("%s %d %s->%s", kind, id, from, to))
+}
+
+func (m *recordMetrics) ObserveStatement(state string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statements = append(m.statements, fmt.Sprintf("%s %s", state, duration))
+}
+
+func TestEndpointOf(t *testing.T) {
+	base := "http://livy:8998/api"
+	cases := map[string]string{
+		base + "/batches":                         "batches",
+		base + "/batches/":                        "batches",
+		base + "/batches/12":                      "batches/{id}",
+		base + "/batches/12/log?from=0&size=100":  "batches/{id}/log",
+		base + "/sessions/3/statements/45":        "sessions/{id}/statements/{id}",
+		base + "/sessions/3/statements/45/cancel": "sessions/{id}/statements/{id}/cancel",
+		base + "/sessions/3/jobs/7":               "sessions/{id}/jobs/{id}",
+		base + "/sessions/v2":                     "sessions/v2",
+		base:                                      "",
+		//故障转移到其他地址时只保留路径
+		"http://other:8998/batches/1": "batches/{id}",
+	}
+	for url, want := range cases {
+		if got := endpointOf(base, url); got != want {
+			t.Errorf("endpointOf(%q)为%q,应为%q", url, got, want)
+		}
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	m := newRecordMetrics()
+	c.Metrics = m
+	if NewClient("http://localhost:8998").metrics() != NopMetrics {
+		t.Error("客户端默认的指标收集器应为NopMetrics")
+	}
+	s.BatchStates = []string{"starting", "running", "running", "success"}
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := b.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainWithClock(clock, time.Second, ch)
+	if err := b.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	s.InjectFailure(livytest.Failure{Path: "/batches/0"})
+	if _, err := b.Info(); err == nil {
+		t.Fatal("连接断开时应返回错误")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	want := []string{"POST batches 201", "GET batches/{id} 200", "GET batches/{id} 200", "GET batches/{id} 200", "DELETE batches/{id} 200", "GET batches/{id} 0"}
+	if got := strings.Join(m.requests, ","); got != strings.Join(want, ",") {
+		t.Errorf("请求为%v,应为%v", m.requests, want)
+	}
+	for _, d := range m.durations {
+		//假时钟只在watcher等待时推进,请求本身不耗时
+		if d != 0 {
+			t.Errorf("请求的时长为%s,应为0", d)
+		}
+	}
+	if got := strings.Join(m.states, ","); got != "batch 0 ->starting,batch 0 starting->running,batch 0 running->success,batch 0 success->" {
+		t.Errorf("状态变化为%v", m.states)
+	}
+	if m.started["batch"] != 1 || m.watchers["batch"] != 0 {
+		t.Errorf("启动了%d个watcher,还有%d个在运行,应为1和0", m.started["batch"], m.watchers["batch"])
+	}
+}
+
+func TestStatementMetrics(t *testing.T) {
+	s, b, clock := newTestSession(t, KindSQL)
+	m := newRecordMetrics()
+	b.Client.Metrics = m
+	s.StatementStates = []string{"waiting", "running", "available"}
+	//假服务的statement没有开始和结束时间
+	b.Client.Use(func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			resp, err := next(req)
+			if err == nil && req.Method == http.MethodGet && strings.Contains(req.URL, "/statements/") {
+				resp.Body = []byte(strings.Replace(string(resp.Body), `"started":0`, `"started":1000`, 1))
+				resp.Body = []byte(strings.Replace(string(resp.Body), `"completed":0`, `"completed":3500`, 1))
+			}
+			return resp, err
+		}
+	})
+	st := b.NewStatement()
+	err := st.New(&NewStatementQuery{Code: "SELECT 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := st.Watch(time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainWithClock(clock, time.Second, ch)
+	//只在进入结束状态时记录一次
+	if _, err := st.Info(); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.statements) != 1 || m.statements[0] != "available 2.5s" {
+		t.Errorf("statement的指标为%v,应为[available 2.5s]", m.statements)
+	}
+	if m.started["statement"] != 1 || m.watchers["statement"] != 0 {
+		t.Errorf("启动了%d个watcher,还有%d个在运行,应为1和0", m.started["statement"], m.watchers["statement"])
+	}
+	if got := strings.Join(m.states, ","); got != "" {
+		t.Errorf("不应记录session的状态变化,记录了%s", got)
+	}
+}
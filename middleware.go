@@ -0,0 +1,88 @@
+package golivyclient
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+)
+
+//Request 客户端发往livy的请求
+type Request struct {
+	Context context.Context
+	Method  string
+	URL     string
+	Header  http.Header
+	//Body 请求体,发送时编码为json,为nil时不发送请求体
+	Body interface{}
+
+	//clock 发出请求的客户端的时钟
+	clock Clock
+}
+
+//Response livy的响应
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	//Body 响应体的原始内容
+	Body []byte
+}
+
+//Decode 将响应体解码到v中
+func (r *Response) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+//RoundTrip 一次请求的处理过程
+//
+//返回的Response不会因为状态码而被转换为错误,状态码的检查在所有中间件之后进行
+type RoundTrip func(req *Request) (*Response, error)
+
+//Middleware 请求中间件,包装一次请求的处理过程
+//
+//可以用来做审计日志,注入请求头,统计指标,故障注入和脱敏等
+type Middleware func(next RoundTrip) RoundTrip
+
+//Use 为客户端添加中间件,先添加的在外层
+func (c *LivyClient) Use(mws ...Middleware) {
+	c.Middlewares = append(c.Middlewares, mws...)
+}
+
+func (c *LivyClient) roundTrip() RoundTrip {
+	client := c.httpClient()
+	rt := func(req *Request) (*Response, error) {
+		return doRequest(client, req)
+	}
+	if c.Endpoints != nil {
+		rt = c.Endpoints.wrap(c.BASEURL, c.clock(), rt)
+	}
+	for i := len(c.Middlewares) - 1; i >= 0; i-- {
+		rt = c.Middlewares[i](rt)
+	}
+	return rt
+}
+
+//BasicAuth 为每个请求添加http basic认证
+func BasicAuth(username string, password string) Middleware {
+	token := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return StaticHeaders(http.Header{"Authorization": {"Basic " + token}})
+}
+
+//BearerToken 为每个请求添加Authorization: Bearer token
+func BearerToken(token string) Middleware {
+	return StaticHeaders(http.Header{"Authorization": {"Bearer " + token}})
+}
+
+//StaticHeaders 为每个请求设置固定的请求头,会覆盖请求中已有的同名请求头
+func StaticHeaders(h http.Header) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			for key, values := range h {
+				req.Header[http.CanonicalHeaderKey(key)] = values
+			}
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package golivyclient
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	jsonl "encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//statement输出的mime类型
+const (
+	TableMimeType = "application/vnd.livy.table.v1+json"
+	JSONMimeType  = "application/json"
+	TextMimeType  = "text/plain"
+)
+
+//TableColumn 表格结果的列
+type TableColumn struct {
+	Name string `json:"name"`
+	//Type spark的类型名,如"BIGINT_TYPE","long"或"decimal(10,2)"
+	Type string `json:"type"`
+	//Schema spark的类型定义json,复杂类型为包含元素类型的json对象,只有sql类型statement的输出中有
+	Schema jsonl.RawMessage `json:"-"`
+}
+
+//BaseType 去掉精度等参数后的spark类型,如long,double,string,boolean,timestamp,date,decimal
+func (col TableColumn) BaseType() string {
+	t := strings.ToLower(strings.TrimSpace(col.Type))
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = t[:i]
+	}
+	t = strings.TrimSuffix(t, "_type")
+	switch t {
+	case "bigint":
+		return "long"
+	case "int":
+		return "integer"
+	case "smallint":
+		return "short"
+	case "tinyint":
+		return "byte"
+	case "real":
+		return "float"
+	case "bool":
+		return "boolean"
+	case "char", "varchar":
+		return "string"
+	}
+	return t
+}
+
+//TableResult sql类型的statement返回的表格结果,Rows中的数字为json.Number
+type TableResult struct {
+	Columns []TableColumn
+	Rows    [][]interface{}
+}
+
+//SQLRowLimit livy服务端livy.rsc.sql.num-rows的值,sql类型的statement最多返回这么多行,多出的行会被丢弃;
+//服务端修改了该配置时需要同步修改,为0时不检查
+var SQLRowLimit = 1000
+
+//ErrRowLimit 查询结果的行数达到了SQLRowLimit,可能已被livy截断
+var ErrRowLimit = errors.New("查询结果达到了livy.rsc.sql.num-rows的行数上限,可能已被截断,需要完整的结果时使用Session.Collect")
+
+//Truncated 结果的行数是否达到了SQLRowLimit,达到时无法区分结果恰好有这么多行还是被livy截断
+func (t *TableResult) Truncated() bool {
+	return SQLRowLimit > 0 && len(t.Rows) >= SQLRowLimit
+}
+
+//Table 从执行结束的statement的输出中解析表格结果
+//
+//支持application/vnd.livy.table.v1+json,以及sql类型的statement返回的带schema的application/json
+func (b *Statement) Table() (*TableResult, error) {
+	if err := b.Err(); err != nil {
+		return nil, err
+	}
+	if b.Output == nil || b.Output.Data == nil {
+		return nil, fmt.Errorf("statement %d没有输出,state:%s", b.ID, b.State)
+	}
+	data := map[string]jsonl.RawMessage{}
+	err := jsonl.Unmarshal(*b.Output.Data, &data)
+	if err != nil {
+		return nil, err
+	}
+	res := new(TableResult)
+	if raw, ok := data[TableMimeType]; ok {
+		table := struct {
+			Headers []TableColumn   `json:"headers"`
+			Data    [][]interface{} `json:"data"`
+		}{}
+		err = decodeNumber(raw, &table)
+		if err != nil {
+			return nil, err
+		}
+		res.Columns = table.Headers
+		res.Rows = table.Data
+		return res, nil
+	}
+	if raw, ok := data[JSONMimeType]; ok {
+		table := struct {
+			Schema struct {
+				Fields []struct {
+					Name string           `json:"name"`
+					Type jsonl.RawMessage `json:"type"`
+				} `json:"fields"`
+			} `json:"schema"`
+			Data [][]interface{} `json:"data"`
+		}{}
+		err = decodeNumber(raw, &table)
+		if err != nil {
+			return nil, err
+		}
+		if table.Schema.Fields == nil {
+			return nil, fmt.Errorf("statement %d的输出不是表格", b.ID)
+		}
+		for _, f := range table.Schema.Fields {
+			col := TableColumn{Name: f.Name, Schema: f.Type}
+			//复杂类型的type为json对象,只保留其中的type
+			if jsonl.Unmarshal(f.Type, &col.Type) != nil {
+				complex := struct {
+					Type string `json:"type"`
+				}{}
+				jsonl.Unmarshal(f.Type, &complex)
+				col.Type = complex.Type
+			}
+			res.Columns = append(res.Columns, col)
+		}
+		res.Rows = table.Data
+		return res, nil
+	}
+	return nil, fmt.Errorf("statement %d的输出不是表格", b.ID)
+}
+
+func decodeNumber(raw []byte, v interface{}) error {
+	dec := jsonl.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+//Query 以sql类型执行sql并将表格结果扫描到dest中,见TableResult.Scan
+//
+//livy最多返回livy.rsc.sql.num-rows(默认1000)行,结果的行数达到SQLRowLimit时返回ErrRowLimit,
+//结果可能较多时使用LIMIT或Collect
+func (b *Session) Query(ctx context.Context, sql string, dest interface{}) error {
+	st, err := b.Run(ctx, &NewStatementQuery{Code: sql, Kind: KindSQL})
+	if err != nil {
+		return err
+	}
+	table, err := st.Table()
+	if err != nil {
+		return err
+	}
+	if table.Truncated() {
+		return ErrRowLimit
+	}
+	return table.Scan(dest)
+}
+
+//Scan 将表格结果扫描到dest中,dest为结构体slice的指针或结构体的指针,为结构体指针时只扫描第一行
+//
+//结构体字段通过livy标签对应列名,没有标签时按字段名忽略大小写对应,标签为"-"的字段会被忽略;
+//结果中的列没有对应字段或字段没有对应列时返回错误。
+//long等整数类型可以扫描到整数,浮点数和string,double和float可以扫描到浮点数和string,
+//decimal可以扫描到浮点数,string和big.Rat,timestamp和date可以扫描到time.Time和string,
+//字段为指针时null扫描为nil,字段实现了sql.Scanner时使用Scan
+func (t *TableResult) Scan(dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return errors.New("dest必须为非nil的指针")
+	}
+	dv = dv.Elem()
+	switch {
+	case dv.Kind() == reflect.Struct:
+		if len(t.Rows) == 0 {
+			return sql.ErrNoRows
+		}
+		fields, err := t.fieldIndex(dv.Type())
+		if err != nil {
+			return err
+		}
+		return t.scanRow(t.Rows[0], fields, dv)
+	case dv.Kind() == reflect.Slice:
+		elemType := dv.Type().Elem()
+		isPtr := elemType.Kind() == reflect.Ptr
+		if isPtr {
+			elemType = elemType.Elem()
+		}
+		if elemType.Kind() != reflect.Struct {
+			return fmt.Errorf("不支持扫描到%s", dv.Type())
+		}
+		fields, err := t.fieldIndex(elemType)
+		if err != nil {
+			return err
+		}
+		res := reflect.MakeSlice(dv.Type(), 0, len(t.Rows))
+		for i, row := range t.Rows {
+			elem := reflect.New(elemType)
+			err = t.scanRow(row, fields, elem.Elem())
+			if err != nil {
+				return fmt.Errorf("第%d行:%w", i, err)
+			}
+			if isPtr {
+				res = reflect.Append(res, elem)
+			} else {
+				res = reflect.Append(res, elem.Elem())
+			}
+		}
+		dv.Set(res)
+		return nil
+	}
+	return fmt.Errorf("不支持扫描到%s", dv.Type())
+}
+
+//fieldIndex 返回每一列对应的结构体字段
+func (t *TableResult) fieldIndex(typ reflect.Type) ([][]int, error) {
+	byName := map[string][]int{}
+	names := map[string]string{}
+	order := []string{}
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("livy"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		key := strings.ToLower(name)
+		if _, ok := byName[key]; ok {
+			return nil, fmt.Errorf("%s中有多个字段对应列%s", typ, name)
+		}
+		byName[key] = f.Index
+		names[key] = f.Name
+		order = append(order, key)
+	}
+	fields := make([][]int, len(t.Columns))
+	for i, col := range t.Columns {
+		key := strings.ToLower(col.Name)
+		index, ok := byName[key]
+		if !ok {
+			return nil, fmt.Errorf("列%s在%s中没有对应的字段", col.Name, typ)
+		}
+		fields[i] = index
+		delete(names, key)
+	}
+	for _, key := range order {
+		if name, ok := names[key]; ok {
+			return nil, fmt.Errorf("%s的字段%s在结果中没有对应的列", typ, name)
+		}
+	}
+	return fields, nil
+}
+
+func (t *TableResult) scanRow(row []interface{}, fields [][]int, dv reflect.Value) error {
+	if len(row) != len(t.Columns) {
+		return fmt.Errorf("结果有%d列,但该行有%d个值", len(t.Columns), len(row))
+	}
+	for i, col := range t.Columns {
+		err := convertValue(col, row[i], dv.FieldByIndex(fields[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	ratType     = reflect.TypeOf(big.Rat{})
+)
+
+//Value 将表格中的值转为Go中自然的类型,整数为int64,浮点数为float64,decimal为string,timestamp和date为time.Time
+func (col TableColumn) Value(raw interface{}) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	switch col.BaseType() {
+	case "long", "integer", "short", "byte":
+		return parseInt(col, raw)
+	case "double", "float":
+		return parseFloat(col, raw)
+	case "decimal":
+		return numberText(col, raw)
+	case "timestamp", "date":
+		return parseTime(col, raw)
+	}
+	if n, ok := raw.(jsonl.Number); ok {
+		return n.String(), nil
+	}
+	return raw, nil
+}
+
+func convertValue(col TableColumn, raw interface{}, dst reflect.Value) error {
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) {
+		v, err := col.Value(raw)
+		if err != nil {
+			return err
+		}
+		return dst.Addr().Interface().(sql.Scanner).Scan(v)
+	}
+	if dst.Kind() == reflect.Ptr {
+		if raw == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		elem := reflect.New(dst.Type().Elem())
+		err := convertValue(col, raw, elem.Elem())
+		if err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+	if raw == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("列%s的类型%s不能扫描到%s", col.Name, col.Type, dst.Type())
+	}
+	if dst.Kind() == reflect.Interface {
+		v, err := col.Value(raw)
+		if err != nil {
+			return err
+		}
+		if v != nil && !reflect.TypeOf(v).AssignableTo(dst.Type()) {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	switch col.BaseType() {
+	case "long", "integer", "short", "byte":
+		n, err := parseInt(col, raw)
+		if err != nil {
+			return err
+		}
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(n) {
+				return fmt.Errorf("列%s的值%d超出%s的范围", col.Name, n, dst.Type())
+			}
+			dst.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n < 0 || dst.OverflowUint(uint64(n)) {
+				return fmt.Errorf("列%s的值%d超出%s的范围", col.Name, n, dst.Type())
+			}
+			dst.SetUint(uint64(n))
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(n))
+		case reflect.String:
+			dst.SetString(strconv.FormatInt(n, 10))
+		default:
+			return mismatch()
+		}
+	case "double", "float", "decimal":
+		switch {
+		case dst.Type() == ratType:
+			text, err := numberText(col, raw)
+			if err != nil {
+				return err
+			}
+			r, ok := new(big.Rat).SetString(text)
+			if !ok {
+				return fmt.Errorf("列%s的值%s不是合法的数字", col.Name, text)
+			}
+			dst.Set(reflect.ValueOf(r).Elem())
+		case dst.Kind() == reflect.Float32 || dst.Kind() == reflect.Float64:
+			f, err := parseFloat(col, raw)
+			if err != nil {
+				return err
+			}
+			dst.SetFloat(f)
+		case dst.Kind() == reflect.String:
+			text, err := numberText(col, raw)
+			if err != nil {
+				return err
+			}
+			dst.SetString(text)
+		default:
+			return mismatch()
+		}
+	case "string":
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("列%s的值%v不是字符串", col.Name, raw)
+		}
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(s)
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes([]byte(s))
+		default:
+			return mismatch()
+		}
+	case "boolean":
+		v, ok := raw.(bool)
+		if !ok || dst.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		dst.SetBool(v)
+	case "timestamp", "date":
+		switch {
+		case dst.Type() == timeType:
+			tm, err := parseTime(col, raw)
+			if err != nil {
+				return err
+			}
+			dst.Set(reflect.ValueOf(tm))
+		case dst.Kind() == reflect.String:
+			s, ok := raw.(string)
+			if !ok {
+				return mismatch()
+			}
+			dst.SetString(s)
+		default:
+			return mismatch()
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+func numberText(col TableColumn, raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case jsonl.Number:
+		return v.String(), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("列%s的值%v不是数字", col.Name, raw)
+}
+
+func parseInt(col TableColumn, raw interface{}) (int64, error) {
+	text, err := numberText(col, raw)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("列%s的值%s不是整数", col.Name, text)
+	}
+	return n, nil
+}
+
+//parseFloat spark将NaN和Infinity输出为字符串
+func parseFloat(col TableColumn, raw interface{}) (float64, error) {
+	text, err := numberText(col, raw)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("列%s的值%s不是浮点数", col.Name, text)
+	}
+	return f, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+//parseTime 没有时区的时间按UTC解析,数字按毫秒时间戳解析
+func parseTime(col TableColumn, raw interface{}) (time.Time, error) {
+	switch v := raw.(type) {
+	case jsonl.Number:
+		ms, err := v.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("列%s的值%s不是时间戳", col.Name, v)
+		}
+		return time.UnixMilli(ms).UTC(), nil
+	case string:
+		for _, layout := range timeLayouts {
+			tm, err := time.Parse(layout, v)
+			if err == nil {
+				return tm, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("列%s的值%s不是合法的时间", col.Name, v)
+	}
+	return time.Time{}, fmt.Errorf("列%s的值%v不是时间", col.Name, raw)
+}
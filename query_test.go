@@ -0,0 +1,326 @@
+package golivyclient
+
+import (
+	"context"
+	"database/sql"
+	jsonl "encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//tableOf 从statement的输出data中解析表格结果
+func tableOf(t *testing.T, data string) *TableResult {
+	t.Helper()
+	raw := jsonl.RawMessage(data)
+	st := &Statement{State: "available", Output: &StatementOutput{Status: "ok", Data: &raw}}
+	table, err := st.Table()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+//livyTable 生成application/vnd.livy.table.v1+json格式的输出
+func livyTable(headers string, rows string) string {
+	return `{"` + TableMimeType + `":{"headers":` + headers + `,"data":` + rows + `}}`
+}
+
+func TestStatementTable(t *testing.T) {
+	table := tableOf(t, livyTable(`[{"name":"id","type":"BIGINT_TYPE"},{"name":"name","type":"STRING_TYPE"}]`, `[[1,"a"],[12345678901234567,null]]`))
+	if len(table.Columns) != 2 || table.Columns[0].BaseType() != "long" || table.Columns[1].BaseType() != "string" {
+		t.Errorf("Columns为%+v", table.Columns)
+	}
+	//大整数不能丢失精度
+	if n, ok := table.Rows[1][0].(jsonl.Number); !ok || n.String() != "12345678901234567" || table.Rows[1][1] != nil {
+		t.Errorf("Rows为%v", table.Rows)
+	}
+
+	table = tableOf(t, `{"application/json":{"schema":{"type":"struct","fields":[
+		{"name":"amount","type":"decimal(10,2)","nullable":true},
+		{"name":"tags","type":{"type":"array","elementType":"string","containsNull":true},"nullable":true}
+	]},"data":[["1.50",["x"]]]}}`)
+	if table.Columns[0].Type != "decimal(10,2)" || table.Columns[0].BaseType() != "decimal" || table.Columns[1].Type != "array" {
+		t.Errorf("Columns为%+v", table.Columns)
+	}
+	if !strings.Contains(string(table.Columns[1].Schema), "elementType") {
+		t.Errorf("复杂类型的Schema为%s", table.Columns[1].Schema)
+	}
+
+	for name, st := range map[string]*Statement{
+		"没有输出":         {State: "available"},
+		"执行失败":         {State: "available", Output: &StatementOutput{Status: "error", Ename: "AnalysisException"}},
+		"文本输出":         {State: "available", Output: &StatementOutput{Status: "ok", Data: rawMessage(`{"text/plain":"1"}`)}},
+		"json没有schema": {State: "available", Output: &StatementOutput{Status: "ok", Data: rawMessage(`{"application/json":{"a":1}}`)}},
+	} {
+		if _, err := st.Table(); err == nil {
+			t.Errorf("%s时应返回错误", name)
+		}
+	}
+}
+
+func rawMessage(data string) *jsonl.RawMessage {
+	raw := jsonl.RawMessage(data)
+	return &raw
+}
+
+func TestColumnBaseType(t *testing.T) {
+	cases := map[string]string{
+		"BIGINT_TYPE":    "long",
+		"int":            "integer",
+		"SMALLINT":       "short",
+		"tinyint":        "byte",
+		"decimal(38,0)":  "decimal",
+		"varchar(10)":    "string",
+		"TIMESTAMP_TYPE": "timestamp",
+		" double ":       "double",
+	}
+	for typ, want := range cases {
+		if got := (TableColumn{Type: typ}).BaseType(); got != want {
+			t.Errorf("%s的BaseType为%s,应为%s", typ, got, want)
+		}
+	}
+}
+
+type scanOrder struct {
+	ID      int64
+	Name    string `livy:"customer"`
+	Amount  big.Rat
+	Price   float64
+	Created time.Time
+	Day     string
+	Paid    bool
+	Note    *string
+	Qty     sql.NullInt64
+	Ignored string `livy:"-"`
+}
+
+func TestTableScan(t *testing.T) {
+	headers := `[{"name":"id","type":"long"},{"name":"customer","type":"string"},{"name":"amount","type":"decimal(10,2)"},
+		{"name":"price","type":"double"},{"name":"created","type":"timestamp"},{"name":"day","type":"date"},
+		{"name":"paid","type":"boolean"},{"name":"note","type":"string"},{"name":"qty","type":"integer"}]`
+	table := tableOf(t, livyTable(headers, `[
+		[1,"alice","12.34",1.5,"2024-01-02 03:04:05.123","2024-01-02",true,"gift",3],
+		[2,"bob","0.10","NaN",1704164645000,"2024-01-03",false,null,null]]`))
+
+	orders := []scanOrder{}
+	err := table.Scan(&orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("扫描了%d行", len(orders))
+	}
+	a, b := orders[0], orders[1]
+	if a.ID != 1 || a.Name != "alice" || a.Amount.RatString() != "617/50" || a.Price != 1.5 || !a.Paid || a.Day != "2024-01-02" {
+		t.Errorf("第0行为%+v", a)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC); !a.Created.Equal(want) {
+		t.Errorf("created为%s,应为%s", a.Created, want)
+	}
+	if a.Note == nil || *a.Note != "gift" || !a.Qty.Valid || a.Qty.Int64 != 3 {
+		t.Errorf("note为%v,qty为%+v", a.Note, a.Qty)
+	}
+	//null扫描为nil和无效的NullInt64,毫秒时间戳按UTC解析,spark的NaN为字符串
+	if b.Note != nil || b.Qty.Valid || b.Price == b.Price || !b.Created.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("第1行为%+v", b)
+	}
+
+	ptrs := []*scanOrder{}
+	if err := table.Scan(&ptrs); err != nil || len(ptrs) != 2 || ptrs[1].ID != 2 {
+		t.Errorf("扫描到指针slice得到%v,%v", ptrs, err)
+	}
+	one := scanOrder{}
+	if err := table.Scan(&one); err != nil || one.ID != 1 {
+		t.Errorf("扫描到结构体得到%+v,%v", one, err)
+	}
+}
+
+func TestTableScanConversions(t *testing.T) {
+	type intoInt8 struct{ V int8 }
+	type intoUint struct{ V uint }
+	type intoString struct{ V string }
+	type intoFloat struct{ V float32 }
+	type intoBytes struct{ V []byte }
+	type intoAny struct{ V interface{} }
+	type intoTime struct{ V time.Time }
+	cases := []struct {
+		name string
+		typ  string
+		raw  string
+		dest interface{}
+		want interface{}
+	}{
+		{"long到int8", "long", `127`, &intoInt8{}, &intoInt8{127}},
+		{"long到uint", "long", `7`, &intoUint{}, &intoUint{7}},
+		{"long到string", "long", `-7`, &intoString{}, &intoString{"-7"}},
+		{"long到float", "long", `3`, &intoFloat{}, &intoFloat{3}},
+		{"decimal到string保留精度", "decimal(38,18)", `"0.100000000000000001"`, &intoString{}, &intoString{"0.100000000000000001"}},
+		{"string到[]byte", "string", `"abc"`, &intoBytes{}, &intoBytes{[]byte("abc")}},
+		{"long到interface", "long", `5`, &intoAny{}, &intoAny{int64(5)}},
+		{"decimal到interface", "decimal(10,2)", `1.25`, &intoAny{}, &intoAny{"1.25"}},
+		{"date到interface", "date", `"2024-02-29"`, &intoAny{}, &intoAny{time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)}},
+		{"null到interface", "string", `null`, &intoAny{V: "x"}, &intoAny{}},
+		{"null到非指针为零值", "long", `null`, &intoInt8{V: 1}, &intoInt8{}},
+		{"带时区的timestamp", "timestamp", `"2024-01-02T03:04:05+08:00"`, &intoTime{}, &intoTime{time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 8*3600))}},
+	}
+	for _, c := range cases {
+		table := tableOf(t, livyTable(`[{"name":"v","type":"`+c.typ+`"}]`, `[[`+c.raw+`]]`))
+		err := table.Scan(c.dest)
+		if err != nil {
+			t.Errorf("%s:%v", c.name, err)
+			continue
+		}
+		if tm, ok := c.want.(*intoTime); ok {
+			if !c.dest.(*intoTime).V.Equal(tm.V) {
+				t.Errorf("%s:得到%v,应为%v", c.name, c.dest, c.want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(c.dest, c.want) {
+			t.Errorf("%s:得到%v,应为%v", c.name, c.dest, c.want)
+		}
+	}
+}
+
+func TestTableScanErrors(t *testing.T) {
+	type intoInt8 struct{ V int8 }
+	type intoUint struct{ V uint }
+	type intoInt struct{ V int }
+	type intoBool struct{ V bool }
+	type intoTime struct{ V time.Time }
+	type intoString struct{ V string }
+	type intoAnyInt struct{ V interface{ Int() int } }
+	cases := []struct {
+		name string
+		typ  string
+		raw  string
+		dest interface{}
+	}{
+		{"超出int8的范围", "long", `128`, &intoInt8{}},
+		{"负数到uint", "long", `-1`, &intoUint{}},
+		{"小数到整数", "long", `1.5`, &intoInt{}},
+		{"string到int", "string", `"1"`, &intoInt{}},
+		{"long到bool", "long", `1`, &intoBool{}},
+		{"数字到string列", "string", `1`, &intoString{}},
+		{"double到time", "double", `1.5`, &intoTime{}},
+		{"非法的时间", "timestamp", `"yesterday"`, &intoTime{}},
+		{"不能赋值的interface", "long", `1`, &intoAnyInt{}},
+		{"未知的类型", "map", `{}`, &intoString{}},
+	}
+	for _, c := range cases {
+		table := tableOf(t, livyTable(`[{"name":"v","type":"`+c.typ+`"}]`, `[[`+c.raw+`]]`))
+		if err := table.Scan(c.dest); err == nil {
+			t.Errorf("%s时应返回错误", c.name)
+		}
+	}
+
+	table := tableOf(t, livyTable(`[{"name":"a","type":"long"},{"name":"b","type":"long"}]`, `[[1,2],[3]]`))
+	type ab struct{ A, B int }
+	type onlyA struct{ A int }
+	type abc struct{ A, B, C int }
+	type dup struct {
+		A int
+		X int `livy:"a"`
+		B int
+	}
+	errs := map[string]interface{}{
+		"dest为nil":     nil,
+		"dest不是指针":     ab{},
+		"dest为nil指针":   (*ab)(nil),
+		"slice元素不是结构体": &[]int{},
+		"不支持的类型":       new(int),
+		"列没有对应的字段":     &onlyA{},
+		"字段没有对应的列":     &abc{},
+		"多个字段对应同一列":    &dup{},
+		"行的长度与列不一致":    &[]ab{},
+	}
+	for name, dest := range errs {
+		if err := table.Scan(dest); err == nil {
+			t.Errorf("%s时应返回错误", name)
+		}
+	}
+	empty := tableOf(t, livyTable(`[{"name":"a","type":"long"}]`, `[]`))
+	if err := empty.Scan(&onlyA{}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("没有结果时扫描到结构体应返回sql.ErrNoRows,err为%v", err)
+	}
+	rows := []onlyA{{1}}
+	if err := empty.Scan(&rows); err != nil || len(rows) != 0 {
+		t.Errorf("没有结果时扫描到slice应得到空slice,得到%v,%v", rows, err)
+	}
+}
+
+func TestSessionQuery(t *testing.T) {
+	s, b, _ := newTestSession(t, KindPySpark)
+	s.StatementStates = []string{"available"}
+	rows := 3
+	s.StatementResult = func(code string) (map[string]interface{}, error) {
+		if strings.Contains(code, "missing") {
+			return nil, errors.New("Table or view not found: missing")
+		}
+		data := [][]interface{}{}
+		for i := 0; i < rows; i++ {
+			data = append(data, []interface{}{i, "n"})
+		}
+		return map[string]interface{}{TableMimeType: map[string]interface{}{
+			"headers": []interface{}{map[string]string{"name": "id", "type": "INT_TYPE"}, map[string]string{"name": "name", "type": "STRING_TYPE"}},
+			"data":    data,
+		}}, nil
+	}
+	type row struct {
+		ID   int
+		Name string
+	}
+	ctx := context.Background()
+	res := []row{}
+	err := b.Query(ctx, "SELECT id, name FROM t", &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 || res[2].ID != 2 || res[2].Name != "n" {
+		t.Errorf("结果为%+v", res)
+	}
+	//sql类型执行,不使用session的kind
+	if body := string(s.Requests()[len(s.Requests())-2].Body); !strings.Contains(body, `"kind":"sql"`) {
+		t.Errorf("请求体为%s", body)
+	}
+
+	if err := b.Query(ctx, "SELECT * FROM missing", &res); err == nil || !strings.Contains(err.Error(), "Table or view not found") {
+		t.Errorf("执行失败时应返回错误,err为%v", err)
+	}
+
+	limit := SQLRowLimit
+	t.Cleanup(func() { SQLRowLimit = limit })
+	SQLRowLimit = 3
+	if err := b.Query(ctx, "SELECT id, name FROM t", &res); err != ErrRowLimit {
+		t.Errorf("行数达到SQLRowLimit时应返回ErrRowLimit,err为%v", err)
+	}
+	rows = 2
+	if err := b.Query(ctx, "SELECT id, name FROM t", &res); err != nil || len(res) != 2 {
+		t.Errorf("行数少于SQLRowLimit时得到%+v,%v", res, err)
+	}
+	SQLRowLimit = 0
+	rows = 5
+	if err := b.Query(ctx, "SELECT id, name FROM t", &res); err != nil || len(res) != 5 {
+		t.Errorf("SQLRowLimit为0时不检查行数,得到%+v,%v", res, err)
+	}
+}
+
+func TestTableTruncated(t *testing.T) {
+	limit := SQLRowLimit
+	t.Cleanup(func() { SQLRowLimit = limit })
+	SQLRowLimit = 2
+	cases := []struct {
+		rows int
+		want bool
+	}{{1, false}, {2, true}, {3, true}}
+	for _, c := range cases {
+		table := &TableResult{Rows: make([][]interface{}, c.rows)}
+		if table.Truncated() != c.want {
+			t.Errorf("%d行时Truncated为%v", c.rows, !c.want)
+		}
+	}
+}
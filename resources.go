@@ -0,0 +1,157 @@
+package golivyclient
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Memory 以字节为单位的内存大小,转为字符串时为jvm的格式,如512m或4g
+type Memory int64
+
+//内存单位
+const (
+	KB Memory = 1 << (10 * (iota + 1))
+	MB
+	GB
+	TB
+)
+
+var memoryUnits = []struct {
+	unit   Memory
+	suffix string
+}{{TB, "t"}, {GB, "g"}, {MB, "m"}, {KB, "k"}}
+
+//String 转为能整除的最大单位,不足1k时向上取整为1k,0为空字符串
+func (m Memory) String() string {
+	if m <= 0 {
+		return ""
+	}
+	for _, u := range memoryUnits {
+		if m%u.unit == 0 {
+			return strconv.FormatInt(int64(m/u.unit), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64((m+KB-1)/KB), 10) + "k"
+}
+
+//parseMemoryPattern ParseMemory接受的格式:非负整数,可选的单位k,m,g,t和可选的b,不区分大小写,如512m,4g,4gb;
+//比jvm的格式宽松,提交请求时的校验见memoryPattern
+var parseMemoryPattern = regexp.MustCompile(`^([0-9]+)([kmgt]?)(b?)$`)
+
+//splitMemory 按parseMemoryPattern拆分出数字和单位,unit为空表示没有k,m,g,t单位
+func splitMemory(s string) (n int64, unit string, ok bool) {
+	m := parseMemoryPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, "", false
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return n, m[2], true
+}
+
+//ParseMemory 解析jvm格式的内存大小,如512m,4g,也接受4gb这样带b的写法,没有单位时为字节数
+func ParseMemory(s string) (Memory, error) {
+	n, unit, ok := splitMemory(s)
+	if !ok {
+		return 0, fmt.Errorf("内存格式错误:%q", s)
+	}
+	for _, u := range memoryUnits {
+		if u.suffix == unit {
+			return Memory(n) * u.unit, nil
+		}
+	}
+	return Memory(n), nil
+}
+
+//MarshalText 实现encoding.TextMarshaler
+func (m Memory) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+//UnmarshalText 实现encoding.TextUnmarshaler
+func (m *Memory) UnmarshalText(text []byte) error {
+	v, err := ParseMemory(string(text))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+//Resources 命名的资源预设,通过LivyClient.Presets配置,在builder中使用Preset应用
+type Resources struct {
+	DriverMemory   Memory                 `json:"driverMemory,omitempty" yaml:"driverMemory,omitempty" toml:"driverMemory,omitempty"`
+	DriverCores    int                    `json:"driverCores,omitempty" yaml:"driverCores,omitempty" toml:"driverCores,omitempty"`
+	ExecutorMemory Memory                 `json:"executorMemory,omitempty" yaml:"executorMemory,omitempty" toml:"executorMemory,omitempty"`
+	ExecutorCores  int                    `json:"executorCores,omitempty" yaml:"executorCores,omitempty" toml:"executorCores,omitempty"`
+	NumExecutors   int                    `json:"numExecutors,omitempty" yaml:"numExecutors,omitempty" toml:"numExecutors,omitempty"`
+	Queue          string                 `json:"queue,omitempty" yaml:"queue,omitempty" toml:"queue,omitempty"`
+	Conf           map[string]interface{} `json:"conf,omitempty" yaml:"conf,omitempty" toml:"conf,omitempty"`
+}
+
+//DefaultPresets 常用的资源预设,LivyClient.Presets中没有同名预设时使用
+var DefaultPresets = map[string]Resources{
+	"small": {
+		DriverMemory: 1 * GB, DriverCores: 1,
+		ExecutorMemory: 2 * GB, ExecutorCores: 1, NumExecutors: 2,
+	},
+	"medium": {
+		DriverMemory: 2 * GB, DriverCores: 2,
+		ExecutorMemory: 4 * GB, ExecutorCores: 2, NumExecutors: 8,
+	},
+	"large": {
+		DriverMemory: 4 * GB, DriverCores: 4,
+		ExecutorMemory: 8 * GB, ExecutorCores: 4, NumExecutors: 32,
+	},
+}
+
+//preset 查找命名的资源预设,c可以为nil
+func (c *LivyClient) preset(name string) (Resources, error) {
+	if c != nil {
+		if r, ok := c.Presets[name]; ok {
+			return r, nil
+		}
+	}
+	if r, ok := DefaultPresets[name]; ok {
+		return r, nil
+	}
+	return Resources{}, fmt.Errorf("未找到资源预设:%s", name)
+}
+
+//mergeConf 合并配置,后面的同名配置覆盖前面的,都为空时返回nil
+func mergeConf(confs ...map[string]interface{}) map[string]interface{} {
+	var res map[string]interface{}
+	for _, conf := range confs {
+		for key, value := range conf {
+			if res == nil {
+				res = map[string]interface{}{}
+			}
+			res[key] = value
+		}
+	}
+	return res
+}
+
+//withDefaultConf 返回合并了客户端默认配置的请求,没有默认配置时返回q本身
+func (q *NewBatchQuery) withDefaultConf(defaults map[string]interface{}) *NewBatchQuery {
+	if len(defaults) == 0 {
+		return q
+	}
+	nq := *q
+	nq.Conf = mergeConf(defaults, q.Conf)
+	return &nq
+}
+
+//withDefaultConf 返回合并了客户端默认配置的请求,没有默认配置时返回q本身
+func (q *NewSessionQuery) withDefaultConf(defaults map[string]interface{}) *NewSessionQuery {
+	if len(defaults) == 0 {
+		return q
+	}
+	nq := *q
+	nq.Conf = mergeConf(defaults, q.Conf)
+	return &nq
+}
@@ -0,0 +1,104 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+//RetryPolicy 请求失败时的重试策略
+type RetryPolicy struct {
+	//MaxAttempts 包括第一次在内的最多请求次数,不大于1时不重试
+	MaxAttempts int
+	//Backoff 第一次重试前的等待时间,之后每次翻倍
+	Backoff time.Duration
+	//MaxBackoff 等待时间的上限,为0时不限制
+	MaxBackoff time.Duration
+	//Retryable 判断一次请求是否需要重试,为nil时使用DefaultRetryable
+	Retryable func(req *Request, resp *Response, err error) bool
+	//Clock 退避等待使用的时钟,为nil时使用发出请求的LivyClient的Clock
+	Clock Clock
+}
+
+//DefaultRetryable 默认的重试条件
+//
+//GET,HEAD,PUT,DELETE和OPTIONS请求在出错或返回502,503,504时重试;
+//其他请求只在连接没有建立时重试,以免重复创建batch,session或statement;ctx取消后不重试
+func DefaultRetryable(req *Request, resp *Response, err error) bool {
+	if req.Context != nil && req.Context.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return idempotent(req.Method) || isDialError(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(req.Method)
+	}
+	return false
+}
+
+//idempotent 重复发送不会产生副作用的请求方法
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+//isDialError 连接没有建立的错误,此时请求一定没有到达服务端
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+//Retry 按策略重试失败请求的中间件,返回最后一次请求的结果
+func Retry(p RetryPolicy) Middleware {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+	return func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			ctx := req.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			clock := p.Clock
+			if clock == nil {
+				clock = req.clock
+			}
+			if clock == nil {
+				clock = SystemClock
+			}
+			for attempt := 1; ; attempt++ {
+				resp, err := next(req)
+				if attempt >= p.MaxAttempts || !retryable(req, resp, err) {
+					return resp, err
+				}
+				select {
+				case <-ctx.Done():
+					return resp, err
+				case <-clock.After(p.backoff(attempt)):
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package golivyclient
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//countAttempts 统计经过的请求数的中间件
+func countAttempts() (Middleware, func() int) {
+	var mu sync.Mutex
+	n := 0
+	mw := func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			mu.Lock()
+			n++
+			mu.Unlock()
+			return next(req)
+		}
+	}
+	return mw, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return n
+	}
+}
+
+func TestRetryIdempotentOnUnavailable(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	c.Use(Retry(RetryPolicy{MaxAttempts: 4, Backoff: time.Second, Clock: clock}))
+	b := NewBatch(c)
+	err := b.New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.InjectFailure(livytest.Failure{Method: http.MethodGet, Path: "/batches/0", Status: http.StatusServiceUnavailable, Times: 2})
+	start := clock.Now()
+	ticks, err := runWithClock(clock, time.Second, func() error {
+		_, err := b.Info()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//两次重试分别等待1秒和2秒
+	if ticks != 3 || clock.Now().Sub(start) != 3*time.Second {
+		t.Errorf("等待了%d次,共%s,应为3次,共3s", ticks, clock.Now().Sub(start))
+	}
+	if n := countRequests(s, http.MethodGet, "/batches/0"); n != 3 {
+		t.Errorf("请求了%d次,应为3次", n)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	c.Use(Retry(RetryPolicy{MaxAttempts: 2, Backoff: time.Second, Clock: clock}))
+	s.InjectFailure(livytest.Failure{Method: http.MethodGet, Path: "/batches/0", Status: http.StatusBadGateway})
+	b := NewBatch(c)
+	_, err := runWithClock(clock, time.Second, func() error {
+		_, err := b.Info()
+		return err
+	})
+	if err == nil {
+		t.Error("重试次数用完后应返回错误")
+	}
+	if n := countRequests(s, http.MethodGet, "/batches/0"); n != 2 {
+		t.Errorf("请求了%d次,应为2次", n)
+	}
+}
+
+func TestRetryDoesNotRepeatPost(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	c.Use(Retry(RetryPolicy{MaxAttempts: 4, Backoff: time.Second, Clock: clock}))
+	s.InjectFailure(livytest.Failure{Method: http.MethodPost, Path: "/batches", Status: http.StatusServiceUnavailable, Times: 1})
+	ticks, err := runWithClock(clock, time.Second, func() error {
+		return NewBatch(c).New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	})
+	if err == nil {
+		t.Error("POST返回503时应返回错误")
+	}
+	if ticks != 0 {
+		t.Errorf("等待了%d次,POST不应重试", ticks)
+	}
+	if n := countRequests(s, http.MethodPost, "/batches"); n != 1 {
+		t.Errorf("请求了%d次,应为1次", n)
+	}
+}
+
+func TestRetryPostOnDialError(t *testing.T) {
+	s := livytest.NewServer()
+	s.Close()
+	c := NewClient(s.URL)
+	clock := livytest.NewFakeClock(time.Unix(0, 0))
+	c.Clock = clock
+	counter, attempts := countAttempts()
+	c.Use(Retry(RetryPolicy{MaxAttempts: 3, Backoff: time.Second, Clock: clock}), counter)
+	ticks, err := runWithClock(clock, time.Second, func() error {
+		return NewBatch(c).New(&NewBatchQuery{File: "hdfs:///app.jar"})
+	})
+	if err == nil {
+		t.Error("服务不可用时应返回错误")
+	}
+	//连接没有建立时POST也会重试
+	if attempts() != 3 || ticks != 3 {
+		t.Errorf("请求了%d次,等待了%d次,应为3次和3次", attempts(), ticks)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, d := range want {
+		if got := p.backoff(i + 1); got != d {
+			t.Errorf("第%d次重试等待%s,应为%s", i+1, got, d)
+		}
+	}
+	p.MaxBackoff = 0
+	if got := p.backoff(5); got != 16*time.Second {
+		t.Errorf("没有上限时第5次重试等待%s,应为16s", got)
+	}
+}
+
+func TestRetryDefaultsToClientClock(t *testing.T) {
+	s, c, clock := newTestClient(t)
+	c.Use(Retry(RetryPolicy{MaxAttempts: 3, Backoff: time.Second}))
+	s.InjectFailure(livytest.Failure{Method: http.MethodGet, Path: "/batches/0", Status: http.StatusServiceUnavailable, Times: 2})
+	b := NewBatch(c)
+	start := clock.Now()
+	ticks, err := runWithClock(clock, time.Second, func() error {
+		_, err := b.Info()
+		return err
+	})
+	//没有设置Clock时按客户端的Clock等待
+	if ticks != 3 || clock.Now().Sub(start) != 3*time.Second {
+		t.Errorf("等待了%d次,共%s,应为3次,共3s", ticks, clock.Now().Sub(start))
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "未找到资源") {
+		t.Errorf("err为%v,应为重试后的404", err)
+	}
+}
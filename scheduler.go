@@ -0,0 +1,256 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+//ErrSchedulerClosed 调度器已关闭
+var ErrSchedulerClosed = errors.New("statement调度器已关闭")
+
+//StatementFuture 提交到调度器的statement的执行结果
+type StatementFuture struct {
+	scheduler *StatementScheduler
+	caller    string
+	query     *NewStatementQuery
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stop      func() bool
+	running   bool
+	done      chan struct{}
+	statement *Statement
+	err       error
+}
+
+//Done 执行结束后关闭的channel
+func (f *StatementFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+//Wait 等待执行结束,返回执行结束的statement;与Session.Run相同,statement执行出错或被取消时同时返回statement和它的错误
+//
+//ctx只控制等待本身,取消ctx不会取消statement的执行,需要取消时使用Cancel
+func (f *StatementFuture) Wait(ctx context.Context) (*Statement, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.done:
+		return f.statement, f.err
+	}
+}
+
+//Cancel 取消执行,还在排队的提交直接在本地丢弃,已经提交到livy的statement会被取消
+func (f *StatementFuture) Cancel() {
+	f.cancel()
+}
+
+//finishLocked 设置执行结果,调用时需要持有调度器的锁
+func (f *StatementFuture) finishLocked(st *Statement, err error) {
+	f.statement = st
+	f.err = err
+	f.stop()
+	f.cancel()
+	close(f.done)
+}
+
+//StatementScheduler 在一个共享的session上调度多个goroutine提交的statement
+//
+//livy的session同一时间只执行一个statement,调度器限制同时提交到livy的statement数量,
+//并优先调度最久没有被调度的调用方,避免某个调用方的大量提交阻塞其他调用方
+type StatementScheduler struct {
+	session      *Session
+	maxInFlight  int
+	pollInterval time.Duration
+
+	mu       sync.Mutex
+	callers  map[string]*callerQueue
+	order    []string
+	seq      uint64
+	inflight int
+	closed   bool
+}
+
+//callerQueue 一个调用方的排队情况
+type callerQueue struct {
+	futures []*StatementFuture
+	//outstanding 排队中和执行中的提交数量,为0时移除该调用方
+	outstanding int
+	//served 最近一次被调度时的序号,优先调度最久没有被调度的调用方
+	served uint64
+}
+
+//NewStatementScheduler 创建调度器,maxInFlight为同时提交到livy的statement数量,小于等于0时为1;pollInterval为0时使用1秒
+func NewStatementScheduler(s *Session, maxInFlight int, pollInterval time.Duration) *StatementScheduler {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	sc := new(StatementScheduler)
+	sc.session = s
+	sc.maxInFlight = maxInFlight
+	sc.pollInterval = pollInterval
+	sc.callers = map[string]*callerQueue{}
+	return sc
+}
+
+//Submit 提交一个statement,caller标识调用方,相同调用方的提交按顺序执行,不同调用方之间轮流执行
+//
+//ctx被取消时,还在排队的提交会在本地丢弃,已经提交到livy的statement会被取消
+func (sc *StatementScheduler) Submit(ctx context.Context, caller string, q *NewStatementQuery) *StatementFuture {
+	f := new(StatementFuture)
+	f.scheduler = sc
+	f.caller = caller
+	f.query = q
+	f.done = make(chan struct{})
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		f.stop = func() bool { return false }
+		f.finishLocked(nil, ErrSchedulerClosed)
+		return f
+	}
+	cq, ok := sc.callers[caller]
+	if !ok {
+		cq = new(callerQueue)
+		sc.callers[caller] = cq
+		sc.order = append(sc.order, caller)
+	}
+	cq.futures = append(cq.futures, f)
+	cq.outstanding++
+	f.stop = context.AfterFunc(f.ctx, func() {
+		sc.drop(f, f.ctx.Err())
+	})
+	sc.dispatchLocked()
+	return f
+}
+
+//Pending 排队中还没有提交到livy的数量
+func (sc *StatementScheduler) Pending() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	n := 0
+	for _, cq := range sc.callers {
+		n += len(cq.futures)
+	}
+	return n
+}
+
+//drop 将还在排队的提交从队列中移除
+func (sc *StatementScheduler) drop(f *StatementFuture, err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if f.running {
+		return
+	}
+	cq, ok := sc.callers[f.caller]
+	if !ok {
+		return
+	}
+	for i, ele := range cq.futures {
+		if ele == f {
+			cq.futures = append(cq.futures[:i], cq.futures[i+1:]...)
+			f.finishLocked(nil, err)
+			sc.doneLocked(f.caller)
+			return
+		}
+	}
+}
+
+//doneLocked 调用方的一个提交结束,调用时需要持有锁
+func (sc *StatementScheduler) doneLocked(caller string) {
+	cq, ok := sc.callers[caller]
+	if !ok {
+		return
+	}
+	cq.outstanding--
+	if cq.outstanding > 0 {
+		return
+	}
+	delete(sc.callers, caller)
+	for i, ele := range sc.order {
+		if ele == caller {
+			sc.order = append(sc.order[:i], sc.order[i+1:]...)
+			break
+		}
+	}
+}
+
+//nextLocked 取出最久没有被调度的调用方的下一个提交,调用时需要持有锁
+func (sc *StatementScheduler) nextLocked() *StatementFuture {
+	var best *callerQueue
+	for _, caller := range sc.order {
+		cq := sc.callers[caller]
+		if len(cq.futures) == 0 {
+			continue
+		}
+		if best == nil || cq.served < best.served {
+			best = cq
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	f := best.futures[0]
+	best.futures = best.futures[1:]
+	sc.seq++
+	best.served = sc.seq
+	return f
+}
+
+func (sc *StatementScheduler) dispatchLocked() {
+	for sc.inflight < sc.maxInFlight {
+		f := sc.nextLocked()
+		if f == nil {
+			return
+		}
+		f.running = true
+		sc.inflight++
+		//不使用NewStatement,避免并发修改session的Statements
+		st := &Statement{Session: sc.session, URI: "statements"}
+		go sc.run(f, st)
+	}
+}
+
+func (sc *StatementScheduler) run(f *StatementFuture, st *Statement) {
+	var res *Statement
+	err := st.NewWithContext(f.ctx, f.query)
+	if err == nil {
+		err = st.Wait(f.ctx, sc.pollInterval)
+		if err != nil && f.ctx.Err() != nil {
+			cerr := st.Cancel()
+			if cerr != nil {
+				sc.session.Client.logger().Warn("statement scheduler cancel error", "session_id", sc.session.ID, "statement_id", st.ID, "err", cerr)
+			}
+		}
+		if err == nil {
+			res = st
+			err = st.Err()
+		}
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.inflight--
+	f.finishLocked(res, err)
+	sc.doneLocked(f.caller)
+	sc.dispatchLocked()
+}
+
+//Close 关闭调度器,丢弃所有排队中的提交,已经提交到livy的statement会继续执行
+func (sc *StatementScheduler) Close() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.closed = true
+	for caller, cq := range sc.callers {
+		futures := cq.futures
+		cq.futures = nil
+		for _, f := range futures {
+			f.finishLocked(nil, ErrSchedulerClosed)
+			sc.doneLocked(caller)
+		}
+	}
+}
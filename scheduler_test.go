@@ -0,0 +1,233 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//newTestScheduler 创建调度器,statement提交后需要推进一次时钟才会执行完
+func newTestScheduler(t *testing.T, maxInFlight int) (*livytest.Server, *StatementScheduler, *livytest.FakeClock) {
+	t.Helper()
+	s, b, clock := newTestSession(t, KindSQL)
+	s.StatementStates = []string{"waiting", "waiting", "available"}
+	s.StatementResult = func(code string) (map[string]interface{}, error) {
+		if strings.HasPrefix(code, "fail") {
+			return nil, errors.New("AnalysisException")
+		}
+		return map[string]interface{}{TextMimeType: code}, nil
+	}
+	return s, NewStatementScheduler(b, maxInFlight, time.Second), clock
+}
+
+//submitted 按提交到livy的顺序返回statement的代码
+func submitted(t *testing.T, s *livytest.Server) []string {
+	t.Helper()
+	res := []string{}
+	for _, r := range s.Requests() {
+		if r.Method != http.MethodPost || r.Path != "/sessions/0/statements" {
+			continue
+		}
+		q := NewStatementQuery{}
+		if err := json.Unmarshal(r.Body, &q); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, q.Code)
+	}
+	return res
+}
+
+//waitSubmitted 等待提交到livy的statement达到n个
+func waitSubmitted(t *testing.T, s *livytest.Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for countRequests(s, http.MethodPost, "/sessions/0/statements") < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时,提交了%v", submitted(t, s))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+//schedulerStats 排队中的提交,调用方和执行中的数量
+func schedulerStats(sc *StatementScheduler) (pending int, callers int, inflight int) {
+	pending = sc.Pending()
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return pending, len(sc.callers), sc.inflight
+}
+
+func isDone(f *StatementFuture) bool {
+	select {
+	case <-f.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestNewStatementSchedulerDefaults(t *testing.T) {
+	sc := NewStatementScheduler(&Session{}, 0, 0)
+	if sc.maxInFlight != 1 || sc.pollInterval != time.Second {
+		t.Errorf("maxInFlight为%d,pollInterval为%s,应为1和1s", sc.maxInFlight, sc.pollInterval)
+	}
+}
+
+func TestStatementSchedulerMaxInFlight(t *testing.T) {
+	s, sc, clock := newTestScheduler(t, 2)
+	ctx := context.Background()
+	futures := []*StatementFuture{}
+	for _, caller := range []string{"a", "b", "c", "d"} {
+		futures = append(futures, sc.Submit(ctx, caller, &NewStatementQuery{Code: "SELECT '" + caller + "'"}))
+	}
+	waitSubmitted(t, s, 2)
+	clock.BlockUntil(2)
+	if n := len(submitted(t, s)); n != 2 || sc.Pending() != 2 {
+		t.Fatalf("同时提交了%d个,排队%d个,应为2和2", n, sc.Pending())
+	}
+	//前两个执行完后才提交后两个
+	clock.Advance(time.Second)
+	waitSubmitted(t, s, 4)
+	clock.BlockUntil(2)
+	if !isDone(futures[0]) || !isDone(futures[1]) || isDone(futures[2]) || isDone(futures[3]) {
+		t.Error("只有前两个应执行完")
+	}
+	clock.Advance(time.Second)
+	for i, f := range futures {
+		st, err := f.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"text/plain":"` + f.query.Code + `"}`; st.State != "available" || string(*st.Output.Data) != want {
+			t.Errorf("第%d个的状态为%s,输出为%s", i, st.State, *st.Output.Data)
+		}
+	}
+	if pending, callers, inflight := schedulerStats(sc); pending != 0 || callers != 0 || inflight != 0 {
+		t.Errorf("执行完后排队%d个,调用方%d个,执行中%d个", pending, callers, inflight)
+	}
+}
+
+func TestStatementSchedulerFairQueuing(t *testing.T) {
+	s, sc, clock := newTestScheduler(t, 1)
+	ctx := context.Background()
+	futures := []*StatementFuture{sc.Submit(ctx, "a", &NewStatementQuery{Code: "a0"})}
+	waitSubmitted(t, s, 1)
+	for _, code := range []string{"a1", "a2", "b0", "b1", "c0"} {
+		futures = append(futures, sc.Submit(ctx, code[:1], &NewStatementQuery{Code: code}))
+	}
+	for _, f := range futures {
+		advanceUntil(clock, time.Second, f.done)
+	}
+	//a已经被调度过,b和c优先;同一个调用方按提交顺序执行
+	if got := strings.Join(submitted(t, s), ","); got != "a0,b0,c0,a1,b1,a2" {
+		t.Errorf("提交的顺序为%s,应为a0,b0,c0,a1,b1,a2", got)
+	}
+}
+
+func TestStatementSchedulerError(t *testing.T) {
+	_, sc, clock := newTestScheduler(t, 1)
+	f := sc.Submit(context.Background(), "a", &NewStatementQuery{Code: "fail"})
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	st, err := f.Wait(context.Background())
+	if st == nil || err == nil || !strings.Contains(err.Error(), "AnalysisException") {
+		t.Errorf("执行出错时应同时返回statement和错误,st为%v,err为%v", st, err)
+	}
+}
+
+func TestStatementSchedulerCancelQueued(t *testing.T) {
+	s, sc, clock := newTestScheduler(t, 1)
+	ctx := context.Background()
+	running := sc.Submit(ctx, "a", &NewStatementQuery{Code: "a0"})
+	waitSubmitted(t, s, 1)
+	queued := sc.Submit(ctx, "b", &NewStatementQuery{Code: "b0"})
+	cctx, cancel := context.WithCancel(ctx)
+	byCtx := sc.Submit(cctx, "c", &NewStatementQuery{Code: "c0"})
+	queued.Cancel()
+	cancel()
+	for _, f := range []*StatementFuture{queued, byCtx} {
+		if st, err := f.Wait(ctx); st != nil || !errors.Is(err, context.Canceled) {
+			t.Errorf("取消排队中的提交应返回context.Canceled,st为%v,err为%v", st, err)
+		}
+	}
+	if sc.Pending() != 0 {
+		t.Errorf("取消后排队%d个,应为0个", sc.Pending())
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if _, err := running.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	//取消的提交不会发送到livy
+	if got := submitted(t, s); len(got) != 1 {
+		t.Errorf("提交了%v,应只有a0", got)
+	}
+	if _, callers, _ := schedulerStats(sc); callers != 0 {
+		t.Errorf("执行完后还有%d个调用方", callers)
+	}
+}
+
+func TestStatementSchedulerCancelRunning(t *testing.T) {
+	s, sc, clock := newTestScheduler(t, 1)
+	ctx := context.Background()
+	f := sc.Submit(ctx, "a", &NewStatementQuery{Code: "a0"})
+	next := sc.Submit(ctx, "a", &NewStatementQuery{Code: "a1"})
+	clock.BlockUntil(1)
+	f.Cancel()
+	if _, err := f.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消执行中的statement应返回context.Canceled,err为%v", err)
+	}
+	if n := countRequests(s, http.MethodPost, "/sessions/0/statements/0/cancel"); n != 1 {
+		t.Errorf("取消了%d次,应为1次", n)
+	}
+	//取消后继续调度排队中的提交
+	advanceUntil(clock, time.Second, next.done)
+	if _, err := next.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatementSchedulerClose(t *testing.T) {
+	s, sc, clock := newTestScheduler(t, 1)
+	ctx := context.Background()
+	running := sc.Submit(ctx, "a", &NewStatementQuery{Code: "a0"})
+	waitSubmitted(t, s, 1)
+	queued := sc.Submit(ctx, "b", &NewStatementQuery{Code: "b0"})
+	sc.Close()
+	if _, err := queued.Wait(ctx); err != ErrSchedulerClosed {
+		t.Errorf("关闭时排队中的提交应返回ErrSchedulerClosed,err为%v", err)
+	}
+	if _, err := sc.Submit(ctx, "c", &NewStatementQuery{Code: "c0"}).Wait(ctx); err != ErrSchedulerClosed {
+		t.Errorf("关闭后提交应返回ErrSchedulerClosed,err为%v", err)
+	}
+	//已经提交到livy的statement继续执行
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if st, err := running.Wait(ctx); err != nil || st.State != "available" {
+		t.Errorf("关闭前提交的statement应执行完,err为%v", err)
+	}
+	if got := submitted(t, s); len(got) != 1 {
+		t.Errorf("提交了%v,应只有a0", got)
+	}
+}
+
+func TestStatementFutureWaitContext(t *testing.T) {
+	_, sc, clock := newTestScheduler(t, 1)
+	f := sc.Submit(context.Background(), "a", &NewStatementQuery{Code: "a0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	//ctx只控制等待,不会取消statement
+	if _, err := f.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("err为%v,应为context.Canceled", err)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if st, err := f.Wait(context.Background()); err != nil || st.State != "available" {
+		t.Errorf("statement应继续执行,err为%v", err)
+	}
+}
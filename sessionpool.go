@@ -0,0 +1,385 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ErrPoolClosed session池已关闭
+var ErrPoolClosed = errors.New("session池已关闭")
+
+//SessionPoolConfig session池的配置
+type SessionPoolConfig struct {
+	//Query 创建session使用的请求,同一个池中的session使用相同的Kind;Name不为空时会加上序号以避免重名
+	Query NewSessionQuery
+	//MinSize 池中保持的空闲session数量
+	MinSize int
+	//MaxSize 池中最多的session数量,包括启动中和已借出的session
+	MaxSize int
+	//IdleTTL 空闲session的存活时间,超过MinSize的空闲session超时后会被关闭,为0时不回收
+	IdleTTL time.Duration
+	//PollInterval 等待session启动时的轮询间隔,为0时使用1秒
+	PollInterval time.Duration
+	//MaintainInterval 补充空闲session和回收超时session的间隔,为0时使用30秒
+	MaintainInterval time.Duration
+}
+
+type pooledSession struct {
+	session *Session
+	since   time.Time
+}
+
+//SessionPool 预先启动的session池,避免每次使用都等待session启动
+//
+//每个池只管理一种Kind的session,需要多种Kind时为每种Kind创建一个池
+type SessionPool struct {
+	client *LivyClient
+	config SessionPoolConfig
+
+	mu       sync.Mutex
+	idle     []*pooledSession
+	size     int
+	starting int
+	seq      int
+	closed   bool
+	changed  chan struct{}
+	wake     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+//NewSessionPool 创建session池,并在后台启动MinSize个空闲session
+func NewSessionPool(c *LivyClient, config SessionPoolConfig) (*SessionPool, error) {
+	if config.MaxSize <= 0 {
+		return nil, errors.New("MaxSize必须为正数")
+	}
+	if config.MinSize < 0 || config.MinSize > config.MaxSize {
+		return nil, errors.New("MinSize必须在0到MaxSize之间")
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.MaintainInterval <= 0 {
+		config.MaintainInterval = 30 * time.Second
+	}
+	p := new(SessionPool)
+	p.client = c
+	p.config = config
+	p.changed = make(chan struct{})
+	p.wake = make(chan struct{}, 1)
+	p.done = make(chan struct{})
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	go p.maintain(p.ctx)
+	return p, nil
+}
+
+//Kind 池中session的类型
+func (p *SessionPool) Kind() string {
+	return p.config.Query.Kind
+}
+
+//Stats 池中的session数量,分别为总数,空闲数和启动中的数量
+func (p *SessionPool) Stats() (size int, idle int, starting int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size, len(p.idle), p.starting
+}
+
+//notifyLocked 通知等待中的Acquire池状态发生了变化,调用时需要持有锁
+func (p *SessionPool) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *SessionPool) wakeMaintainer() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+//sessionHealth 池中session的状态
+type sessionHealth int
+
+const (
+	sessionIdle sessionHealth = iota
+	sessionBusy
+	sessionDead
+)
+
+//health 查询session的状态,session已经结束或livy返回404时为sessionDead;
+//请求失败时返回错误,网络错误不能说明session不可用
+func (p *SessionPool) health(ctx context.Context, s *Session) (sessionHealth, error) {
+	_, err := s.update(ctx)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "未找到资源") {
+			return sessionDead, nil
+		}
+		return sessionBusy, err
+	}
+	switch s.State {
+	case "idle":
+		return sessionIdle, nil
+	case "shutting_down", "error", "dead", "killed", "success":
+		return sessionDead, nil
+	}
+	return sessionBusy, nil
+}
+
+//put 将session放回空闲列表,池已关闭时关闭session
+func (p *SessionPool) put(s *Session) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.discard(s)
+		return
+	}
+	p.idle = append(p.idle, &pooledSession{session: s, since: p.client.clock().Now()})
+	p.notifyLocked()
+	p.mu.Unlock()
+}
+
+//putWhenIdle 在后台等待session执行完当前的statement后放回空闲列表
+func (p *SessionPool) putWhenIdle(s *Session) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.discard(s)
+		return
+	}
+	p.wg.Add(1)
+	p.mu.Unlock()
+	go func() {
+		defer p.wg.Done()
+		for {
+			select {
+			case <-p.ctx.Done():
+				p.discard(s)
+				return
+			case <-p.client.clock().After(p.config.PollInterval):
+			}
+			h, err := p.health(p.ctx, s)
+			switch {
+			case err != nil:
+				if p.ctx.Err() == nil {
+					p.client.logger().Warn("session pool check session error", "session_id", s.ID, "err", err)
+				}
+			case h == sessionDead:
+				p.discard(s)
+				return
+			case h == sessionIdle:
+				p.put(s)
+				return
+			}
+		}
+	}()
+}
+
+//start 创建一个新的session并等待其启动完成
+func (p *SessionPool) start(ctx context.Context) (*Session, error) {
+	q := p.config.Query
+	p.mu.Lock()
+	p.seq++
+	if q.Name != "" {
+		q.Name = fmt.Sprintf("%s-%d", q.Name, p.seq)
+	}
+	p.mu.Unlock()
+	s := p.client.NewSession()
+	err := s.NewWithContext(ctx, &q)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Wait(ctx, p.config.PollInterval)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+//discard 关闭并移除一个session
+func (p *SessionPool) discard(s *Session) {
+	p.mu.Lock()
+	p.size--
+	p.notifyLocked()
+	p.mu.Unlock()
+	p.wakeMaintainer()
+	err := s.Close()
+	if err != nil {
+		p.client.logger().Warn("session pool close session error", "session_id", s.ID, "state", s.State, "err", err)
+	}
+}
+
+//Acquire 从池中借出一个空闲的session,没有空闲session时在MaxSize范围内启动新的session,否则等待其他session被归还
+func (p *SessionPool) Acquire(ctx context.Context) (*Session, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if n := len(p.idle); n > 0 {
+			ps := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+			p.wakeMaintainer()
+			h, err := p.health(ctx, ps.session)
+			switch {
+			case err != nil:
+				//查询失败时保留session,由调用方决定是否重试
+				p.put(ps.session)
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, err
+			case h == sessionIdle:
+				return ps.session, nil
+			case h == sessionBusy:
+				p.putWhenIdle(ps.session)
+			default:
+				p.client.logger().Warn("session pool drop finished session", "session_id", ps.session.ID, "state", ps.session.State)
+				p.discard(ps.session)
+			}
+			continue
+		}
+		if p.size < p.config.MaxSize {
+			p.size++
+			p.mu.Unlock()
+			s, err := p.start(ctx)
+			if err != nil {
+				p.mu.Lock()
+				p.size--
+				p.notifyLocked()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return s, nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+//Release 将借出的session归还到池中
+//
+//已经结束或不存在的session会被关闭;还在执行statement的session在后台等待其空闲后放回池中;
+//查询状态失败时session仍然放回池中,下次借出时再检查
+func (p *SessionPool) Release(s *Session) {
+	h, err := p.health(context.Background(), s)
+	switch {
+	case err != nil:
+		p.client.logger().Warn("session pool check session error", "session_id", s.ID, "err", err)
+		p.put(s)
+	case h == sessionIdle:
+		p.put(s)
+	case h == sessionBusy:
+		p.putWhenIdle(s)
+	default:
+		p.discard(s)
+	}
+}
+
+func (p *SessionPool) maintain(ctx context.Context) {
+	defer close(p.done)
+	for {
+		p.reap()
+		p.fill(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-p.client.clock().After(p.config.MaintainInterval):
+		}
+	}
+}
+
+//reap 关闭超过IdleTTL的空闲session,保留MinSize个
+func (p *SessionPool) reap() {
+	if p.config.IdleTTL <= 0 {
+		return
+	}
+	now := p.client.clock().Now()
+	expired := []*Session{}
+	p.mu.Lock()
+	for len(p.idle) > p.config.MinSize && now.Sub(p.idle[0].since) > p.config.IdleTTL {
+		expired = append(expired, p.idle[0].session)
+		p.idle = p.idle[1:]
+	}
+	p.mu.Unlock()
+	for _, s := range expired {
+		p.discard(s)
+	}
+}
+
+//fill 在后台启动session直到空闲和启动中的session达到MinSize
+func (p *SessionPool) fill(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.closed && len(p.idle)+p.starting < p.config.MinSize && p.size < p.config.MaxSize {
+		p.size++
+		p.starting++
+		p.wg.Add(1)
+		go p.startSpare(ctx)
+	}
+}
+
+func (p *SessionPool) startSpare(ctx context.Context) {
+	defer p.wg.Done()
+	s, err := p.start(ctx)
+	p.mu.Lock()
+	p.starting--
+	if err != nil {
+		p.size--
+		p.notifyLocked()
+		p.mu.Unlock()
+		p.client.logger().Warn("session pool start session error", "kind", p.config.Query.Kind, "err", err)
+		return
+	}
+	if p.closed {
+		p.mu.Unlock()
+		p.discard(s)
+		return
+	}
+	p.idle = append(p.idle, &pooledSession{session: s, since: p.client.clock().Now()})
+	p.notifyLocked()
+	p.mu.Unlock()
+}
+
+//Close 关闭池和池中所有空闲的session,等待空闲的和之后归还的session也会被关闭
+func (p *SessionPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.notifyLocked()
+	p.mu.Unlock()
+	p.cancel()
+	<-p.done
+	p.wg.Wait()
+	var res error
+	for _, ps := range idle {
+		p.mu.Lock()
+		p.size--
+		p.mu.Unlock()
+		err := ps.session.Close()
+		if err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
@@ -0,0 +1,369 @@
+package golivyclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//newTestPool 在假服务上创建session池,测试结束时关闭;states为新建session的状态脚本,为空时直接为idle
+func newTestPool(t *testing.T, config SessionPoolConfig, states ...string) (*livytest.Server, *SessionPool, *livytest.FakeClock) {
+	t.Helper()
+	s, c, clock := newTestClient(t)
+	s.SessionStates = []string{"idle"}
+	if len(states) > 0 {
+		s.SessionStates = states
+	}
+	config.Query.Kind = KindPySpark
+	if config.PollInterval == 0 {
+		config.PollInterval = time.Second
+	}
+	if config.MaintainInterval == 0 {
+		config.MaintainInterval = 24 * time.Hour
+	}
+	p, err := NewSessionPool(c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return s, p, clock
+}
+
+//eventually 在cond成立前每次把时钟推进step,超时后报错
+func eventually(t *testing.T, clock *livytest.FakeClock, step time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时")
+		}
+		if step > 0 {
+			clock.Advance(step)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func statsAre(p *SessionPool, size, idle, starting int) func() bool {
+	return func() bool {
+		a, b, c := p.Stats()
+		return a == size && b == idle && c == starting
+	}
+}
+
+func TestNewSessionPoolConfig(t *testing.T) {
+	c := NewClient("http://localhost:8998")
+	for _, config := range []SessionPoolConfig{{}, {MaxSize: 1, MinSize: 2}, {MaxSize: 1, MinSize: -1}} {
+		if _, err := NewSessionPool(c, config); err == nil {
+			t.Errorf("%+v应返回错误", config)
+		}
+	}
+}
+
+func TestSessionPoolAcquireBlocksAtMaxSize(t *testing.T) {
+	_, p, _ := newTestPool(t, SessionPoolConfig{MaxSize: 1})
+	ctx := context.Background()
+	first, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("达到MaxSize时应等待到ctx超时,err为%v", err)
+	}
+
+	got := make(chan *Session)
+	go func() {
+		s, err := p.Acquire(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- s
+	}()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-got:
+		t.Fatal("没有空闲session时Acquire不应返回")
+	default:
+	}
+	p.Release(first)
+	if second := <-got; second != first {
+		t.Errorf("归还后应借出同一个session")
+	}
+	if size, idle, starting := p.Stats(); size != 1 || idle != 0 || starting != 0 {
+		t.Errorf("Stats为%d,%d,%d,应为1,0,0", size, idle, starting)
+	}
+}
+
+func TestSessionPoolReleaseDeadSession(t *testing.T) {
+	s, p, _ := newTestPool(t, SessionPoolConfig{MaxSize: 2})
+	ctx := context.Background()
+	dead, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ScriptSession(dead.ID, "dead"); err != nil {
+		t.Fatal(err)
+	}
+	p.Release(dead)
+	//已经被删除的session返回404,同样不放回池中
+	if err := gone.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p.Release(gone)
+	if size, idle, _ := p.Stats(); size != 0 || idle != 0 {
+		t.Errorf("Stats为%d,%d,应为0,0", size, idle)
+	}
+	if n := countRequests(s, http.MethodDelete, "/sessions/0"); n != 1 {
+		t.Errorf("结束的session被删除了%d次,应为1次", n)
+	}
+}
+
+func TestSessionPoolReleaseBusySession(t *testing.T) {
+	s, p, clock := newTestPool(t, SessionPoolConfig{MaxSize: 1})
+	ctx := context.Background()
+	busy, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ScriptSession(busy.ID, "busy", "busy", "busy", "idle"); err != nil {
+		t.Fatal(err)
+	}
+	p.Release(busy)
+	if size, idle, _ := p.Stats(); size != 1 || idle != 0 {
+		t.Fatalf("执行中的session不应立即放回,Stats为%d,%d", size, idle)
+	}
+	//每个PollInterval检查一次,空闲后放回池中
+	eventually(t, clock, time.Second, statsAre(p, 1, 1, 0))
+	if got, err := p.Acquire(ctx); err != nil || got != busy {
+		t.Errorf("应借出空闲后放回的session,err为%v", err)
+	}
+}
+
+func TestSessionPoolAcquireSkipsBusySession(t *testing.T) {
+	s, p, clock := newTestPool(t, SessionPoolConfig{MaxSize: 1})
+	ctx := context.Background()
+	first, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(first)
+	//空闲列表中的session被其他客户端占用
+	if err := s.ScriptSession(first.ID, "busy", "busy", "idle"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	var got *Session
+	go func() {
+		defer close(done)
+		got, err = p.Acquire(ctx)
+	}()
+	eventually(t, clock, time.Second, func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	})
+	if err != nil || got != first {
+		t.Errorf("应等待session空闲后借出,err为%v", err)
+	}
+}
+
+func TestSessionPoolFill(t *testing.T) {
+	s, p, clock := newTestPool(t, SessionPoolConfig{MinSize: 2, MaxSize: 3}, "starting", "starting", "idle")
+	//启动中的session也计入MinSize
+	eventually(t, clock, time.Second, statsAre(p, 2, 2, 0))
+	ctx := context.Background()
+	if _, err := p.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	//借出后补充到MinSize个空闲session
+	eventually(t, clock, time.Second, statsAre(p, 3, 2, 0))
+	if _, err := p.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	//达到MaxSize后不再补充
+	eventually(t, clock, time.Second, statsAre(p, 3, 1, 0))
+	if n := countRequests(s, http.MethodPost, "/sessions"); n != 3 {
+		t.Errorf("创建了%d个session,应为3个", n)
+	}
+}
+
+func TestSessionPoolFillNames(t *testing.T) {
+	s, p, clock := newTestPool(t, SessionPoolConfig{Query: NewSessionQuery{Name: "etl"}, MinSize: 2, MaxSize: 2})
+	eventually(t, clock, 0, statsAre(p, 2, 2, 0))
+	names := map[string]bool{}
+	for _, r := range s.Requests() {
+		if r.Method == http.MethodPost && r.Path == "/sessions" {
+			for _, name := range []string{`"name":"etl-1"`, `"name":"etl-2"`} {
+				if strings.Contains(string(r.Body), name) {
+					names[name] = true
+				}
+			}
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("session的名称应加上序号,得到%v", names)
+	}
+}
+
+func TestSessionPoolReap(t *testing.T) {
+	s, p, clock := newTestPool(t, SessionPoolConfig{MinSize: 1, MaxSize: 3, IdleTTL: time.Minute, MaintainInterval: 30 * time.Second})
+	eventually(t, clock, 0, statsAre(p, 1, 1, 0))
+	ctx := context.Background()
+	lent := []*Session{}
+	for i := 0; i < 3; i++ {
+		ss, err := p.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lent = append(lent, ss)
+	}
+	for _, ss := range lent {
+		p.Release(ss)
+	}
+	eventually(t, clock, 0, statsAre(p, 3, 3, 0))
+	clock.Advance(30 * time.Second)
+	if size, idle, _ := p.Stats(); size != 3 || idle != 3 {
+		t.Errorf("没有超过IdleTTL时不应回收,Stats为%d,%d", size, idle)
+	}
+	//超过IdleTTL后回收到MinSize个,保留最近归还的session
+	eventually(t, clock, 30*time.Second, statsAre(p, 1, 1, 0))
+	if got, err := p.Acquire(ctx); err != nil || got != lent[2] {
+		t.Errorf("应保留最近归还的session,err为%v", err)
+	}
+	deleted := 0
+	for _, ss := range lent[:2] {
+		deleted += countRequests(s, http.MethodDelete, "/sessions/"+strconv.Itoa(ss.ID))
+	}
+	if deleted != 2 {
+		t.Errorf("删除了%d个session,应为2个", deleted)
+	}
+}
+
+func TestSessionPoolClose(t *testing.T) {
+	s, p, _ := newTestPool(t, SessionPoolConfig{MaxSize: 2})
+	ctx := context.Background()
+	idle, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lent, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(idle)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Acquire(ctx); err != ErrPoolClosed {
+		t.Errorf("关闭后Acquire应返回ErrPoolClosed,err为%v", err)
+	}
+	//关闭后归还的session直接关闭
+	p.Release(lent)
+	if size, _, _ := p.Stats(); size != 0 {
+		t.Errorf("关闭后size为%d", size)
+	}
+	for _, ss := range []*Session{idle, lent} {
+		if n := countRequests(s, http.MethodDelete, "/sessions/"+strconv.Itoa(ss.ID)); n != 1 {
+			t.Errorf("session %d被删除了%d次,应为1次", ss.ID, n)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("重复Close返回了错误:%v", err)
+	}
+}
+
+func TestSessionPoolCloseWhileStarting(t *testing.T) {
+	s, p, clock := newTestPool(t, SessionPoolConfig{MinSize: 2, MaxSize: 2}, "starting")
+	//两个session都已创建,正在等待启动
+	eventually(t, clock, 0, func() bool {
+		return countRequests(s, http.MethodGet, "/sessions/0") > 0 && countRequests(s, http.MethodGet, "/sessions/1") > 0
+	})
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size, idle, starting := p.Stats(); size != 0 || idle != 0 || starting != 0 {
+		t.Errorf("Stats为%d,%d,%d,应为0,0,0", size, idle, starting)
+	}
+	for _, path := range []string{"/sessions/0", "/sessions/1"} {
+		if n := countRequests(s, http.MethodDelete, path); n != 1 {
+			t.Errorf("%s被删除了%d次,应为1次", path, n)
+		}
+	}
+}
+
+func TestSessionPoolCloseRacesStartSpare(t *testing.T) {
+	s, c, _ := newTestClient(t)
+	s.SessionStates = []string{"starting", "idle"}
+	reached := make(chan struct{})
+	//启动中的session恰好在Close取消ctx时变为idle
+	c.Use(func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			if req.Method == http.MethodGet && strings.HasSuffix(req.URL, "/sessions/0") {
+				close(reached)
+				<-req.Context.Done()
+				req.Context = context.WithoutCancel(req.Context)
+			}
+			return next(req)
+		}
+	})
+	p, err := NewSessionPool(c, SessionPoolConfig{Query: NewSessionQuery{Kind: KindSpark}, MinSize: 1, MaxSize: 1, MaintainInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-reached
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size, idle, starting := p.Stats(); size != 0 || idle != 0 || starting != 0 {
+		t.Errorf("Stats为%d,%d,%d,应为0,0,0", size, idle, starting)
+	}
+	if n := countRequests(s, http.MethodDelete, "/sessions/0"); n != 1 {
+		t.Errorf("关闭后启动完成的session被删除了%d次,应为1次", n)
+	}
+}
+
+func TestSessionPoolConcurrentAcquireRelease(t *testing.T) {
+	s, p, clock := newTestPool(t, SessionPoolConfig{MinSize: 1, MaxSize: 3})
+	ctx := context.Background()
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			ss, err := p.Acquire(ctx)
+			if err == nil {
+				p.Release(ss)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	eventually(t, clock, 0, func() bool {
+		size, idle, starting := p.Stats()
+		return size == idle && starting == 0
+	})
+	if size, _, _ := p.Stats(); size > 3 {
+		t.Errorf("size为%d,超过了MaxSize", size)
+	}
+	if n := countRequests(s, http.MethodPost, "/sessions"); n > 3 {
+		t.Errorf("创建了%d个session,超过了MaxSize", n)
+	}
+}
@@ -0,0 +1,306 @@
+package golivyclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+//CertKeyPair 客户端证书和私钥文件,PEM格式
+type CertKeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+//TLSOptions https连接的证书设置,通过LivyClient.TLS应用到客户端发出的所有请求
+//
+//证书文件在握手时按ReloadInterval检查修改时间和大小,变化后重新加载,以支持证书轮换;
+//重新加载失败时继续使用之前的证书,直到文件恢复正常
+type TLSOptions struct {
+	//CAFile 信任的CA证书,PEM格式,可以包含多个证书;为空时使用系统的证书池
+	CAFile string
+	//SystemRoots 为true时CAFile中的证书加入系统的证书池,而不是只信任CAFile
+	SystemRoots bool
+	//Certificates 客户端证书,服务端要求证书时选择第一个满足服务端要求的,都不满足时使用第一个
+	Certificates []CertKeyPair
+	//ServerName 校验服务端证书使用的名称,为空时使用请求地址中的主机名
+	ServerName string
+	//InsecureSkipVerify 不校验服务端证书,只用于测试
+	InsecureSkipVerify bool
+	//ReloadInterval 检查证书文件是否变化的最小间隔,为0时使用10秒,为负数时不重新加载;按使用它的LivyClient的Clock计时
+	ReloadInterval time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	files   map[string]fileStamp
+	pool    *x509.CertPool
+	certs   []tls.Certificate
+	base    *http.Client
+	client  *http.Client
+	clock   Clock
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (o *TLSOptions) reloadInterval() time.Duration {
+	if o.ReloadInterval == 0 {
+		return 10 * time.Second
+	}
+	return o.ReloadInterval
+}
+
+//paths 需要监视的证书文件
+func (o *TLSOptions) paths() []string {
+	paths := []string{}
+	if o.CAFile != "" {
+		paths = append(paths, o.CAFile)
+	}
+	for _, pair := range o.Certificates {
+		paths = append(paths, pair.CertFile, pair.KeyFile)
+	}
+	return paths
+}
+
+//current 返回当前的CA证书池和客户端证书,需要时重新加载
+func (o *TLSOptions) current() (*x509.CertPool, []tls.Certificate, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := SystemClock.Now()
+	if o.clock != nil {
+		now = o.clock.Now()
+	}
+	loaded := o.files != nil
+	if loaded && (o.reloadInterval() < 0 || now.Sub(o.checked) < o.reloadInterval()) {
+		return o.pool, o.certs, nil
+	}
+	o.checked = now
+	stamps := map[string]fileStamp{}
+	changed := !loaded
+	for _, path := range o.paths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			if loaded {
+				return o.pool, o.certs, nil
+			}
+			return nil, nil, fmt.Errorf("读取证书文件失败:%w", err)
+		}
+		stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		if stamps[path] != o.files[path] {
+			changed = true
+		}
+	}
+	if !changed {
+		return o.pool, o.certs, nil
+	}
+	pool, certs, err := o.load()
+	if err != nil {
+		if loaded {
+			return o.pool, o.certs, nil
+		}
+		return nil, nil, err
+	}
+	o.files = stamps
+	o.pool = pool
+	o.certs = certs
+	return pool, certs, nil
+}
+
+func (o *TLSOptions) load() (*x509.CertPool, []tls.Certificate, error) {
+	var pool *x509.CertPool
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取CA证书失败:%w", err)
+		}
+		if o.SystemRoots {
+			pool, err = x509.SystemCertPool()
+			if err != nil {
+				return nil, nil, fmt.Errorf("读取系统证书池失败:%w", err)
+			}
+		} else {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("%s中没有PEM格式的证书", o.CAFile)
+		}
+	}
+	certs := make([]tls.Certificate, len(o.Certificates))
+	for i, pair := range o.Certificates {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("加载客户端证书%s失败:%w", pair.CertFile, err)
+		}
+		certs[i] = cert
+	}
+	return pool, certs, nil
+}
+
+//Config 生成tls.Config,会立即加载一次证书文件以检查错误
+//
+//设置了CAFile时使用VerifyConnection按当前的CA证书校验服务端,因此InsecureSkipVerify为true;
+//此时ServerName为空的tls.Config只能校验发送了SNI的连接,ip地址需要设置ServerName,
+//LivyClient.TLS会按每个请求地址中的主机名校验,不受此限制
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	return o.config("")
+}
+
+//config 生成tls.Config,host为请求地址中的主机名,没有设置ServerName时用于校验服务端证书
+func (o *TLSOptions) config(host string) (*tls.Config, error) {
+	_, _, err := o.current()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if len(o.Certificates) > 0 {
+		cfg.GetClientCertificate = o.clientCertificate
+	}
+	if o.CAFile != "" && !o.InsecureSkipVerify {
+		name := o.ServerName
+		if name == "" {
+			name = host
+		}
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return o.verifyConnection(cs, name)
+		}
+	}
+	return cfg, nil
+}
+
+func (o *TLSOptions) clientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, certs, err := o.current()
+	if err != nil {
+		return nil, err
+	}
+	for i := range certs {
+		if info.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+	return &certs[0], nil
+}
+
+//verifyConnection 按当前的CA证书校验服务端证书,name为证书中应包含的主机名或ip地址,为空时使用SNI中的名称
+func (o *TLSOptions) verifyConnection(cs tls.ConnectionState, name string) error {
+	pool, _, err := o.current()
+	if err != nil {
+		return err
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("服务端没有提供证书")
+	}
+	if name == "" {
+		name = cs.ServerName
+	}
+	if name == "" {
+		return errors.New("无法确定校验服务端证书使用的主机名,需要设置ServerName")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+//httpClient 在base的基础上应用证书设置,base为nil时使用默认设置;结果会被缓存以复用连接
+//
+//clock为客户端的时钟,用于判断是否需要检查证书文件
+func (o *TLSOptions) httpClient(base *http.Client, clock Clock) *http.Client {
+	o.mu.Lock()
+	o.clock = clock
+	if o.client != nil && o.base == base {
+		client := o.client
+		o.mu.Unlock()
+		return client
+	}
+	o.mu.Unlock()
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+	_, _, err := o.current()
+	if err != nil {
+		client.Transport = errTransport{err}
+		return client
+	}
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		client.Transport = errTransport{fmt.Errorf("TLS只能应用到*http.Transport,HTTPClient的Transport为%T", t)}
+		return client
+	}
+	client.Transport = &hostTransport{options: o, base: transport, transports: map[string]*http.Transport{}}
+	o.mu.Lock()
+	o.base = base
+	o.client = client
+	o.mu.Unlock()
+	return client
+}
+
+//hostTransport 每个主机名使用单独的Transport,没有设置ServerName时按请求地址中的主机名校验服务端证书
+type hostTransport struct {
+	options    *TLSOptions
+	base       *http.Transport
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func (t *hostTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	host := r.URL.Hostname()
+	t.mu.Lock()
+	transport, ok := t.transports[host]
+	if !ok {
+		cfg, err := t.options.config(host)
+		if err != nil {
+			t.mu.Unlock()
+			return errTransport{err}.RoundTrip(r)
+		}
+		transport = t.base.Clone()
+		transport.TLSClientConfig = cfg
+		t.transports[host] = transport
+	}
+	t.mu.Unlock()
+	return transport.RoundTrip(r)
+}
+
+//CloseIdleConnections 关闭所有主机的空闲连接
+func (t *hostTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+//errTransport 证书设置错误时每个请求都返回该错误
+type errTransport struct {
+	err error
+}
+
+func (t errTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+	return nil, t.err
+}
@@ -0,0 +1,246 @@
+package golivyclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golivyclient/livytest"
+)
+
+//testCA 测试用的CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+//issue 签发证书,names为证书中的域名或ip地址,返回证书和私钥的PEM
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage, names ...string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeTestFile(t *testing.T, dir string, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+//newTLSServer 使用ca签发的证书启动https服务,cfg可以设置客户端证书的要求
+func newTLSServer(t *testing.T, ca *testCA, usage x509.ExtKeyUsage, cfg *tls.Config, names ...string) *httptest.Server {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, usage, names...)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"from":0,"total":0,"sessions":[]}`))
+	}))
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+	s.TLS = cfg
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func tlsGet(s *httptest.Server, o *TLSOptions) error {
+	c := NewClient(s.URL)
+	c.TLS = o
+	_, err := c.HTTPJSONQuery(s.URL+"/batches", http.MethodGet)
+	return err
+}
+
+func TestTLSVerifiesServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	caFile := writeTestFile(t, dir, "ca.pem", ca.pem)
+
+	//服务在127.0.0.1上,证书中只有other.example
+	s := newTLSServer(t, ca, x509.ExtKeyUsageServerAuth, nil, "other.example")
+	if err := tlsGet(s, &TLSOptions{CAFile: caFile}); err == nil {
+		t.Error("证书中没有请求地址时应返回错误")
+	}
+	if err := tlsGet(s, &TLSOptions{CAFile: caFile, ServerName: "other.example"}); err != nil {
+		t.Errorf("ServerName与证书一致时返回了错误:%v", err)
+	}
+
+	s = newTLSServer(t, ca, x509.ExtKeyUsageServerAuth, nil, "127.0.0.1")
+	if err := tlsGet(s, &TLSOptions{CAFile: caFile}); err != nil {
+		t.Errorf("证书包含请求的ip地址时返回了错误:%v", err)
+	}
+	if err := tlsGet(s, &TLSOptions{CAFile: caFile, ServerName: "other.example"}); err == nil {
+		t.Error("证书中没有ServerName时应返回错误")
+	}
+}
+
+func TestTLSRejectsWrongCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other")
+	s := newTLSServer(t, ca, x509.ExtKeyUsageServerAuth, nil, "127.0.0.1")
+	if err := tlsGet(s, &TLSOptions{CAFile: writeTestFile(t, dir, "other.pem", other.pem)}); err == nil {
+		t.Error("服务端证书不是CAFile签发的时应返回错误")
+	}
+}
+
+func TestTLSRequiresServerAuthUsage(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	s := newTLSServer(t, ca, x509.ExtKeyUsageClientAuth, nil, "127.0.0.1")
+	if err := tlsGet(s, &TLSOptions{CAFile: writeTestFile(t, t.TempDir(), "ca.pem", ca.pem)}); err == nil {
+		t.Error("服务端证书不能用于服务端认证时应返回错误")
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	caFile := writeTestFile(t, dir, "ca.pem", ca.pem)
+	clients := x509.NewCertPool()
+	clients.AddCert(ca.cert)
+	s := newTLSServer(t, ca, x509.ExtKeyUsageServerAuth, &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}, "127.0.0.1")
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageClientAuth, "client")
+	pair := CertKeyPair{CertFile: writeTestFile(t, dir, "client.pem", certPEM), KeyFile: writeTestFile(t, dir, "client.key", keyPEM)}
+	if err := tlsGet(s, &TLSOptions{CAFile: caFile, Certificates: []CertKeyPair{pair}}); err != nil {
+		t.Errorf("提供客户端证书时返回了错误:%v", err)
+	}
+	if err := tlsGet(s, &TLSOptions{CAFile: caFile}); err == nil {
+		t.Error("服务端要求客户端证书时应返回错误")
+	}
+}
+
+func TestTLSReloadsCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other")
+	caFile := writeTestFile(t, dir, "ca.pem", other.pem)
+	s := newTLSServer(t, ca, x509.ExtKeyUsageServerAuth, nil, "127.0.0.1")
+	clock := livytest.NewFakeClock(time.Unix(0, 0))
+	c := NewClient(s.URL)
+	c.Clock = clock
+	c.TLS = &TLSOptions{CAFile: caFile, ReloadInterval: 10 * time.Second}
+	get := func() error {
+		_, err := c.HTTPJSONQuery(s.URL+"/batches", http.MethodGet)
+		return err
+	}
+	if err := get(); err == nil {
+		t.Fatal("CA不匹配时应返回错误")
+	}
+	//证书轮换
+	writeTestFile(t, dir, "ca.pem", ca.pem)
+	later := time.Now().Add(time.Minute)
+	err := os.Chtimes(caFile, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(); err == nil {
+		t.Error("ReloadInterval内不应重新加载证书")
+	}
+	clock.Advance(10 * time.Second)
+	if err := get(); err != nil {
+		t.Errorf("重新加载CA后返回了错误:%v", err)
+	}
+	//文件损坏时继续使用之前的证书
+	writeTestFile(t, dir, "ca.pem", []byte("broken"))
+	clock.Advance(10 * time.Second)
+	if err := get(); err != nil {
+		t.Errorf("证书文件损坏后返回了错误:%v", err)
+	}
+}
+
+func TestTLSConfigWithoutServerName(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	s := newTLSServer(t, ca, x509.ExtKeyUsageServerAuth, nil, "127.0.0.1")
+	o := &TLSOptions{CAFile: writeTestFile(t, t.TempDir(), "ca.pem", ca.pem)}
+	cfg, err := o.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//ip地址不发送SNI,没有可以校验的名称时拒绝连接
+	conn, err := tls.Dial("tcp", s.Listener.Addr().String(), cfg)
+	if err == nil {
+		conn.Close()
+		t.Error("没有ServerName时连接ip地址应返回错误")
+	}
+}
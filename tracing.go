@@ -0,0 +1,39 @@
+package golivyclient
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "golivyclient"
+
+//livy对象在span中的属性名
+const (
+	AttrBatchID     = attribute.Key("livy.batch.id")
+	AttrSessionID   = attribute.Key("livy.session.id")
+	AttrStatementID = attribute.Key("livy.statement.id")
+	AttrJobID       = attribute.Key("livy.job.id")
+	AttrAppID       = attribute.Key("livy.app_id")
+	AttrKind        = attribute.Key("livy.kind")
+	AttrQueue       = attribute.Key("livy.queue")
+	AttrState       = attribute.Key("livy.state")
+)
+
+func (c *LivyClient) tracer() trace.Tracer {
+	tp := c.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+//endSpan 结束span,err不为nil时将span标记为失败
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
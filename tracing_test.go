@@ -0,0 +1,192 @@
+package golivyclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"golivyclient/livytest"
+)
+
+//tracedClient 使用内存exporter记录span的客户端,返回的函数获取每个请求发出时的traceparent
+func tracedClient(t *testing.T, s *livytest.Server) (*LivyClient, *tracetest.InMemoryExporter, func() []string) {
+	t.Helper()
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	c := NewClient(s.URL)
+	c.TracerProvider = tp
+	c.Clock = livytest.NewFakeClock(time.Unix(0, 0))
+	var mu sync.Mutex
+	parents := []string{}
+	c.Use(func(next RoundTrip) RoundTrip {
+		return func(req *Request) (*Response, error) {
+			mu.Lock()
+			parents = append(parents, req.Header.Get("traceparent"))
+			mu.Unlock()
+			return next(req)
+		}
+	})
+	return c, exp, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, parents...)
+	}
+}
+
+func spanAttr(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func spansNamed(spans tracetest.SpanStubs, name string) []tracetest.SpanStub {
+	res := []tracetest.SpanStub{}
+	for _, span := range spans {
+		if span.Name == name {
+			res = append(res, span)
+		}
+	}
+	return res
+}
+
+func TestTracingBatchSubmitAndWait(t *testing.T) {
+	s := livytest.NewServer()
+	defer s.Close()
+	s.BatchStates = []string{"starting", "running", "success"}
+	c, exp, parents := tracedClient(t, s)
+
+	ctx, root := c.tracer().Start(context.Background(), "test")
+	b := NewBatch(c)
+	err := b.NewWithContext(ctx, &NewBatchQuery{File: "hdfs:///app.jar", Queue: "etl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Wait(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	spans := exp.GetSpans()
+	traceID := root.SpanContext().TraceID()
+	for _, span := range spans {
+		if span.SpanContext.TraceID() != traceID {
+			t.Errorf("span %s不在同一个trace中", span.Name)
+		}
+	}
+
+	news := spansNamed(spans, "livy.batch.new")
+	if len(news) != 1 {
+		t.Fatalf("livy.batch.new的数量为%d", len(news))
+	}
+	newSpan := news[0]
+	if newSpan.Parent.SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("livy.batch.new的父span错误")
+	}
+	if v, _ := spanAttr(newSpan, AttrQueue); v.AsString() != "etl" {
+		t.Errorf("livy.queue为%q", v.AsString())
+	}
+	if v, ok := spanAttr(newSpan, AttrBatchID); !ok || v.AsInt64() != int64(b.ID) {
+		t.Errorf("livy.batch.id为%v", v.Emit())
+	}
+
+	posts := spansNamed(spans, "livy POST batches")
+	if len(posts) != 1 {
+		t.Fatalf("livy POST batches的数量为%d", len(posts))
+	}
+	post := posts[0]
+	if post.SpanKind != trace.SpanKindClient {
+		t.Errorf("请求span的kind为%s", post.SpanKind)
+	}
+	if post.Parent.SpanID() != newSpan.SpanContext.SpanID() {
+		t.Errorf("请求span不是livy.batch.new的子span")
+	}
+	if v, _ := spanAttr(post, "http.request.method"); v.AsString() != http.MethodPost {
+		t.Errorf("http.request.method为%q", v.AsString())
+	}
+	if v, _ := spanAttr(post, "url.full"); v.AsString() != s.URL+"/batches" {
+		t.Errorf("url.full为%q", v.AsString())
+	}
+	if v, _ := spanAttr(post, "http.response.status_code"); v.AsInt64() != http.StatusCreated {
+		t.Errorf("http.response.status_code为%d", v.AsInt64())
+	}
+
+	waits := spansNamed(spans, "livy.batch.wait")
+	if len(waits) != 1 {
+		t.Fatalf("livy.batch.wait的数量为%d", len(waits))
+	}
+	if v, _ := spanAttr(waits[0], AttrState); v.AsString() != "success" {
+		t.Errorf("livy.state为%q", v.AsString())
+	}
+	gets := spansNamed(spans, "livy GET batches/{id}")
+	if len(gets) != 2 {
+		t.Fatalf("livy GET batches/{id}的数量为%d", len(gets))
+	}
+	for _, get := range gets {
+		if get.Parent.SpanID() != waits[0].SpanContext.SpanID() {
+			t.Errorf("轮询请求不是livy.batch.wait的子span")
+		}
+	}
+
+	//每个请求的traceparent为对应的请求span
+	want := []string{}
+	for _, span := range append([]tracetest.SpanStub{post}, gets...) {
+		sc := span.SpanContext
+		want = append(want, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-"+sc.TraceFlags().String())
+	}
+	got := parents()
+	if len(got) != len(want) {
+		t.Fatalf("请求数为%d,应为%d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第%d个请求的traceparent为%q,应为%q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	s := livytest.NewServer()
+	defer s.Close()
+	c, exp, _ := tracedClient(t, s)
+	s.InjectFailure(livytest.Failure{Method: http.MethodPost, Path: "/batches", Status: http.StatusBadRequest, Body: "bad request"})
+
+	err := NewBatch(c).NewWithContext(context.Background(), &NewBatchQuery{File: "hdfs:///app.jar"})
+	if err == nil {
+		t.Fatal("请求失败时应返回错误")
+	}
+	spans := exp.GetSpans()
+	for _, name := range []string{"livy.batch.new", "livy POST batches"} {
+		found := spansNamed(spans, name)
+		if len(found) != 1 {
+			t.Fatalf("%s的数量为%d", name, len(found))
+		}
+		if found[0].Status.Code != codes.Error {
+			t.Errorf("%s的状态为%s,应为Error", name, found[0].Status.Code)
+		}
+		if len(found[0].Events) == 0 || found[0].Events[0].Name != "exception" {
+			t.Errorf("%s没有记录错误", name)
+		}
+	}
+	post := spansNamed(spans, "livy POST batches")[0]
+	if v, _ := spanAttr(post, "http.response.status_code"); v.AsInt64() != http.StatusBadRequest {
+		t.Errorf("http.response.status_code为%d", v.AsInt64())
+	}
+}
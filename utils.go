@@ -2,11 +2,14 @@ package golivyclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 
 	jsoniter "github.com/json-iterator/go"
@@ -14,64 +17,29 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
-//HTTPJSONQuery 构造http请求
+//HTTPJSONQuery 使用Default客户端构造http请求,Default的HTTPClient,TLS和中间件都会生效
+//
+//Deprecated: 使用LivyClient.HTTPJSONQuery,以使用指定客户端的设置
 func HTTPJSONQuery(URL string, Method string, jsonData ...interface{}) ([]byte, error) {
+	return Default.HTTPJSONQuery(URL, Method, jsonData...)
+}
+
+func newRequest(ctx context.Context, URL string, Method string, jsonData ...interface{}) (*Request, error) {
+	req := &Request{
+		Context: ctx,
+		Method:  Method,
+		URL:     URL,
+		Header:  http.Header{},
+	}
 	switch len(jsonData) {
 	case 0:
 		{
-			req, err := http.NewRequest(Method, URL, nil)
-			if err != nil {
-				return nil, err
-			}
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				return nil, err
-			}
-			defer resp.Body.Close()
-			res, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return nil, err
-			}
-			if resp.StatusCode == 404 {
-				return nil, fmt.Errorf("未找到资源,url:%s", URL)
-			}
-			if resp.StatusCode >= 300 {
-				return nil, fmt.Errorf("请求失败,code:%d;msg:%s", resp.StatusCode, res)
-			}
-
-			return res, nil
+			return req, nil
 		}
 	case 1:
 		{
-			kvalue, err := json.Marshal(jsonData[0])
-			if err != nil {
-				return nil, err
-			}
-			req, err := http.NewRequest(Method, URL, bytes.NewBuffer(kvalue))
-			if err != nil {
-				return nil, err
-			}
-			req.Header.Set("Content-Type", "application/json;charset=utf-8")
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				return nil, err
-			}
-
-			defer resp.Body.Close()
-			res, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return nil, err
-			}
-			if resp.StatusCode == 404 {
-				return nil, fmt.Errorf("未找到资源,url:%s", URL)
-			}
-			if resp.StatusCode >= 300 {
-				return nil, fmt.Errorf("请求失败,code:%d;msg:%s", resp.StatusCode, res)
-			}
-			return res, nil
+			req.Body = jsonData[0]
+			return req, nil
 		}
 	default:
 		{
@@ -80,6 +48,85 @@ func HTTPJSONQuery(URL string, Method string, jsonData ...interface{}) ([]byte,
 	}
 }
 
+//doRequest 发送请求并读取响应,不检查状态码
+func doRequest(client *http.Client, r *Request) (*Response, error) {
+	var body io.Reader
+	contentType := ""
+	switch data := r.Body.(type) {
+	case nil:
+	case *UploadFile:
+		body, contentType = data.multipart()
+	default:
+		kvalue, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewBuffer(kvalue)
+		contentType = "application/json;charset=utf-8"
+	}
+	req, err := http.NewRequestWithContext(r.Context, r.Method, r.URL, body)
+	if err != nil {
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, err
+	}
+	for key, values := range r.Header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	res, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: res}, nil
+}
+
+//checkResponse 将失败的状态码转换为错误
+func checkResponse(req *Request, resp *Response) ([]byte, error) {
+	if resp.StatusCode == 404 {
+		return nil, fmt.Errorf("未找到资源,url:%s", req.URL)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("请求失败,code:%d;msg:%s", resp.StatusCode, resp.Body)
+	}
+	return resp.Body, nil
+}
+
+//UploadFile 以multipart/form-data上传的文件,作为请求体时不会被编码为json
+type UploadFile struct {
+	//Field 表单字段名
+	Field string
+	//Name 文件名
+	Name string
+	//Reader 文件内容
+	Reader io.Reader
+}
+
+//multipart 将文件以流的形式编码为multipart请求体
+func (f *UploadFile) multipart() (io.Reader, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile(f.Field, f.Name)
+		if err == nil {
+			_, err = io.Copy(part, f.Reader)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, mw.FormDataContentType()
+}
+
 // MD5 md5字符串
 func MD5(data []byte) string {
 	h := md5.New()
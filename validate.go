@@ -0,0 +1,189 @@
+package golivyclient
+
+import (
+	jsonl "encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//FieldError 请求中一个字段的错误,Field为字段的路径,如"Conf[spark.executor.memory]"或"Jars[1]"
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ":" + e.Msg
+}
+
+//ValidationError 请求校验失败,包含所有字段的错误
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return "请求校验失败:" + strings.Join(msgs, ";")
+}
+
+//Unwrap 返回所有字段的错误,可以使用errors.As获取FieldError
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe
+	}
+	return errs
+}
+
+//SessionKinds livy支持的session类型
+var SessionKinds = []string{KindSpark, KindPySpark, KindSparkR, KindSQL, "shared"}
+
+//memoryPattern jvm的内存格式,如512m或4g
+var memoryPattern = regexp.MustCompile(`^[1-9][0-9]*[kKmMgGtT]$`)
+
+//overheadPattern memoryOverhead的格式,没有单位时以MiB为单位,如384或1g
+var overheadPattern = regexp.MustCompile(`^[1-9][0-9]*[kKmMgGtT]?$`)
+
+//memoryConf 值为内存格式的spark配置,为true的配置没有单位时以MiB为单位,可以只写数字
+var memoryConf = map[string]bool{
+	"spark.driver.memory":           false,
+	"spark.executor.memory":         false,
+	"spark.driver.memoryOverhead":   true,
+	"spark.executor.memoryOverhead": true,
+	"spark.yarn.am.memory":          false,
+}
+
+type validator struct {
+	errs []*FieldError
+}
+
+func (v *validator) add(field string, format string, args ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Field: field, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+//memory 检查jvm的内存格式,4gb这样带b的写法会被拒绝;bareMiB为true时可以只写以MiB为单位的数字
+func (v *validator) memory(field string, value string, bareMiB bool) {
+	if value == "" {
+		return
+	}
+	switch {
+	case bareMiB && !overheadPattern.MatchString(value):
+		v.add(field, "内存格式错误:%q,应为以MiB为单位的正整数,或正整数加k,m,g或t,如384,512m或4g", value)
+	case !bareMiB && !memoryPattern.MatchString(value):
+		v.add(field, "内存格式错误:%q,应为正整数加k,m,g或t,如512m或4g", value)
+	}
+}
+
+func (v *validator) nonNegative(field string, value int) {
+	if value < 0 {
+		v.add(field, "不能为负数:%d", value)
+	}
+}
+
+func (v *validator) list(field string, values []string) {
+	for i, ele := range values {
+		if strings.TrimSpace(ele) == "" {
+			v.add(fmt.Sprintf("%s[%d]", field, i), "不能为空")
+		}
+	}
+}
+
+//conf spark的配置只接受字符串,布尔值和数字
+func (v *validator) conf(conf map[string]interface{}) {
+	keys := make([]string, 0, len(conf))
+	for key := range conf {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := conf[key]
+		field := fmt.Sprintf("Conf[%s]", key)
+		if strings.TrimSpace(key) == "" {
+			v.add(field, "配置名不能为空")
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			if bareMiB, ok := memoryConf[key]; ok {
+				v.memory(field, value, bareMiB)
+			}
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, jsonl.Number:
+		case nil:
+			v.add(field, "不能为null")
+		default:
+			v.add(field, "spark配置只能为字符串,布尔值或数字,不能为%T", value)
+		}
+	}
+}
+
+//Validate 检查请求中的错误,所有错误会合并为一个ValidationError返回
+//
+//检查File不为空,内存格式,cores和executor数量不为负数,python或R程序没有设置ClassName,
+//文件列表中没有空字符串,以及Conf的值为spark接受的标量类型
+func (q *NewBatchQuery) Validate() error {
+	v := new(validator)
+	if strings.TrimSpace(q.File) == "" {
+		v.add("File", "不能为空")
+	}
+	if q.ClassName != "" {
+		lower := strings.ToLower(q.File)
+		if strings.HasSuffix(lower, ".py") || strings.HasSuffix(lower, ".r") {
+			v.add("ClassName", "python或R程序不能设置ClassName:%s", q.File)
+		}
+	}
+	v.memory("DriverMemory", q.DriverMemory, false)
+	v.memory("ExecutorMemory", q.ExecutorMemory, false)
+	v.nonNegative("DriverCores", q.DriverCores)
+	v.nonNegative("ExecutorCores", q.ExecutorCores)
+	v.nonNegative("NumExecutors", q.NumExecutors)
+	v.list("Jars", q.Jars)
+	v.list("PyFiles", q.PyFiles)
+	v.list("Files", q.Files)
+	v.list("Archives", q.Archives)
+	v.conf(q.Conf)
+	return v.err()
+}
+
+//Validate 检查请求中的错误,所有错误会合并为一个ValidationError返回
+//
+//检查Kind为SessionKinds之一或为空,内存格式,cores,executor数量和心跳超时不为负数,
+//文件列表中没有空字符串,以及Conf的值为spark接受的标量类型
+func (q *NewSessionQuery) Validate() error {
+	v := new(validator)
+	if q.Kind != "" {
+		known := false
+		for _, kind := range SessionKinds {
+			if q.Kind == kind {
+				known = true
+				break
+			}
+		}
+		if !known {
+			v.add("Kind", "未知的session类型:%q,应为%s之一", q.Kind, strings.Join(SessionKinds, ","))
+		}
+	}
+	v.memory("DriverMemory", q.DriverMemory, false)
+	v.memory("ExecutorMemory", q.ExecutorMemory, false)
+	v.nonNegative("DriverCores", q.DriverCores)
+	v.nonNegative("ExecutorCores", q.ExecutorCores)
+	v.nonNegative("NumExecutors", q.NumExecutors)
+	v.nonNegative("HeartbeatTimeoutInSecond", q.HeartbeatTimeoutInSecond)
+	v.list("Jars", q.Jars)
+	v.list("PyFiles", q.PyFiles)
+	v.list("Files", q.Files)
+	v.list("Archives", q.Archives)
+	v.conf(q.Conf)
+	return v.err()
+}
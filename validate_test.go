@@ -0,0 +1,142 @@
+package golivyclient
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//fieldErrors 校验错误中的字段,按字段名排序
+func fieldErrors(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	verr := new(ValidationError)
+	if !errors.As(err, &verr) {
+		t.Fatalf("err的类型为%T,应为*ValidationError", err)
+	}
+	fields := []string{}
+	for _, fe := range verr.Errors {
+		fields = append(fields, fe.Field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestBatchQueryValidate(t *testing.T) {
+	q := &NewBatchQuery{
+		File:           "hdfs:///app.py",
+		ClassName:      "Main",
+		DriverMemory:   "4gb",
+		ExecutorMemory: "1024",
+		NumExecutors:   -1,
+		Jars:           []string{"a.jar", " "},
+		Conf: map[string]interface{}{
+			"spark.executor.memoryOverhead": "512",
+			"spark.driver.memoryOverhead":   "0g",
+			"spark.sql.shuffle.partitions":  200,
+			"spark.ui.enabled":              false,
+			"spark.yarn.tags":               []string{"a"},
+			"spark.app.owner":               nil,
+		},
+	}
+	err := q.Validate()
+	got := strings.Join(fieldErrors(t, err), ",")
+	want := "ClassName,Conf[spark.app.owner],Conf[spark.driver.memoryOverhead],Conf[spark.yarn.tags],DriverMemory,ExecutorMemory,Jars[1],NumExecutors"
+	if got != want {
+		t.Errorf("出错的字段为%s,应为%s", got, want)
+	}
+	fe := new(FieldError)
+	if !errors.As(err, &fe) {
+		t.Error("应可以通过errors.As获取FieldError")
+	}
+
+	q = &NewBatchQuery{File: "hdfs:///app.jar", ClassName: "Main", DriverMemory: "512M", Conf: map[string]interface{}{"spark.executor.memory": "2g"}}
+	if err := q.Validate(); err != nil {
+		t.Errorf("合法的请求返回了错误:%v", err)
+	}
+	if err := (&NewBatchQuery{}).Validate(); strings.Join(fieldErrors(t, err), ",") != "File" {
+		t.Errorf("File为空时err为%v", err)
+	}
+}
+
+func TestValidateMemory(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{"512m", true},
+		{"4g", true},
+		{"4G", true},
+		{"1t", true},
+		{"4gb", false},
+		{"4GB", false},
+		{"1024", false},
+		{"0g", false},
+		{"04g", false},
+		{"1.5g", false},
+		{"-1g", false},
+		{" 4g", false},
+	}
+	for _, c := range cases {
+		err := (&NewSessionQuery{DriverMemory: c.value}).Validate()
+		fe := new(FieldError)
+		switch {
+		case c.valid && err != nil:
+			t.Errorf("DriverMemory为%q时返回了错误:%v", c.value, err)
+		case !c.valid && (!errors.As(err, &fe) || fe.Field != "DriverMemory"):
+			t.Errorf("DriverMemory为%q时err为%v,应为DriverMemory的FieldError", c.value, err)
+		}
+	}
+	overhead := map[string]bool{"384": true, "512m": true, "2g": true, "0": false, "4gb": false, "384mb": false}
+	for value, valid := range overhead {
+		err := (&NewSessionQuery{Conf: map[string]interface{}{"spark.executor.memoryOverhead": value}}).Validate()
+		if (err == nil) != valid {
+			t.Errorf("spark.executor.memoryOverhead为%q时err为%v", value, err)
+		}
+	}
+}
+
+func TestSessionQueryValidate(t *testing.T) {
+	q := &NewSessionQuery{Kind: "java", ExecutorMemory: "4x", HeartbeatTimeoutInSecond: -1}
+	got := strings.Join(fieldErrors(t, q.Validate()), ",")
+	if got != "ExecutorMemory,HeartbeatTimeoutInSecond,Kind" {
+		t.Errorf("出错的字段为%s", got)
+	}
+	for _, kind := range append([]string{""}, SessionKinds...) {
+		if err := (&NewSessionQuery{Kind: kind}).Validate(); err != nil {
+			t.Errorf("Kind为%q时返回了错误:%v", kind, err)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	cases := []struct {
+		s    string
+		want Memory
+	}{
+		{"512m", 512 * MB},
+		{"4g", 4 * GB},
+		{"4GB", 4 * GB},
+		{" 1t ", TB},
+		{"2kb", 2 * KB},
+		{"1024", 1024},
+		{"0", 0},
+	}
+	for _, c := range cases {
+		got, err := ParseMemory(c.s)
+		if err != nil || got != c.want {
+			t.Errorf("ParseMemory(%q)为%d,%v,应为%d", c.s, got, err, c.want)
+		}
+	}
+	for _, s := range []string{"", "4x", "-1g", "1.5g", "g", "4bb"} {
+		if _, err := ParseMemory(s); err == nil {
+			t.Errorf("ParseMemory(%q)应返回错误", s)
+		}
+	}
+	if s := (1536 * MB).String(); s != "1536m" {
+		t.Errorf("1536m转为字符串为%s", s)
+	}
+}